@@ -3,6 +3,7 @@ package ast
 import (
 	"mockc/token"
 	"bytes"
+	"math/big"
 	"strings"
 )
 
@@ -21,6 +22,75 @@ type Expression interface { // Expression interface
 	expressionNode() // Including these dummy methods helps determine if we used a statement/expression in the wrong place
 }
 
+/*
+ The token a statement starts with, for its position in the source
+ */
+func StatementToken(stmt Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		return stmt.Token
+	case *StructStatement:
+		return stmt.Token
+	case *ImplStatement:
+		return stmt.Token
+	case *ReturnStatement:
+		return stmt.Token
+	case *ExpressionStatement:
+		return stmt.Token
+	case *BlockStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
+/*
+ The token an expression starts with, for its position in the source. Operators come after their left operand, so
+ the position of 1 + 2 is the 1's
+ */
+func ExpressionToken(exp Expression) token.Token {
+	switch exp := exp.(type) {
+	case *InfixExpression:
+		return ExpressionToken(exp.Left)
+	case *CallExpression:
+		return ExpressionToken(exp.Function)
+	case *IndexExpression:
+		return ExpressionToken(exp.Left)
+	case *SliceExpression:
+		return ExpressionToken(exp.Left)
+	case *MemberExpression:
+		return ExpressionToken(exp.Object)
+	case *Identifier:
+		return exp.Token
+	case *IntegerLiteral:
+		return exp.Token
+	case *StringLiteral:
+		return exp.Token
+	case *Boolean:
+		return exp.Token
+	case *PrefixExpression:
+		return exp.Token
+	case *IfExpression:
+		return exp.Token
+	case *FunctionLiteral:
+		return exp.Token
+	case *Array:
+		return exp.Token
+	case *HashLiteral:
+		return exp.Token
+	case *MatchExpression:
+		return exp.Token
+	case *ForExpression:
+		return exp.Token
+	case *YieldExpression:
+		return exp.Token
+	case *SpawnExpression:
+		return exp.Token
+	case *AwaitExpression:
+		return exp.Token
+	}
+	return token.Token{}
+}
+
 type Program struct {
 	Statements []Statement
 }
@@ -44,9 +114,11 @@ func (p *Program) String() string {
 }
 
 type LetStatement struct {
-	Token token.Token // token.LET token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token // token.LET token
+	Name    *Identifier
+	Pattern Pattern // Set instead of Name when destructuring, ex. let [a, b] = arr;
+	Type    TypeExpression // Optional annotation, ex. let x: int = 5;
+	Value   Expression
 }
 
 func (ls *LetStatement) statementNode() 	  {}
@@ -55,7 +127,12 @@ func (ls *LetStatement) String() string  	  {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ") // Space after let
-	out.WriteString(ls.Name.String()) // Identifier
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String()) // Identifier
+	}
+	if ls.Type != nil { out.WriteString(": " + ls.Type.String()) }
 	out.WriteString(" = ") // Add equals to buffer
 
 	if ls.Value != nil { // If the let statement has a second side, add to buffer
@@ -66,9 +143,48 @@ func (ls *LetStatement) String() string  	  {
 	return out.String() // Return the whole let statement as a string
 }
 
+type StructStatement struct {
+	Token  token.Token // token.STRUCT token
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) String() string       {
+	fields := []string{}
+	for _, field := range ss.Fields { fields = append(fields, field.String()) }
+
+	return ss.TokenLiteral() + " " + ss.Name.String() + " { " + strings.Join(fields, ", ") + " }"
+}
+
+type ImplStatement struct {
+	Token   token.Token // token.IMPL token
+	Name    *Identifier // Struct type the methods are attached to
+	Methods []*LetStatement
+}
+
+func (is *ImplStatement) statementNode()       {}
+func (is *ImplStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImplStatement) String() string       {
+	var out bytes.Buffer
+
+	out.WriteString(is.TokenLiteral() + " " + is.Name.String() + " { ")
+	for _, method := range is.Methods { out.WriteString(method.String() + " ") }
+	out.WriteString("}")
+
+	return out.String()
+}
+
 type Identifier struct {
 	Token token.Token // Identifier token
 	Value string
+
+	// Filled in by the resolver. A resolved identifier lives in slot Slot of the environment Depth levels out, an
+	// unresolved one is looked up by name, ex. globals
+	Resolved bool
+	Depth    int
+	Slot     int
 }
 
 func (i *Identifier) expressionNode() 	   {}
@@ -113,6 +229,7 @@ func (es *ExpressionStatement) String() string 		 {
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // Set instead of Value when the literal doesn't fit in 64 bits
 }
 
 func (il *IntegerLiteral) expressionNode() 		{}
@@ -203,6 +320,60 @@ func (ie *IfExpression) String() string 	  {
 	return out.String()
 }
 
+/*
+ for (pattern in iterable) { body } runs body once per element of an array, string, hash or iterator
+ */
+type ForExpression struct {
+	Token    token.Token // for
+	Pattern  Pattern     // Bound to each element in turn, ex. x or [key, value]
+	Iterable Expression
+	Body     *BlockStatement
+	Scope    *Scope // Filled in by the resolver, each element is bound in a fresh environment
+}
+
+func (fe *ForExpression) expressionNode()      {}
+func (fe *ForExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *ForExpression) String() string       {
+	return "for (" + fe.Pattern.String() + " in " + fe.Iterable.String() + ") " + fe.Body.String()
+}
+
+/*
+ yield value hands value to whoever is iterating over the generator the enclosing function returned
+ */
+type YieldExpression struct {
+	Token token.Token // yield
+	Value Expression
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) String() string       { return "yield " + ye.Value.String() }
+
+/*
+ spawn f(x) runs a call on a task of its own and evaluates to a future of its result. f and x are evaluated before the
+ task starts, anything other than a call is a function the task calls with no arguments
+ */
+type SpawnExpression struct {
+	Token token.Token // spawn
+	Task  Expression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) String() string       { return "spawn " + se.Task.String() }
+
+/*
+ await future waits for a spawned task to finish and evaluates to its result
+ */
+type AwaitExpression struct {
+	Token  token.Token // await
+	Future Expression
+}
+
+func (ae *AwaitExpression) expressionNode()      {}
+func (ae *AwaitExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AwaitExpression) String() string       { return "await " + ae.Future.String() }
+
 type BlockStatement struct {
 	Token 	   token.Token
 	Statements []Statement
@@ -220,10 +391,24 @@ func (bs *BlockStatement) String() string 		{
 	return out.String()
 }
 
+/*
+ The names a function call or match arm binds, in slot order. Environments created for the scope get one slot per name
+ */
+type Scope struct {
+	Names []string
+}
+
 type FunctionLiteral struct {
 	Token 		token.Token // fn
 	Parameters  []*Identifier
+	Patterns    []Pattern // nil unless a parameter is destructured or has a default, then one per parameter
+	Types       []TypeExpression // nil unless a parameter is annotated, then one per parameter, nil if not annotated
+	ReturnType  TypeExpression   // Optional annotation after ->
 	Body 		*BlockStatement
+	Scope       *Scope    // Filled in by the resolver
+	Name        string    // What the function is bound to, ex. by a let or as a method of a struct. "" if anonymous
+	Generator   bool      // The body yields, so calling the function returns an iterator instead of running it
+	Source      string    // The literal as it was written, which unlike String can be parsed again
 }
 
 func (fl *FunctionLiteral) expressionNode() 	  {}
@@ -232,19 +417,43 @@ func (fl *FunctionLiteral) String() string		  {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	for i := range fl.Parameters {
+		params = append(params, fl.parameterString(i))
 	}
 
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
+	if fl.ReturnType != nil { out.WriteString("-> " + fl.ReturnType.String() + " ") }
 	out.WriteString(fl.Body.String())
 
 	return out.String()
 }
 
+/*
+ A parameter with its annotation, which goes before any default, ex. b: int = 5
+ */
+func (fl *FunctionLiteral) parameterString(index int) string {
+	param := ParameterString(fl.Parameters[index], fl.Patterns, index)
+	if fl.Types == nil || fl.Types[index] == nil { return param }
+
+	annotation := ": " + fl.Types[index].String()
+	if fl.Patterns == nil { return param + annotation }
+	if withDefault, ok := fl.Patterns[index].(*DefaultPattern); ok {
+		return withDefault.Pattern.String() + annotation + " = " + withDefault.Default.String()
+	}
+	return param + annotation
+}
+
+/*
+ Parameters with a pattern print as the pattern, the rest as their name
+ */
+func ParameterString(param *Identifier, patterns []Pattern, index int) string {
+	if patterns != nil && patterns[index] != nil { return patterns[index].String() }
+	return param.String()
+}
+
 type CallExpression struct {
 	Token	  token.Token // '('
 	Function  Expression // Identifier
@@ -309,9 +518,43 @@ func (ie *IndexExpression) String() string		 {
 	return out.String()
 }
 
+type MemberExpression struct {
+	Token    token.Token // .
+	Object   Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string       { return "(" + me.Object.String() + "." + me.Property.String() + ")" }
+
+type SliceExpression struct {
+	Token token.Token // [
+	Left  Expression // Array or string being sliced
+	Start Expression // nil when omitted, ex. s[:2]
+	End   Expression // nil when omitted, ex. s[2:]
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string		 {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil { out.WriteString(se.Start.String()) }
+	out.WriteString(":")
+	if se.End != nil { out.WriteString(se.End.String()) }
+	out.WriteString("])")
+
+	return out.String()
+}
+
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	Keys  []Expression // Keys of Pairs in the order they appear in the source
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -320,8 +563,8 @@ func (hl *HashLiteral) String() string 		 {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -0,0 +1,120 @@
+package ast
+
+import (
+	"bytes"
+	"mockc/token"
+	"strings"
+)
+
+// Patterns describe the shape of a value and the names to bind its parts to, ex. [head, ...tail] or {"name": n}
+
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+type WildcardPattern struct {
+	Token token.Token // _
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) String() string       { return "_" }
+
+type BindingPattern struct { // Matches anything and binds it to Name
+	Name *Identifier
+}
+
+func (bp *BindingPattern) patternNode()         {}
+func (bp *BindingPattern) TokenLiteral() string { return bp.Name.TokenLiteral() }
+func (bp *BindingPattern) String() string       { return bp.Name.String() }
+
+type DefaultPattern struct { // Used when there's no value to match, ex. a missing argument, element or key
+	Pattern Pattern
+	Default Expression
+}
+
+func (dp *DefaultPattern) patternNode()         {}
+func (dp *DefaultPattern) TokenLiteral() string { return dp.Pattern.TokenLiteral() }
+func (dp *DefaultPattern) String() string       { return dp.Pattern.String() + " = " + dp.Default.String() }
+
+type LiteralPattern struct { // Matches values equal to an integer, string or boolean literal
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Value.TokenLiteral() }
+func (lp *LiteralPattern) String() string       {
+	if str, ok := lp.Value.(*StringLiteral); ok { return `"` + str.Value + `"` } // Keep strings apart from bindings
+	return lp.Value.String()
+}
+
+type ArrayPattern struct {
+	Token    token.Token // [
+	Elements []Pattern
+	Rest     Pattern // Binds the elements after Elements as an array, nil if the array must match exactly
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string       {
+	elements := []string{}
+	for _, element := range ap.Elements { elements = append(elements, element.String()) }
+	if ap.Rest != nil { elements = append(elements, "..." + ap.Rest.String()) }
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+type HashPattern struct { // Matches hashes, or structs by field name, that have every key. Other keys are ignored
+	Token  token.Token // {
+	Keys   []Expression
+	Values []Pattern // Pattern for the value at the key with the same index
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string       {
+	pairs := []string{}
+	for i, key := range hp.Keys {
+		keyPattern := &LiteralPattern{Value: key}
+		pairs = append(pairs, keyPattern.String() + ": " + hp.Values[i].String())
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+type MatchExpression struct {
+	Token   token.Token // match
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression // Optional, the arm only applies if the guard is truthy
+	Body    Node       // An expression, or a block statement when the arm starts with {
+	Scope   *Scope     // Filled in by the resolver
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string       {
+	var out bytes.Buffer
+
+	out.WriteString("match (" + me.Subject.String() + ") { ")
+	for i, arm := range me.Arms {
+		if i > 0 { out.WriteString(", ") }
+
+		out.WriteString(arm.Pattern.String())
+		if arm.Guard != nil { out.WriteString(" if " + arm.Guard.String()) }
+		out.WriteString(" => ")
+		if block, ok := arm.Body.(*BlockStatement); ok {
+			out.WriteString("{ " + block.String() + " }")
+		} else {
+			out.WriteString(arm.Body.String())
+		}
+	}
+	out.WriteString(" }")
+
+	return out.String()
+}
@@ -0,0 +1,59 @@
+package ast
+
+import (
+	"mockc/token"
+	"strings"
+)
+
+// Type annotations, ex. the int in let x: int = 5 or the [int] and bool in fn(xs: [int]) -> bool. The evaluator
+// ignores them, they're only read by the type checker
+
+type TypeExpression interface {
+	Node
+	typeNode()
+}
+
+type NamedType struct { // int, string, bool, null, any or the name of a struct
+	Token token.Token
+	Name  string
+}
+
+func (nt *NamedType) typeNode()            {}
+func (nt *NamedType) TokenLiteral() string { return nt.Token.Literal }
+func (nt *NamedType) String() string       { return nt.Name }
+
+type ArrayType struct { // [int]
+	Token   token.Token // [
+	Element TypeExpression
+}
+
+func (at *ArrayType) typeNode()            {}
+func (at *ArrayType) TokenLiteral() string { return at.Token.Literal }
+func (at *ArrayType) String() string       { return "[" + at.Element.String() + "]" }
+
+type HashType struct { // {string: int}
+	Token token.Token // {
+	Key   TypeExpression
+	Value TypeExpression
+}
+
+func (ht *HashType) typeNode()            {}
+func (ht *HashType) TokenLiteral() string { return ht.Token.Literal }
+func (ht *HashType) String() string       { return "{" + ht.Key.String() + ": " + ht.Value.String() + "}" }
+
+type FunctionType struct { // fn(int, string) -> bool
+	Token      token.Token // fn
+	Parameters []TypeExpression
+	Return     TypeExpression // nil when left out, the function may return anything
+}
+
+func (ft *FunctionType) typeNode()            {}
+func (ft *FunctionType) TokenLiteral() string { return ft.Token.Literal }
+func (ft *FunctionType) String() string       {
+	params := []string{}
+	for _, param := range ft.Parameters { params = append(params, param.String()) }
+
+	out := "fn(" + strings.Join(params, ", ") + ")"
+	if ft.Return != nil { out += " -> " + ft.Return.String() }
+	return out
+}
@@ -0,0 +1,142 @@
+package ast
+
+/*
+ Visit node and everything under it in source order, depth first. Children are skipped when f returns false
+ Field, method and struct field names aren't visited, only the expressions, statements and patterns around them
+ */
+func Inspect(node Node, f func(Node) bool) {
+	if isNil(node) || !f(node) { return }
+
+	switch node := node.(type) {
+	case *Program:
+		for _, stmt := range node.Statements { Inspect(stmt, f) }
+
+	case *LetStatement:
+		if node.Pattern != nil {
+			Inspect(node.Pattern, f)
+		} else {
+			Inspect(node.Name, f)
+		}
+		Inspect(node.Value, f)
+
+	case *StructStatement:
+		Inspect(node.Name, f)
+
+	case *ImplStatement:
+		Inspect(node.Name, f)
+		for _, method := range node.Methods { Inspect(method.Value, f) }
+
+	case *ReturnStatement:
+		Inspect(node.ReturnValue, f)
+
+	case *ExpressionStatement:
+		Inspect(node.Expression, f)
+
+	case *BlockStatement:
+		for _, stmt := range node.Statements { Inspect(stmt, f) }
+
+	case *PrefixExpression:
+		Inspect(node.Right, f)
+
+	case *InfixExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Right, f)
+
+	case *IfExpression:
+		Inspect(node.Condition, f)
+		Inspect(node.Consequence, f)
+		Inspect(node.Alternative, f)
+
+	case *FunctionLiteral:
+		for i, param := range node.Parameters {
+			if node.Patterns != nil && node.Patterns[i] != nil {
+				Inspect(node.Patterns[i], f)
+			} else {
+				Inspect(param, f)
+			}
+		}
+		Inspect(node.Body, f)
+
+	case *CallExpression:
+		Inspect(node.Function, f)
+		for _, arg := range node.Arguments { Inspect(arg, f) }
+
+	case *Array:
+		for _, element := range node.Elements { Inspect(element, f) }
+
+	case *IndexExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Index, f)
+
+	case *SliceExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Start, f)
+		Inspect(node.End, f)
+
+	case *MemberExpression:
+		Inspect(node.Object, f)
+
+	case *HashLiteral:
+		for _, key := range node.Keys {
+			Inspect(key, f)
+			Inspect(node.Pairs[key], f)
+		}
+
+	case *MatchExpression:
+		Inspect(node.Subject, f)
+		for _, arm := range node.Arms {
+			Inspect(arm.Pattern, f)
+			Inspect(arm.Guard, f)
+			Inspect(arm.Body, f)
+		}
+
+	case *ForExpression:
+		Inspect(node.Pattern, f)
+		Inspect(node.Iterable, f)
+		Inspect(node.Body, f)
+
+	case *YieldExpression:
+		Inspect(node.Value, f)
+
+	case *SpawnExpression:
+		Inspect(node.Task, f)
+
+	case *AwaitExpression:
+		Inspect(node.Future, f)
+
+	case *BindingPattern:
+		Inspect(node.Name, f)
+
+	case *DefaultPattern:
+		Inspect(node.Pattern, f)
+		Inspect(node.Default, f)
+
+	case *LiteralPattern:
+		Inspect(node.Value, f)
+
+	case *ArrayPattern:
+		for _, element := range node.Elements { Inspect(element, f) }
+		Inspect(node.Rest, f)
+
+	case *HashPattern:
+		for i, key := range node.Keys {
+			Inspect(key, f)
+			Inspect(node.Values[i], f)
+		}
+	}
+}
+
+/*
+ Optional children are typed nil pointers, ex. an if without an else, which aren't nil as a Node
+ */
+func isNil(node Node) bool {
+	switch node := node.(type) {
+	case nil:
+		return true
+	case *BlockStatement:
+		return node == nil
+	case *Identifier:
+		return node == nil
+	}
+	return false
+}
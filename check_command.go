@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"mockc/checker"
+	"mockc/lexer"
+	"mockc/parser"
+	"os"
+)
+
+/*
+ mockc check files...
+ Type checks Moxie programs without running them and prints every error with its position, ex. fib.mx:3:9: message.
+ Returns 0 when every file checks, 1 when any has errors and 2 for bad usage or unreadable files
+ */
+func checkCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: mockc check files...")
+		return 2
+	}
+
+	status := 0
+	for _, path := range args {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+
+		p := parser.New(lexer.New(string(source)))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 { // Parser errors don't have positions yet
+			for _, msg := range p.Errors() { fmt.Printf("%s: %s\n", path, msg) }
+			status = 1
+			continue
+		}
+
+		for _, err := range checker.Check(program) {
+			fmt.Printf("%s:%s\n", path, err)
+			status = 1
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,226 @@
+package checker
+
+import "mockc/object"
+
+// Signatures of the builtins. Builtins that take more than one kind of value, ex. len of an array, string or hash,
+// or map of an array or iterator, take any. Builtins that pass their input through, like filter or first, also have
+// a refinement that works out the result from the types of the arguments, so filter of an [int] is an [int] rather
+// than an [any]
+
+var (
+	anyArray    = &Array{Element: ANY}
+	anyHash     = &Hash{Key: ANY, Value: ANY}
+	anyIterator = &Iterator{Element: ANY}
+	stringArray = &Array{Element: STRING}
+	unary       = fn([]Type{ANY}, ANY)      // Callbacks of map, filter and the like
+	binary      = fn([]Type{ANY, ANY}, ANY) // Callbacks of reduce
+)
+
+/*
+ A builtin returning ret that takes params, of which only the first required have to be passed
+ */
+func signature(ret Type, required int, params ...Type) *Function {
+	return &Function{Params: params, Required: required, Return: ret}
+}
+
+/*
+ The same builtin taking any number of rest arguments after its parameters
+ */
+func variadic(f *Function, rest Type) *Function {
+	f.Variadic = rest
+	return f
+}
+
+var builtins = map[string]*Function{
+	"len":   signature(INT, 1, ANY),
+	"first": signature(ANY, 1, anyArray),
+	"last":  signature(ANY, 1, anyArray),
+	"rest":  signature(anyArray, 1, anyArray),
+	"push":  signature(anyArray, 2, anyArray, ANY),
+	"print": variadic(signature(STRING, 0), ANY),
+
+	"assert":       signature(NULL, 1, ANY, ANY),
+	"assert_eq":    signature(NULL, 2, ANY, ANY, ANY),
+	"assert_error": signature(STRING, 1, fn(nil, ANY), STRING),
+
+	"map":      signature(ANY, 2, ANY, unary),
+	"filter":   signature(ANY, 2, ANY, unary),
+	"reduce":   signature(ANY, 2, ANY, binary, ANY),
+	"each":     signature(NULL, 2, ANY, unary),
+	"sort":     signature(anyArray, 1, ANY, fn([]Type{ANY, ANY}, INT)),
+	"reverse":  signature(ANY, 1, ANY),
+	"zip":      variadic(signature(&Array{Element: anyArray}, 2, ANY, ANY), ANY),
+	"range":    signature(&Array{Element: INT}, 1, INT, INT, INT),
+	"contains": signature(BOOL, 2, ANY, ANY),
+	"index_of": signature(INT, 2, ANY, ANY),
+	"slice":    signature(anyArray, 2, anyArray, INT, INT),
+	"concat":   variadic(signature(anyArray, 0), ANY),
+	"flatten":  signature(anyArray, 1, anyArray, INT),
+	"unique":   signature(anyArray, 1, ANY),
+	"group_by": signature(&Hash{Key: ANY, Value: anyArray}, 2, ANY, unary),
+
+	"next":    signature(ANY, 1, anyIterator, ANY),
+	"iter":    signature(anyIterator, 1, ANY),
+	"collect": signature(anyArray, 1, ANY),
+	"take":    signature(ANY, 2, ANY, INT),
+	"count":   signature(&Iterator{Element: INT}, 0, INT, INT),
+
+	"channel": signature(CHANNEL, 0, INT),
+	"send":    signature(NULL, 2, CHANNEL, ANY),
+	"recv":    signature(ANY, 1, CHANNEL, ANY),
+	"close":   signature(NULL, 1, CHANNEL),
+	"select":  signature(anyArray, 1, anyArray, ANY),
+
+	"printf":  variadic(signature(STRING, 1, STRING), ANY),
+	"sprintf": variadic(signature(STRING, 1, STRING), ANY),
+	"eprint":  variadic(signature(STRING, 0), ANY),
+
+	"keys":         signature(anyArray, 1, anyHash),
+	"values":       signature(anyArray, 1, anyHash),
+	"entries":      signature(&Array{Element: anyArray}, 1, anyHash),
+	"has":          signature(BOOL, 2, anyHash, ANY),
+	"get":          signature(ANY, 2, anyHash, ANY, ANY),
+	"delete":       signature(anyHash, 2, anyHash, ANY),
+	"merge":        variadic(signature(anyHash, 1, anyHash), anyHash),
+	"map_values":   signature(anyHash, 2, anyHash, unary),
+	"from_entries": signature(anyHash, 1, &Array{Element: anyArray}),
+
+	"read_file":  signature(STRING, 1, STRING),
+	"write_file": signature(NULL, 2, STRING, STRING),
+	"list_dir":   signature(stringArray, 1, STRING),
+	"exists":     signature(BOOL, 1, STRING),
+	"getenv":     signature(ANY, 1, STRING, ANY),
+	"read_line":  signature(ANY, 0), // null at the end of the input
+	"exit":       signature(NULL, 1, INT),
+
+	"json_parse":     signature(ANY, 1, STRING),
+	"json_stringify": signature(STRING, 1, ANY, ANY),
+
+	"split":       signature(stringArray, 1, STRING, STRING),
+	"join":        signature(STRING, 1, stringArray, STRING),
+	"trim":        signature(STRING, 1, STRING, STRING),
+	"trim_left":   signature(STRING, 1, STRING, STRING),
+	"trim_right":  signature(STRING, 1, STRING, STRING),
+	"trim_prefix": signature(STRING, 2, STRING, STRING),
+	"trim_suffix": signature(STRING, 2, STRING, STRING),
+	"upper":       signature(STRING, 1, STRING),
+	"lower":       signature(STRING, 1, STRING),
+	"replace":     signature(STRING, 3, STRING, STRING, STRING, INT),
+	"starts_with": signature(BOOL, 2, STRING, STRING),
+	"ends_with":   signature(BOOL, 2, STRING, STRING),
+	"repeat":      signature(STRING, 2, STRING, INT),
+	"substring":   signature(STRING, 2, STRING, INT, INT),
+	"pad_left":    signature(STRING, 2, STRING, INT, STRING),
+	"pad_right":   signature(STRING, 2, STRING, INT, STRING),
+	"chars":       signature(stringArray, 1, STRING),
+}
+
+/*
+ The element type of t if it's an array or iterator, any otherwise
+ */
+func elementOf(t Type) Type {
+	switch t := t.(type) {
+	case *Array:
+		return t.Element
+	case *Iterator:
+		return t.Element
+	}
+	return ANY
+}
+
+/*
+ The type of what a for loop or iter() visits in a value of type t: elements, characters, keys or received values
+ ok is false if t can't be iterated over at all
+ */
+func iterationOf(t Type) (Type, bool) {
+	switch objectType(t) {
+	case "", object.ARRAY_OBJECT, object.ITERATOR_OBJECT:
+		return elementOf(t), true
+	case object.STRING_OBJECT:
+		return STRING, true
+	case object.HASH_OBJECT:
+		return keyOf(t), true
+	case object.CHANNEL_OBJECT:
+		return ANY, true
+	}
+	return ANY, false
+}
+
+/*
+ Builtins that read a whole iterator return an array of what it held, anything else passes through
+ */
+func collected(t Type) Type {
+	if iterator, ok := t.(*Iterator); ok { return &Array{Element: iterator.Element} }
+	return t
+}
+
+func returnOf(t Type) Type {
+	if function, ok := t.(*Function); ok { return function.Return }
+	return ANY
+}
+
+func keyOf(t Type) Type {
+	if hash, ok := t.(*Hash); ok { return hash.Key }
+	return ANY
+}
+
+func valueOf(t Type) Type {
+	if hash, ok := t.(*Hash); ok { return hash.Value }
+	return ANY
+}
+
+/*
+ Results of builtins that depend on their arguments. Only called once the arguments have been checked against the
+ signature, so there are at least as many as are required
+ */
+var refinements = map[string]func(args []Type) Type{
+	"first":   func(args []Type) Type { return elementOf(args[0]) },
+	"last":    func(args []Type) Type { return elementOf(args[0]) },
+	"rest":    func(args []Type) Type { return args[0] },
+	"push":    func(args []Type) Type { return &Array{Element: join(elementOf(args[0]), args[1])} },
+	"map": func(args []Type) Type {
+		if _, ok := args[0].(*Iterator); ok { return &Iterator{Element: returnOf(args[1])} }
+		return &Array{Element: returnOf(args[1])}
+	},
+	"filter":  func(args []Type) Type { return args[0] },
+	"sort":    func(args []Type) Type { return collected(args[0]) },
+	"reverse": func(args []Type) Type { return collected(args[0]) },
+	"slice":   func(args []Type) Type { return args[0] },
+	"unique":  func(args []Type) Type { return collected(args[0]) },
+	"concat": func(args []Type) Type {
+		if len(args) == 0 { return anyArray }
+		result := collected(args[0])
+		for _, arg := range args[1:] { result = join(result, collected(arg)) }
+		return result
+	},
+	"group_by": func(args []Type) Type {
+		return &Hash{Key: returnOf(args[1]), Value: collected(args[0])}
+	},
+	"next": func(args []Type) Type {
+		if len(args) == 2 { return join(elementOf(args[0]), args[1]) }
+		return ANY // null once the iterator is used up
+	},
+	"iter": func(args []Type) Type {
+		element, _ := iterationOf(args[0])
+		return &Iterator{Element: element}
+	},
+	"collect": func(args []Type) Type { return &Array{Element: elementOf(args[0])} },
+	"take":    func(args []Type) Type { return args[0] },
+	"select": func(args []Type) Type {
+		if len(args) == 2 { return join(anyArray, args[1]) }
+		return anyArray
+	},
+	"keys":       func(args []Type) Type { return &Array{Element: keyOf(args[0])} },
+	"values":     func(args []Type) Type { return &Array{Element: valueOf(args[0])} },
+	"delete":     func(args []Type) Type { return args[0] },
+	"map_values": func(args []Type) Type { return &Hash{Key: keyOf(args[0]), Value: returnOf(args[1])} },
+	"get": func(args []Type) Type {
+		if len(args) == 3 { return join(valueOf(args[0]), args[2]) }
+		return ANY // null for missing keys
+	},
+	"merge": func(args []Type) Type {
+		result := args[0]
+		for _, arg := range args[1:] { result = join(result, arg) }
+		return result
+	},
+}
@@ -0,0 +1,793 @@
+package checker
+
+import (
+	"fmt"
+	"mockc/ast"
+	"mockc/evaluator"
+	"mockc/object"
+	"mockc/token"
+	"sort"
+)
+
+// The checker infers a type for every expression of a program without running it, and reports operations that would
+// fail whatever values they ran with, ex. "a" - 1, along with values that don't match their annotations. Names
+// without an annotation take the type of the value they're bound to, parameters without one are any
+
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e Error) String() string { return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message) }
+
+// Returned by statements that never finish, like return, so the branch of an if that returns doesn't widen the type
+// of the if. Anything can be used as never
+const never Basic = "never"
+
+type scope struct {
+	names map[string]Type
+	outer *scope
+}
+
+/*
+ The function whose body is being checked
+ */
+type function struct {
+	declared Type   // Annotated return type, nil if the function doesn't have one or is a generator
+	returns  []Type // Types of its return statements
+	yields   Type   // Types of the values it yields, joined
+}
+
+type checker struct {
+	errors      []Error
+	scope       *scope
+	function    *function // nil at the top level
+	structs     map[string]*Struct // By name, for annotations
+	definitions map[*ast.StructStatement]*Struct
+	annotations map[ast.TypeExpression]Type // Resolved annotations, so each is only reported once
+}
+
+/*
+ Check program and return its type errors in source order
+ */
+func Check(program *ast.Program) []Error {
+	c := newChecker()
+	c.declareGlobals(program)
+	for _, stmt := range program.Statements { c.checkStatement(stmt) }
+
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		if c.errors[i].Line != c.errors[j].Line { return c.errors[i].Line < c.errors[j].Line }
+		return c.errors[i].Column < c.errors[j].Column
+	})
+	return c.errors
+}
+
+func newChecker() *checker {
+	return &checker{
+		scope:       &scope{names: map[string]Type{}},
+		structs:     map[string]*Struct{},
+		definitions: map[*ast.StructStatement]*Struct{},
+		annotations: map[ast.TypeExpression]Type{},
+	}
+}
+
+func (c *checker) errorf(tok token.Token, format string, a ...interface{}) {
+	c.errors = append(c.errors, Error{Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, a...)})
+}
+
+/*
+ Globals are looked up when they're used rather than when they're defined, so a function can call one defined after
+ it. Every global is declared before checking starts, functions with their signature and the rest as any until their
+ let is reached
+ */
+func (c *checker) declareGlobals(program *ast.Program) {
+	for _, stmt := range program.Statements {
+		if stmt, ok := stmt.(*ast.StructStatement); ok { c.declareStruct(stmt) }
+	}
+
+	for _, stmt := range program.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			if stmt.Pattern != nil {
+				c.bindPattern(stmt.Pattern, ANY, false)
+			} else {
+				c.declare(stmt.Name.Value, c.declaredType(stmt))
+			}
+
+		case *ast.ImplStatement:
+			definition, ok := c.structs[stmt.Name.Value]
+			if !ok { continue }
+			for _, method := range stmt.Methods {
+				if literal, ok := method.Value.(*ast.FunctionLiteral); ok {
+					definition.Methods[method.Name.Value] = c.signature(literal, &Instance{Struct: definition})
+				}
+			}
+		}
+	}
+}
+
+/*
+ The type a let gives its name before its value has been checked: the annotation, or the signature of a function
+ */
+func (c *checker) declaredType(stmt *ast.LetStatement) Type {
+	if stmt.Type != nil { return c.resolve(stmt.Type) }
+	if literal, ok := stmt.Value.(*ast.FunctionLiteral); ok { return c.signature(literal, nil) }
+	return ANY
+}
+
+func (c *checker) declareStruct(stmt *ast.StructStatement) *Struct {
+	definition, ok := c.definitions[stmt]
+	if !ok {
+		definition = &Struct{Name: stmt.Name.Value, Methods: map[string]Type{}}
+		for _, field := range stmt.Fields { definition.Fields = append(definition.Fields, field.Value) }
+		c.definitions[stmt] = definition
+		c.structs[definition.Name] = definition
+	}
+	c.declare(definition.Name, definition)
+
+	return definition
+}
+
+func (c *checker) declare(name string, t Type) {
+	c.scope.names[name] = t
+}
+
+func (c *checker) lookup(name string) (Type, bool) {
+	for s := c.scope; s != nil; s = s.outer {
+		if t, ok := s.names[name]; ok { return t, true }
+	}
+	if builtin, ok := builtins[name]; ok { return builtin, true }
+
+	return nil, false
+}
+
+func (c *checker) pushScope() {
+	c.scope = &scope{names: map[string]Type{}, outer: c.scope}
+}
+
+func (c *checker) popScope() {
+	c.scope = c.scope.outer
+}
+
+/*
+ The type an annotation stands for
+ */
+func (c *checker) resolve(annotation ast.TypeExpression) Type {
+	if t, ok := c.annotations[annotation]; ok { return t }
+
+	var t Type = ANY
+	switch annotation := annotation.(type) {
+	case *ast.NamedType:
+		switch annotation.Name {
+		case "int", "string", "bool", "null", "any", "channel":
+			t = Basic(annotation.Name)
+		case "iterator":
+			t = anyIterator
+		case "future":
+			t = &Future{Result: ANY}
+		default:
+			if definition, ok := c.structs[annotation.Name]; ok {
+				t = &Instance{Struct: definition}
+			} else {
+				c.errorf(annotation.Token, "Unknown type %s", annotation.Name)
+			}
+		}
+
+	case *ast.ArrayType:
+		t = &Array{Element: c.resolve(annotation.Element)}
+
+	case *ast.HashType:
+		key := c.resolve(annotation.Key)
+		if !hashable(key) { c.errorf(annotation.Token, "Type %s is not hashable", key) }
+		t = &Hash{Key: key, Value: c.resolve(annotation.Value)}
+
+	case *ast.FunctionType:
+		params := []Type{}
+		for _, param := range annotation.Parameters { params = append(params, c.resolve(param)) }
+		var ret Type = ANY
+		if annotation.Return != nil { ret = c.resolve(annotation.Return) }
+		t = fn(params, ret)
+	}
+
+	c.annotations[annotation] = t
+	return t
+}
+
+/*
+ The type of a function literal from its annotations alone, returning any unless it says otherwise. The first
+ parameter of a method is its receiver
+ */
+func (c *checker) signature(literal *ast.FunctionLiteral, receiver Type) *Function {
+	f := &Function{IgnoresExtra: true, Return: ANY}
+
+	for i := range literal.Parameters {
+		var t Type = ANY
+		if literal.Types != nil && literal.Types[i] != nil {
+			t = c.resolve(literal.Types[i])
+		} else if i == 0 && receiver != nil {
+			t = receiver
+		}
+		f.Params = append(f.Params, t)
+
+		if literal.Patterns == nil || literal.Patterns[i] == nil {
+			f.Required = i + 1
+		} else if _, ok := literal.Patterns[i].(*ast.DefaultPattern); !ok {
+			f.Required = i + 1
+		}
+	}
+	if literal.ReturnType != nil { f.Return = c.resolve(literal.ReturnType) }
+
+	return f
+}
+
+/*
+ Check a statement and return the type of the value it leaves, which is the value of a block ending with it
+ */
+func (c *checker) checkStatement(stmt ast.Statement) Type {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		c.checkLet(stmt)
+
+	case *ast.ReturnStatement:
+		var t Type = NULL
+		if stmt.ReturnValue != nil { t = c.checkExpression(stmt.ReturnValue) }
+		if c.function != nil {
+			c.function.returns = append(c.function.returns, t)
+			if declared := c.function.declared; declared != nil && !assignable(t, declared) {
+				c.errorf(stmt.Token, "Cannot use %s as %s in return", t, declared)
+			}
+		}
+		return never
+
+	case *ast.ExpressionStatement:
+		if stmt.Expression == nil { return NULL }
+		return c.checkExpression(stmt.Expression)
+
+	case *ast.StructStatement:
+		c.declareStruct(stmt)
+
+	case *ast.ImplStatement:
+		c.checkImpl(stmt)
+
+	case *ast.BlockStatement:
+		return c.checkBlock(stmt)
+	}
+
+	return NULL
+}
+
+/*
+ Blocks share the scope of the function they're in, like they do when the program runs
+ */
+func (c *checker) checkBlock(block *ast.BlockStatement) Type {
+	var result Type = NULL
+	for _, stmt := range block.Statements { result = c.checkStatement(stmt) }
+
+	return result
+}
+
+func (c *checker) checkLet(stmt *ast.LetStatement) {
+	var declared Type
+	if stmt.Type != nil { declared = c.resolve(stmt.Type) }
+
+	if stmt.Name != nil && c.function != nil { c.declare(stmt.Name.Value, c.declaredType(stmt)) } // For recursion
+	value := c.checkExpression(stmt.Value)
+
+	what := "let "
+	if stmt.Name != nil { what += stmt.Name.Value } else { what += stmt.Pattern.String() }
+	if declared != nil && !assignable(value, declared) {
+		c.errorf(ast.ExpressionToken(stmt.Value), "Cannot use %s as %s in %s", value, declared, what)
+	}
+	if declared == nil { declared = value }
+
+	if stmt.Pattern != nil {
+		c.bindPattern(stmt.Pattern, declared, true)
+	} else {
+		c.declare(stmt.Name.Value, declared)
+	}
+}
+
+func (c *checker) checkImpl(stmt *ast.ImplStatement) {
+	t, ok := c.lookup(stmt.Name.Value)
+	if !ok {
+		c.errorf(stmt.Name.Token, "Identifier not found: %s", stmt.Name.Value)
+		return
+	}
+
+	definition, ok := t.(*Struct)
+	if !ok {
+		if t != ANY { c.errorf(stmt.Name.Token, "Methods can only be added to struct types, got %s", t) }
+		return
+	}
+
+	for _, method := range stmt.Methods {
+		var methodType Type
+		if literal, ok := method.Value.(*ast.FunctionLiteral); ok {
+			methodType = c.checkFunction(literal, &Instance{Struct: definition})
+		} else {
+			methodType = c.checkExpression(method.Value)
+		}
+		definition.Methods[method.Name.Value] = methodType
+	}
+}
+
+/*
+ Declare the names a pattern binds to the parts of a value of type t. Patterns that can't match t are only reported
+ when strict, a match arm that doesn't fit just doesn't match
+ */
+func (c *checker) bindPattern(pattern ast.Pattern, t Type, strict bool) {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		c.declare(pattern.Name.Value, t)
+
+	case *ast.DefaultPattern: // Either the value or the default, which only has to match an annotation, see checkFunction
+		c.bindPattern(pattern.Pattern, join(t, c.checkExpression(pattern.Default)), strict)
+
+	case *ast.ArrayPattern:
+		if strict && !c.canDestructure(t, object.ARRAY_OBJECT) {
+			c.errorf(pattern.Token, "Cannot destructure %s with %s", t, pattern)
+		}
+		element := elementOf(t)
+		for _, p := range pattern.Elements { c.bindPattern(p, element, strict) }
+		if pattern.Rest != nil { c.bindPattern(pattern.Rest, &Array{Element: element}, strict) }
+
+	case *ast.HashPattern:
+		if strict && !c.canDestructure(t, object.HASH_OBJECT) && !c.canDestructure(t, object.STRUCT_OBJECT) {
+			c.errorf(pattern.Token, "Cannot destructure %s with %s", t, pattern)
+		}
+		for _, p := range pattern.Values { c.bindPattern(p, valueOf(t), strict) }
+	}
+}
+
+func (c *checker) canDestructure(t Type, kind object.ObjectType) bool {
+	actual := objectType(t)
+	return actual == "" || actual == kind
+}
+
+/*
+ Check the body of a function literal and return its type, with the return type inferred from the body unless it's
+ annotated
+ */
+func (c *checker) checkFunction(literal *ast.FunctionLiteral, receiver Type) Type {
+	signature := c.signature(literal, receiver)
+
+	outer := c.function
+	c.function = &function{yields: never}
+	if literal.ReturnType != nil && !literal.Generator { c.function.declared = signature.Return }
+	c.pushScope()
+	defer func() {
+		c.popScope()
+		c.function = outer
+	}()
+
+	for i, param := range literal.Parameters {
+		t := signature.Params[i]
+		var pattern ast.Pattern
+		if literal.Patterns != nil { pattern = literal.Patterns[i] }
+
+		if withDefault, ok := pattern.(*ast.DefaultPattern); ok && literal.Types != nil && literal.Types[i] != nil {
+			value := c.checkExpression(withDefault.Default)
+			if !assignable(value, t) {
+				c.errorf(ast.ExpressionToken(withDefault.Default), "Cannot use %s as %s in default of %s", value, t, withDefault.Pattern)
+			}
+			c.bindPattern(withDefault.Pattern, t, true)
+		} else if pattern != nil {
+			c.bindPattern(pattern, t, true)
+		} else {
+			c.declare(param.Value, t)
+		}
+	}
+
+	body := c.checkBlock(literal.Body) // The value of the body is returned too
+	if literal.Generator { return c.generator(literal, signature) }
+	if declared := c.function.declared; declared != nil {
+		if !assignable(body, declared) { c.errorf(c.lastPosition(literal), "Cannot use %s as %s in return", body, declared) }
+		return signature
+	}
+
+	var result Type = never
+	for _, t := range append(c.function.returns, body) { result = join(result, t) }
+	if result == never { result = ANY }
+	signature.Return = result
+
+	return signature
+}
+
+/*
+ Calling a generator returns an iterator of what it yields, whatever its body returns
+ */
+func (c *checker) generator(literal *ast.FunctionLiteral, signature *Function) Type {
+	element := c.function.yields
+	if element == never { element = ANY }
+	result := &Iterator{Element: element}
+
+	if literal.ReturnType != nil {
+		if !assignable(result, signature.Return) {
+			c.errorf(literal.Token, "Cannot use %s as %s in return", result, signature.Return)
+		}
+		return signature
+	}
+
+	signature.Return = result
+	return signature
+}
+
+/*
+ Where the value of a function's body comes from, its last statement
+ */
+func (c *checker) lastPosition(literal *ast.FunctionLiteral) token.Token {
+	statements := literal.Body.Statements
+	if len(statements) == 0 { return literal.Token }
+
+	last := statements[len(statements)-1]
+	if stmt, ok := last.(*ast.ExpressionStatement); ok && stmt.Expression != nil { return ast.ExpressionToken(stmt.Expression) }
+	return ast.StatementToken(last)
+}
+
+func (c *checker) checkExpression(exp ast.Expression) Type {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return INT
+	case *ast.StringLiteral:
+		return STRING
+	case *ast.Boolean:
+		return BOOL
+
+	case *ast.Identifier:
+		if t, ok := c.lookup(exp.Value); ok { return t }
+		c.errorf(exp.Token, "Identifier not found: %s", exp.Value)
+		return ANY
+
+	case *ast.PrefixExpression:
+		return c.checkPrefix(exp)
+
+	case *ast.InfixExpression:
+		return c.checkInfix(exp)
+
+	case *ast.IfExpression:
+		c.checkExpression(exp.Condition)
+		var alternative Type = NULL
+		consequence := c.checkBlock(exp.Consequence)
+		if exp.Alternative != nil { alternative = c.checkBlock(exp.Alternative) }
+		return join(consequence, alternative)
+
+	case *ast.FunctionLiteral:
+		return c.checkFunction(exp, nil)
+
+	case *ast.CallExpression:
+		return c.checkCall(exp)
+
+	case *ast.Array:
+		var element Type = never
+		for _, e := range exp.Elements { element = join(element, c.checkExpression(e)) }
+		if element == never { element = ANY }
+		return &Array{Element: element}
+
+	case *ast.HashLiteral:
+		var key, value Type = never, never
+		for _, k := range exp.Keys {
+			keyType := c.checkExpression(k)
+			if !hashable(keyType) { c.errorf(ast.ExpressionToken(k), "Type %s is not hashable", keyType) }
+			key = join(key, keyType)
+			value = join(value, c.checkExpression(exp.Pairs[k]))
+		}
+		if key == never { key, value = ANY, ANY }
+		return &Hash{Key: key, Value: value}
+
+	case *ast.IndexExpression:
+		return c.checkIndex(exp)
+
+	case *ast.SliceExpression:
+		return c.checkSlice(exp)
+
+	case *ast.MemberExpression:
+		return c.checkMember(exp)
+
+	case *ast.MatchExpression:
+		return c.checkMatch(exp)
+
+	case *ast.ForExpression:
+		return c.checkFor(exp)
+
+	case *ast.YieldExpression:
+		t := c.checkExpression(exp.Value)
+		if c.function != nil { c.function.yields = join(c.function.yields, t) }
+		return NULL
+
+	case *ast.SpawnExpression:
+		return c.checkSpawn(exp)
+
+	case *ast.AwaitExpression:
+		future := c.checkExpression(exp.Future)
+		if future, ok := future.(*Future); ok { return future.Result }
+		if future != ANY { c.errorf(ast.ExpressionToken(exp.Future), "Cannot await %s", future) }
+		return ANY
+	}
+
+	return ANY
+}
+
+func (c *checker) checkPrefix(exp *ast.PrefixExpression) Type {
+	right := c.checkExpression(exp.Right)
+
+	switch exp.Operator {
+	case "!":
+		return BOOL
+	case "-":
+		if right != INT && objectType(right) != "" {
+			c.errorf(exp.Token, "Unsupported negative operand: %s", right)
+			return ANY
+		}
+		return INT
+	}
+
+	return ANY
+}
+
+func isOrderingOperator(operator string) bool {
+	return operator == "<" || operator == ">" || operator == "<=" || operator == ">="
+}
+
+/*
+ Whether values of type t support operator. Integers do arithmetic, strings +, and both of them and arrays ordering
+ */
+func supports(t Type, operator string) bool {
+	if isOrderingOperator(operator) { return t == INT || t == STRING || objectType(t) == object.ARRAY_OBJECT }
+	return t == INT || (t == STRING && operator == "+")
+}
+
+func (c *checker) checkInfix(exp *ast.InfixExpression) Type {
+	left := c.checkExpression(exp.Left)
+	right := c.checkExpression(exp.Right)
+	leftKind, rightKind := objectType(left), objectType(right)
+	op := exp.Operator
+
+	if op == "==" || op == "!=" { // Anything can be compared to null
+		if leftKind != "" && rightKind != "" && leftKind != rightKind && left != NULL && right != NULL {
+			c.errorf(exp.Token, "Operand type mismatch: %s %s %s", left, op, right)
+		}
+		return BOOL
+	}
+
+	if leftKind != "" && rightKind != "" && leftKind != rightKind {
+		c.errorf(exp.Token, "Operand type mismatch: %s %s %s", left, op, right)
+		return ANY
+	}
+
+	known := left // The side whose type is known, if either is
+	if leftKind == "" { known = right }
+	if objectType(known) != "" && !supports(known, op) {
+		if known == STRING && leftKind == rightKind {
+			c.errorf(exp.Token, "Unknown string operator: %s %s %s", left, op, right)
+		} else {
+			c.errorf(exp.Token, "Unknown infix operator: %s %s %s", left, op, right)
+		}
+		return ANY
+	}
+
+	switch {
+	case isOrderingOperator(op):
+		return BOOL
+	case known == INT || known == STRING:
+		return known
+	}
+	return ANY
+}
+
+func (c *checker) checkCall(exp *ast.CallExpression) Type {
+	if member, ok := exp.Function.(*ast.MemberExpression); ok { return c.checkMethodCall(exp, member) }
+
+	callee := c.checkExpression(exp.Function)
+	args := c.checkExpressions(exp.Arguments)
+
+	name := "function"
+	if identifier, ok := exp.Function.(*ast.Identifier); ok { name = identifier.Value }
+
+	return c.call(callee, name, args, exp.Arguments, false, ast.ExpressionToken(exp.Function))
+}
+
+func (c *checker) checkExpressions(exps []ast.Expression) []Type {
+	types := []Type{}
+	for _, e := range exps { types = append(types, c.checkExpression(e)) }
+
+	return types
+}
+
+/*
+ Check receiver.method(args). Struct fields holding functions are called without the receiver, struct methods and the
+ builtins behind the methods of strings, arrays and hashes get it as their first argument
+ */
+func (c *checker) checkMethodCall(exp *ast.CallExpression, member *ast.MemberExpression) Type {
+	receiver := c.checkExpression(member.Object)
+	args := c.checkExpressions(exp.Arguments)
+	name := member.Property.Value
+	withReceiver := append([]Type{receiver}, args...)
+	nodes := append([]ast.Expression{member.Object}, exp.Arguments...)
+
+	switch r := receiver.(type) {
+	case *Instance:
+		if r.Struct.hasField(name) { return ANY }
+		if method, ok := r.Struct.Methods[name]; ok { return c.call(method, name, withReceiver, nodes, true, member.Property.Token) }
+
+		c.errorf(member.Property.Token, "Unknown method %s on %s", name, r)
+		return ANY
+	}
+
+	kind := objectType(receiver)
+	if kind == "" { return ANY }
+	builtin, ok := evaluator.MethodBuiltin(kind, name)
+	if !ok {
+		c.errorf(member.Property.Token, "Unknown method %s for %s", name, receiver)
+		return ANY
+	}
+
+	return c.call(builtins[builtin], builtin, withReceiver, nodes, true, member.Property.Token)
+}
+
+/*
+ Check a call of callee, named name for errors, and return its result. The receiver of a method call is the first of
+ args and nodes
+ */
+func (c *checker) call(callee Type, name string, args []Type, nodes []ast.Expression, method bool, tok token.Token) Type {
+	switch f := callee.(type) {
+	case *Function:
+		if !c.checkArguments(f, name, args, nodes, method, tok) { return f.Return }
+		if refine, ok := refinements[name]; ok && f == builtins[name] { return refine(args) }
+		return f.Return
+
+	case *Struct:
+		if len(args) != len(f.Fields) {
+			c.errorf(tok, "Wrong number of arguments to %s. got=%d, want=%d", f.Name, len(args), len(f.Fields))
+		}
+		return &Instance{Struct: f}
+	}
+
+	if objectType(callee) != "" { c.errorf(tok, "Not a function: %s", callee) }
+	return ANY
+}
+
+/*
+ Report the arguments that don't fit f, ok is false if there's the wrong number of them
+ */
+func (c *checker) checkArguments(f *Function, name string, args []Type, nodes []ast.Expression, method bool, tok token.Token) bool {
+	if len(args) < f.Required || (len(args) > len(f.Params) && f.Variadic == nil && !f.IgnoresExtra) {
+		c.errorf(tok, "Wrong number of arguments to %s. got=%d, want=%s", name, len(args), wantArguments(f))
+		return false
+	}
+
+	for i, arg := range args {
+		param := f.Variadic
+		if i < len(f.Params) { param = f.Params[i] }
+		if param == nil || assignable(arg, param) { continue }
+
+		what := fmt.Sprintf("argument %d to %s", i+1, name)
+		if method && i == 0 {
+			what = "receiver of " + name
+		} else if method {
+			what = fmt.Sprintf("argument %d to %s", i, name)
+		}
+		c.errorf(ast.ExpressionToken(nodes[i]), "Cannot use %s as %s in %s", arg, param, what)
+	}
+
+	return true
+}
+
+func wantArguments(f *Function) string {
+	switch {
+	case f.Variadic != nil:
+		return fmt.Sprintf("%d or more", f.Required)
+	case f.Required == len(f.Params) || f.IgnoresExtra:
+		return fmt.Sprint(f.Required)
+	case f.Required+1 == len(f.Params):
+		return fmt.Sprintf("%d or %d", f.Required, len(f.Params))
+	}
+	return fmt.Sprintf("%d to %d", f.Required, len(f.Params))
+}
+
+func (c *checker) checkIndex(exp *ast.IndexExpression) Type {
+	left := c.checkExpression(exp.Left)
+	index := c.checkExpression(exp.Index)
+
+	switch objectType(left) {
+	case "":
+		return ANY
+	case object.ARRAY_OBJECT, object.STRING_OBJECT:
+		if !assignable(index, INT) { c.errorf(ast.ExpressionToken(exp.Index), "Cannot use %s as int in index", index) }
+		if left == STRING { return STRING }
+		return elementOf(left)
+	case object.HASH_OBJECT:
+		if !hashable(index) {
+			c.errorf(ast.ExpressionToken(exp.Index), "Type %s is not hashable", index)
+		} else if !assignable(index, keyOf(left)) {
+			c.errorf(ast.ExpressionToken(exp.Index), "Cannot use %s as %s in index", index, keyOf(left))
+		}
+		return valueOf(left)
+	}
+
+	c.errorf(exp.Token, "Index operator not supported: %s", left)
+	return ANY
+}
+
+func (c *checker) checkSlice(exp *ast.SliceExpression) Type {
+	left := c.checkExpression(exp.Left)
+	for _, bound := range []ast.Expression{exp.Start, exp.End} {
+		if bound == nil { continue }
+		if t := c.checkExpression(bound); !assignable(t, INT) {
+			c.errorf(ast.ExpressionToken(bound), "Cannot use %s as int in slice", t)
+		}
+	}
+
+	switch objectType(left) {
+	case "", object.ARRAY_OBJECT, object.STRING_OBJECT:
+		return left
+	}
+
+	c.errorf(exp.Token, "Slice operator not supported: %s", left)
+	return ANY
+}
+
+func (c *checker) checkMember(exp *ast.MemberExpression) Type {
+	value := c.checkExpression(exp.Object)
+	name := exp.Property.Value
+
+	if instance, ok := value.(*Instance); ok {
+		if !instance.Struct.hasField(name) { c.errorf(exp.Property.Token, "Unknown field %s on %s", name, instance) }
+		return ANY
+	}
+
+	if objectType(value) != "" { c.errorf(exp.Token, "Field access not supported: %s", value) }
+	return ANY
+}
+
+func (c *checker) checkMatch(exp *ast.MatchExpression) Type {
+	subject := c.checkExpression(exp.Subject)
+
+	var result Type = never
+	for _, arm := range exp.Arms {
+		c.pushScope()
+		c.bindPattern(arm.Pattern, subject, false)
+		if arm.Guard != nil { c.checkExpression(arm.Guard) }
+		if block, ok := arm.Body.(*ast.BlockStatement); ok {
+			result = join(result, c.checkBlock(block))
+		} else {
+			result = join(result, c.checkExpression(arm.Body.(ast.Expression)))
+		}
+		c.popScope()
+	}
+
+	if result == never { return ANY }
+	return result
+}
+
+/*
+ Each element is bound in a scope of its own, and a pattern that can't destructure it is an error like in a let
+ */
+func (c *checker) checkFor(exp *ast.ForExpression) Type {
+	iterable := c.checkExpression(exp.Iterable)
+	element, ok := iterationOf(iterable)
+	if !ok { c.errorf(ast.ExpressionToken(exp.Iterable), "Cannot iterate over %s", iterable) }
+
+	c.pushScope()
+	c.bindPattern(exp.Pattern, element, true)
+	c.checkBlock(exp.Body)
+	c.popScope()
+
+	return NULL
+}
+
+/*
+ A spawned call has the type of the call, anything else spawned is called with no arguments
+ */
+func (c *checker) checkSpawn(exp *ast.SpawnExpression) Type {
+	if _, ok := exp.Task.(*ast.CallExpression); ok { return &Future{Result: c.checkExpression(exp.Task)} }
+
+	task := c.checkExpression(exp.Task)
+	switch objectType(task) {
+	case "", object.STRUCT_TYPE_OBJECT:
+	default:
+		c.errorf(ast.ExpressionToken(exp.Task), "Cannot spawn %s", task)
+	}
+
+	return &Future{Result: returnOf(task)}
+}
@@ -0,0 +1,189 @@
+package checker
+
+import (
+	"mockc/evaluator"
+	"mockc/lexer"
+	"mockc/parser"
+	"strings"
+	"testing"
+)
+
+func check(t *testing.T, input string) []string {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 { t.Fatalf("parser had errors: %v", p.Errors()) }
+
+	errors := []string{}
+	for _, err := range Check(program) { errors = append(errors, err.String()) }
+
+	return errors
+}
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`"a" - 1`, []string{"1:5: Operand type mismatch: string - int"}},
+		{`"a" * "b"`, []string{"1:5: Unknown string operator: string * string"}},
+		{`true + 1`, []string{"1:6: Operand type mismatch: bool + int"}},
+		{`let f = fn(x) { x }; true < f(1)`, []string{"1:27: Unknown infix operator: bool < any"}},
+		{`-"a"`, []string{"1:1: Unsupported negative operand: string"}},
+		{`let x: int = "five";`, []string{`1:14: Cannot use string as int in let x`}},
+		{`let xs: [int] = ["1"];`, []string{"1:17: Cannot use [string] as [int] in let xs"}},
+		{`let h: {string: int} = {"a": "b"};`, []string{"1:24: Cannot use {string: string} as {string: int} in let h"}},
+		{`let h = {[1]: 2};`, []string{"1:10: Type [int] is not hashable"}},
+		{`let f = fn(a: string, b: [int]) -> bool { len(b) > 0 }; f(1, [2]);`, []string{"1:59: Cannot use int as string in argument 1 to f"}},
+		{`let f = fn(a, b) { a }; f(1);`, []string{"1:25: Wrong number of arguments to f. got=1, want=2"}},
+		{`let f = fn() -> int { "x" };`, []string{"1:23: Cannot use string as int in return"}},
+		{`let f = fn(n) -> int { if (n) { return "x"; } 1 };`, []string{"1:33: Cannot use string as int in return"}},
+		{`let f = fn(n: int = "x") { n };`, []string{"1:21: Cannot use string as int in default of n"}},
+		{`let f = fn(g: fn(int) -> int) { g(1) }; f(fn(a, b) { a });`, []string{"1:43: Cannot use fn(any, any) -> any as fn(int) -> int in argument 1 to f"}},
+		{`len(1, 2)`, []string{"1:1: Wrong number of arguments to len. got=2, want=1"}},
+		{`split("a", "b", "c")`, []string{"1:1: Wrong number of arguments to split. got=3, want=1 or 2"}},
+		{`upper(1)`, []string{"1:7: Cannot use int as string in argument 1 to upper"}},
+		{`map([1], fn(a, b) { a })`, []string{"1:10: Cannot use fn(any, any) -> any as fn(any) -> any in argument 2 to map"}},
+		{`"abc".push(1)`, []string{"1:7: Unknown method push for string"}},
+		{`[1].join(1)`, []string{"1:1: Cannot use [int] as [string] in receiver of join", "1:10: Cannot use int as string in argument 1 to join"}},
+		{`5(1)`, []string{"1:1: Not a function: int"}},
+		{`let x = 5; x[0]`, []string{"1:13: Index operator not supported: int"}},
+		{`[1, 2]["a"]`, []string{"1:8: Cannot use string as int in index"}},
+		{`{"a": 1}[1]`, []string{"1:10: Cannot use int as string in index"}},
+		{`5[1:]`, []string{"1:2: Slice operator not supported: int"}},
+		{`let x = 5; x.y`, []string{"1:13: Field access not supported: int"}},
+		{`y + 1`, []string{"1:1: Identifier not found: y"}},
+		{`let x: Foo = 1;`, []string{"1:8: Unknown type Foo"}},
+		{`let [a, b] = 5;`, []string{"1:5: Cannot destructure int with [a, b]"}},
+		{`let x: {[int]: int} = {};`, []string{"1:8: Type [int] is not hashable"}},
+		{`for (x in 5) { x }`, []string{"1:11: Cannot iterate over int"}},
+		{`let g = fn() -> int { yield 1 };`, []string{"1:9: Cannot use iterator as int in return"}},
+		{`for (x in [1]) { let y: string = x; }`, []string{"1:34: Cannot use int as string in let y"}},
+		{`spawn 5`, []string{"1:7: Cannot spawn int"}},
+		{`await [1]`, []string{"1:7: Cannot await [int]"}},
+		{`let f = spawn fn() { 1 }; let s: string = await f;`, []string{"1:43: Cannot use int as string in let s"}},
+		{`send([1], 2)`, []string{"1:6: Cannot use [int] as channel in argument 1 to send"}},
+	}
+
+	for _, tt := range tests {
+		errors := check(t, tt.input)
+		if strings.Join(errors, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s: wrong errors. got=%q, want=%q", tt.input, errors, tt.expected)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	input := `struct Point { x, y }
+impl Point { let norm = fn(self) -> int { self.x + self.y }; }
+let p: Point = Point(1, 2);
+let n: string = p.norm();
+p.z;
+p.scale(2);
+Point(1);
+let q: Point = 1;`
+
+	expected := []string{
+		"4:17: Cannot use int as string in let n",
+		"5:3: Unknown field z on Point",
+		"6:3: Unknown method scale on Point",
+		"7:1: Wrong number of arguments to Point. got=1, want=2",
+		"8:16: Cannot use int as Point in let q",
+	}
+	if errors := check(t, input); strings.Join(errors, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors. got=%q, want=%q", errors, expected)
+	}
+}
+
+func TestInference(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // Type of the last statement
+	}{
+		{`1 + 2`, "int"},
+		{`"a" + "b"`, "string"},
+		{`let f = fn(x) { x }; f(1) + 1`, "int"},
+		{`let f = fn(x) { x }; f(1) < 2`, "bool"},
+		{`[1, 2]`, "[int]"},
+		{`[1, "a"]`, "[any]"},
+		{`[]`, "[any]"},
+		{`{"a": [1]}`, "{string: [int]}"},
+		{`if (true) { 1 } else { 2 }`, "int"},
+		{`if (true) { 1 }`, "any"},
+		{`fn(a: int, b) { a }`, "fn(int, any) -> int"},
+		{`fn(n) { if (n) { return "a"; } "b" }`, "fn(any) -> string"},
+		{`fn(n) { return 1; }`, "fn(any) -> int"},
+		{`first([1, 2])`, "int"},
+		{`[1, 2].filter(fn(x) { x > 1 })`, "[int]"},
+		{`map(["a"], fn(s) { len(s) })`, "[int]"},
+		{`keys({"a": 1})`, "[string]"},
+		{`get({"a": 1}, "a", 0)`, "int"},
+		{`push([1], 2)`, "[int]"},
+		{`split("a b")[0]`, "string"},
+		{`"abc"[0:2]`, "string"},
+		{`let [a, ...rest] = [1, 2]; rest`, "[int]"},
+		{`match (1) { 0 => "zero", _ => "many" }`, "string"},
+		{`let len = fn(x) { "shadowed" }; len(1)`, "string"},
+		{`let f = fn() { g() }; let g = fn() { 1 }; g()`, "int"},
+		{`fn() { yield 1; yield 2 }`, "fn() -> iterator"},
+		{`let g = fn() -> iterator { yield "a" }; next(g(), "b")`, "any"},
+		{`let g = fn() { yield "a" }; next(g(), "b")`, "string"},
+		{`collect(map(count(), fn(n) { n * 2 }))`, "[int]"},
+		{`for (x in [1]) { x }`, "null"},
+		{`spawn fn() { "a" }`, "future"},
+		{`let add = fn(a: int, b: int) { a + b }; await spawn add(1, 2)`, "int"},
+		{`let f: future = spawn fn() { 1 }; await f`, "any"},
+		{`let ch: channel = channel(); recv(ch)`, "any"},
+		{`for (x in channel()) { x }`, "null"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 { t.Fatalf("%s: parser had errors: %v", tt.input, p.Errors()) }
+
+		c := newChecker()
+		c.declareGlobals(program)
+		var last Type
+		for _, stmt := range program.Statements { last = c.checkStatement(stmt) }
+
+		if len(c.errors) != 0 { t.Errorf("%s: unexpected errors %v", tt.input, c.errors) }
+		if last == nil || last.String() != tt.expected { t.Errorf("%s: wrong type. got=%v, want=%s", tt.input, last, tt.expected) }
+	}
+}
+
+func TestGradualCodeChecks(t *testing.T) {
+	input := `let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+let later = fn() { helper(2) };
+let helper = fn(x) { x + 1 };
+let describe = fn(v) { match (v) { [h, ...t] => h, {name} => name, _ => v } };
+let [a, b = 2, ...rest] = [1];
+let {name, age = 0} = {"name": "moxie"};
+let compose = fn(f, g) { fn(x) { f(g(x)) } };
+compose(helper, helper)(1) + 1;
+let anything = json_parse("1");
+anything + 1;
+anything.field;
+anything(1, 2);
+first([]) == 1;
+read_line() == "x";
+[1, 2] < [1, 3];
+9223372036854775807 + 1;
+let evens = fn() { for (n in count()) { if (n % 2 == 0) { yield n } } };
+take(evens(), 3).map(fn(n) { n + 1 }).collect();
+for (k in {"a": 1}) { k + "!" };
+let results = channel(1);
+let task = spawn fn() { send(results, 1); close(results) };
+await task;
+recv(results) + select([results], [0, 0])[1];
+let f = fn(x, y) { x }; f(1, 2, 3);`
+
+	if errors := check(t, input); len(errors) != 0 { t.Errorf("unannotated code should check. got=%q", errors) }
+}
+
+func TestEveryBuiltinHasASignature(t *testing.T) {
+	for _, name := range evaluator.BuiltinNames() {
+		if _, ok := builtins[name]; !ok { t.Errorf("builtin %s has no signature", name) }
+	}
+	if len(builtins) != len(evaluator.BuiltinNames()) { t.Errorf("signatures for builtins that don't exist") }
+}
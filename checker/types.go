@@ -0,0 +1,215 @@
+package checker
+
+import (
+	"mockc/object"
+	"strings"
+)
+
+// The types the checker infers. Checking is gradual: any is compatible with every other type in both directions, so
+// unannotated code only gets an error when it would fail whatever values it ran with
+
+type Type interface {
+	String() string
+}
+
+type Basic string
+
+func (b Basic) String() string { return string(b) }
+
+const (
+	INT    Basic = "int"
+	STRING Basic = "string"
+	BOOL   Basic = "bool"
+	NULL   Basic = "null"
+	ANY    Basic = "any"
+	CHANNEL Basic = "channel" // Anything can be sent on any channel, so channels don't have an element type
+)
+
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string { return "[" + a.Element.String() + "]" }
+
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string { return "{" + h.Key.String() + ": " + h.Value.String() + "}" }
+
+/*
+ The iterators generators and iter() return. Annotations can only say iterator, which is an iterator of any
+ */
+type Iterator struct {
+	Element Type
+}
+
+func (it *Iterator) String() string { return "iterator" }
+
+/*
+ The futures spawn returns. Annotations can only say future, which is a future of any
+ */
+type Future struct {
+	Result Type
+}
+
+func (f *Future) String() string { return "future" }
+
+type Function struct {
+	Params       []Type
+	Required     int  // Arguments that can't be left out, the rest of Params are optional
+	Variadic     Type // Type of any arguments after Params, nil if there can't be more
+	IgnoresExtra bool // Extra arguments are dropped rather than an error, true of Moxie functions
+	Return       Type
+}
+
+func (f *Function) String() string {
+	params := []string{}
+	for _, param := range f.Params { params = append(params, param.String()) }
+	if f.Variadic != nil { params = append(params, "..."+f.Variadic.String()) }
+
+	return "fn(" + strings.Join(params, ", ") + ") -> " + f.Return.String()
+}
+
+/*
+ A struct type, which is also the constructor of its instances
+ */
+type Struct struct {
+	Name    string
+	Fields  []string
+	Methods map[string]Type // Added by impl blocks
+}
+
+func (s *Struct) String() string { return "struct " + s.Name }
+
+func (s *Struct) hasField(name string) bool {
+	for _, field := range s.Fields {
+		if field == name { return true }
+	}
+	return false
+}
+
+type Instance struct {
+	Struct *Struct
+}
+
+func (i *Instance) String() string { return i.Struct.Name }
+
+/*
+ Build a function type for parameters that all have to be passed
+ */
+func fn(params []Type, ret Type) *Function {
+	return &Function{Params: params, Required: len(params), Return: ret}
+}
+
+/*
+ Whether a value of type from can be used where to is expected
+ */
+func assignable(from, to Type) bool {
+	if from == ANY || to == ANY || from == never { return true }
+
+	switch to := to.(type) {
+	case *Array:
+		from, ok := from.(*Array)
+		return ok && assignable(from.Element, to.Element)
+
+	case *Hash:
+		from, ok := from.(*Hash)
+		return ok && assignable(from.Key, to.Key) && assignable(from.Value, to.Value)
+
+	case *Function:
+		from, ok := from.(*Function)
+		if !ok { return false }
+		if from.Required > len(to.Params) { return false } // Would be called with too few arguments
+		for i, param := range to.Params {
+			if i < len(from.Params) {
+				if !assignable(param, from.Params[i]) { return false }
+			} else if from.Variadic != nil {
+				if !assignable(param, from.Variadic) { return false }
+			} else if !from.IgnoresExtra {
+				return false
+			}
+		}
+		return assignable(from.Return, to.Return)
+
+	case *Iterator:
+		from, ok := from.(*Iterator)
+		return ok && assignable(from.Element, to.Element)
+
+	case *Future:
+		from, ok := from.(*Future)
+		return ok && assignable(from.Result, to.Result)
+
+	case *Instance:
+		from, ok := from.(*Instance)
+		return ok && from.Struct == to.Struct
+	}
+
+	return from == to
+}
+
+/*
+ The type of a value that could be either a or b, ex. the two branches of an if
+ */
+func join(a, b Type) Type {
+	if a == b || b == never { return a }
+	if a == never { return b }
+
+	switch a := a.(type) {
+	case *Array:
+		if b, ok := b.(*Array); ok { return &Array{Element: join(a.Element, b.Element)} }
+	case *Hash:
+		if b, ok := b.(*Hash); ok { return &Hash{Key: join(a.Key, b.Key), Value: join(a.Value, b.Value)} }
+	case *Iterator:
+		if b, ok := b.(*Iterator); ok { return &Iterator{Element: join(a.Element, b.Element)} }
+	case *Future:
+		if b, ok := b.(*Future); ok { return &Future{Result: join(a.Result, b.Result)} }
+	case *Instance:
+		if b, ok := b.(*Instance); ok && a.Struct == b.Struct { return a }
+	}
+	if a.String() == b.String() { return a }
+
+	return ANY
+}
+
+/*
+ The runtime type of values of t, "" if it could be more than one. Operators only care about this much
+ */
+func objectType(t Type) object.ObjectType {
+	switch t := t.(type) {
+	case Basic:
+		switch t {
+		case INT:
+			return object.INTEGER_OBJECT
+		case STRING:
+			return object.STRING_OBJECT
+		case BOOL:
+			return object.BOOLEAN_OBJECT
+		case NULL:
+			return object.NULL_OBJECT
+		case CHANNEL:
+			return object.CHANNEL_OBJECT
+		}
+	case *Array:
+		return object.ARRAY_OBJECT
+	case *Hash:
+		return object.HASH_OBJECT
+	case *Iterator:
+		return object.ITERATOR_OBJECT
+	case *Future:
+		return object.FUTURE_OBJECT
+	case *Instance:
+		return object.STRUCT_OBJECT
+	case *Struct:
+		return object.STRUCT_TYPE_OBJECT
+	}
+	return "" // Functions can be FUNCTION or BUILTIN
+}
+
+/*
+ Whether values of t can be hash keys
+ */
+func hashable(t Type) bool {
+	return t == ANY || t == INT || t == STRING || t == BOOL
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"mockc/coverage"
+	"os"
+)
+
+/*
+ mockc cover [-lcov file] [-html file] profiles...
+ Merges the coverage profiles written by `mockc run --coverprofile` and `mockc test --coverprofile`, prints a summary
+ and optionally writes LCOV and HTML reports. Returns 0, or 2 for bad usage or unreadable profiles
+ */
+func coverCommand(args []string) int {
+	flags := flag.NewFlagSet("cover", flag.ContinueOnError)
+	lcov := flags.String("lcov", "", "write an LCOV tracefile to this file")
+	html := flags.String("html", "", "write an HTML report with annotated sources to this file")
+	if err := flags.Parse(args); err != nil { return 2 }
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: mockc cover [-lcov file] [-html file] profiles...")
+		return 2
+	}
+
+	merged := coverage.NewProfile()
+	for _, path := range flags.Args() {
+		in, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		profile, err := coverage.ReadProfile(in)
+		in.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			return 2
+		}
+		merged.Merge(profile)
+	}
+
+	merged.WriteSummary(os.Stdout)
+	if *lcov != "" {
+		if err := writeReport(*lcov, merged.WriteLCOV); err != nil { fmt.Fprintf(os.Stderr, "Could not write LCOV report: %s\n", err) }
+	}
+	if *html != "" {
+		if err := writeReport(*html, merged.WriteHTML); err != nil { fmt.Fprintf(os.Stderr, "Could not write HTML report: %s\n", err) }
+	}
+
+	return 0
+}
+
+func writeCoverProfile(profile *coverage.Profile, path string) error {
+	return writeReport(path, profile.Write)
+}
+
+/*
+ Create path and write to it, reporting the first error of either
+ */
+func writeReport(path string, write func(w io.Writer) error) error {
+	out, err := os.Create(path)
+	if err != nil { return err }
+	err = write(out)
+	if closeErr := out.Close(); err == nil { err = closeErr }
+
+	return err
+}
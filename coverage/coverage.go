@@ -0,0 +1,193 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mockc/ast"
+	"mockc/object"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Coverage records which parts of a program ran. A program is instrumented before it runs, which registers every
+// statement, block and arm of an if as a point that hasn't run yet, then the Profile is set as the runtime's Tracer
+// and counts the points as the evaluator reaches them. Points are identified by file and position rather than by AST
+// node, so profiles of separate runs can be saved and merged
+
+const MODE_HEADER = "mode: count" // First line of a saved profile, the version of the format
+
+type Kind string
+
+const (
+	STATEMENT   Kind = "statement"
+	BLOCK       Kind = "block"
+	BRANCH_THEN Kind = "then" // An if's consequence ran
+	BRANCH_ELSE Kind = "else" // An if's alternative ran, or would have if it had one
+)
+
+var kindOrder = map[Kind]int{STATEMENT: 0, BLOCK: 1, BRANCH_THEN: 2, BRANCH_ELSE: 3}
+
+type Point struct {
+	File   string
+	Line   int
+	Column int
+	Kind   Kind
+}
+
+type Profile struct {
+	Counts   map[Point]int64
+	nodes    map[ast.Node]Point                 // Statements and blocks of the instrumented programs
+	branches map[*ast.IfExpression][2]Point     // Then and else points of each if
+	mu       sync.Mutex                         // Spawned tasks count into the same profile
+}
+
+func NewProfile() *Profile {
+	return &Profile{
+		Counts:   map[Point]int64{},
+		nodes:    map[ast.Node]Point{},
+		branches: map[*ast.IfExpression][2]Point{},
+	}
+}
+
+/*
+ Register every point in program, which was read from file. Programs that aren't instrumented run without being counted
+ */
+func (p *Profile) Instrument(file string, program *ast.Program) {
+	point := func(line, column int, kind Kind) Point {
+		pt := Point{File: file, Line: line, Column: column, Kind: kind}
+		if _, ok := p.Counts[pt]; !ok { p.Counts[pt] = 0 }
+		return pt
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement, *ast.StructStatement, *ast.ImplStatement, *ast.ReturnStatement, *ast.ExpressionStatement:
+			tok := ast.StatementToken(node.(ast.Statement))
+			p.nodes[node] = point(tok.Line, tok.Column, STATEMENT)
+
+		case *ast.BlockStatement:
+			p.nodes[node] = point(node.Token.Line, node.Token.Column, BLOCK)
+
+		case *ast.IfExpression:
+			p.branches[node] = [2]Point{
+				point(node.Token.Line, node.Token.Column, BRANCH_THEN),
+				point(node.Token.Line, node.Token.Column, BRANCH_ELSE),
+			}
+		}
+		return true
+	})
+}
+
+// Profiles are object.ForkingTracers. Calls don't matter for coverage, their bodies are counted as blocks, so spawned
+// tasks can share the profile of the program that spawned them
+func (p *Profile) Call(fn *object.Function) {}
+func (p *Profile) Return()                  {}
+func (p *Profile) Fork() object.Tracer      { return p }
+
+func (p *Profile) Statement(stmt ast.Statement) { p.count(stmt) }
+
+func (p *Profile) Block(block *ast.BlockStatement) { p.count(block) }
+
+func (p *Profile) Branch(node *ast.IfExpression, taken bool) {
+	points, ok := p.branches[node]
+	if !ok { return }
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if taken { p.Counts[points[0]]++ } else { p.Counts[points[1]]++ }
+}
+
+func (p *Profile) count(node ast.Node) {
+	point, ok := p.nodes[node]
+	if !ok { return }
+	p.mu.Lock()
+	p.Counts[point]++
+	p.mu.Unlock()
+}
+
+/*
+ Add the counts of other to p, ex. to combine the coverage of a program's test run with its own runs
+ */
+func (p *Profile) Merge(other *Profile) {
+	for point, count := range other.Counts { p.Counts[point] += count }
+}
+
+/*
+ Every point, sorted by file and then position
+ */
+func (p *Profile) Points() []Point {
+	points := []Point{}
+	for point := range p.Counts { points = append(points, point) }
+
+	sort.Slice(points, func(i, j int) bool {
+		a, b := points[i], points[j]
+		if a.File != b.File { return a.File < b.File }
+		if a.Line != b.Line { return a.Line < b.Line }
+		if a.Column != b.Column { return a.Column < b.Column }
+		return kindOrder[a.Kind] < kindOrder[b.Kind]
+	})
+
+	return points
+}
+
+/*
+ Save the profile as text, one point per line after the header:
+ statement fib.mx:3.5 12
+ */
+func (p *Profile) Write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, MODE_HEADER)
+	for _, point := range p.Points() {
+		fmt.Fprintf(out, "%s %s:%d.%d %d\n", point.Kind, point.File, point.Line, point.Column, p.Counts[point])
+	}
+
+	return out.Flush()
+}
+
+/*
+ Read a profile saved by Write. File names may contain spaces, so the kind is everything before the first space and
+ the count everything after the last
+ */
+func ReadProfile(r io.Reader) (*Profile, error) {
+	profile := NewProfile()
+	scanner := bufio.NewScanner(r)
+
+	if !scanner.Scan() || scanner.Text() != MODE_HEADER { return nil, fmt.Errorf("not a coverage profile, expected %q", MODE_HEADER) }
+
+	for lineNumber := 2; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if line == "" { continue }
+
+		point, count, err := parsePoint(line)
+		if err != nil { return nil, fmt.Errorf("line %d: %s", lineNumber, err) }
+		profile.Counts[point] += count
+	}
+	if err := scanner.Err(); err != nil { return nil, err }
+
+	return profile, nil
+}
+
+func parsePoint(line string) (Point, int64, error) {
+	kind, rest, ok := strings.Cut(line, " ")
+	last := strings.LastIndex(rest, " ")
+	if !ok || last < 0 { return Point{}, 0, fmt.Errorf("malformed point %q", line) }
+	location, countText := rest[:last], rest[last+1:]
+
+	colon := strings.LastIndex(location, ":")
+	if colon < 0 { return Point{}, 0, fmt.Errorf("malformed position %q", location) }
+	lineText, columnText, ok := strings.Cut(location[colon+1:], ".")
+	if !ok { return Point{}, 0, fmt.Errorf("malformed position %q", location) }
+
+	point := Point{File: location[:colon], Kind: Kind(kind)}
+	var err error
+	if point.Line, err = strconv.Atoi(lineText); err != nil { return Point{}, 0, err }
+	if point.Column, err = strconv.Atoi(columnText); err != nil { return Point{}, 0, err }
+	count, err := strconv.ParseInt(countText, 10, 64)
+	if err != nil { return Point{}, 0, err }
+
+	if _, ok := kindOrder[point.Kind]; !ok { return Point{}, 0, fmt.Errorf("unknown kind %q", kind) }
+
+	return point, count, nil
+}
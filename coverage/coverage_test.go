@@ -0,0 +1,192 @@
+package coverage
+
+import (
+	"bytes"
+	"mockc/evaluator"
+	"mockc/lexer"
+	"mockc/object"
+	"mockc/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const SOURCE = `let sign = fn(n) {
+  if (n < 0) { return -1; }
+  if (n > 0) { 1 } else { 0 }
+};
+sign(5);
+sign(7);
+`
+
+/*
+ Instrument and run input as file, returning the profile
+ */
+func cover(t *testing.T, file, input string) *Profile {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 { t.Fatalf("parser had errors: %v", p.Errors()) }
+
+	profile := NewProfile()
+	profile.Instrument(file, program)
+	runtime := object.NewRuntime()
+	runtime.Tracer = profile
+	evaluator.Eval(program, object.NewEnvironmentWithRuntime(runtime))
+
+	return profile
+}
+
+func TestCounts(t *testing.T) {
+	profile := cover(t, "sign.mx", SOURCE)
+
+	tests := []struct {
+		point    Point
+		expected int64
+	}{
+		{Point{"sign.mx", 1, 1, STATEMENT}, 1},
+		{Point{"sign.mx", 1, 18, BLOCK}, 2},           // The function body
+		{Point{"sign.mx", 2, 3, STATEMENT}, 2},
+		{Point{"sign.mx", 2, 3, BRANCH_THEN}, 0},
+		{Point{"sign.mx", 2, 3, BRANCH_ELSE}, 2},       // Counted even without an else
+		{Point{"sign.mx", 2, 14, BLOCK}, 0},
+		{Point{"sign.mx", 2, 16, STATEMENT}, 0},
+		{Point{"sign.mx", 3, 3, BRANCH_THEN}, 2},       // In tail position
+		{Point{"sign.mx", 3, 3, BRANCH_ELSE}, 0},
+		{Point{"sign.mx", 3, 14, BLOCK}, 2},
+		{Point{"sign.mx", 3, 25, BLOCK}, 0},
+		{Point{"sign.mx", 6, 1, STATEMENT}, 1},
+	}
+
+	for _, tt := range tests {
+		count, ok := profile.Counts[tt.point]
+		if !ok {
+			t.Errorf("%v was not instrumented", tt.point)
+			continue
+		}
+		if count != tt.expected { t.Errorf("%v has wrong count. got=%d, want=%d", tt.point, count, tt.expected) }
+	}
+
+	if len(profile.Counts) != 16 { t.Errorf("wrong number of points. got=%d, want=16", len(profile.Counts)) }
+}
+
+func TestSpawnedTasksAreCounted(t *testing.T) {
+	input := "let sign = fn(n) {\n  if (n < 0) { -1 } else { 1 }\n};\nlet tasks = map([1, -2, 3], fn(n) { spawn sign(n) });\nmap(tasks, fn(task) { await task });\n"
+	profile := cover(t, "tasks.mx", input)
+
+	if count := profile.Counts[Point{"tasks.mx", 2, 3, BRANCH_ELSE}]; count != 2 { t.Errorf("wrong else count. got=%d, want=2", count) }
+	if count := profile.Counts[Point{"tasks.mx", 2, 3, BRANCH_THEN}]; count != 1 { t.Errorf("wrong then count. got=%d, want=1", count) }
+}
+
+func TestSaveAndMerge(t *testing.T) {
+	first := cover(t, "dir with spaces/sign.mx", SOURCE)
+	second := cover(t, "dir with spaces/sign.mx", "let sign = fn(n) {\n  if (n < 0) { return -1; }\n};\nsign(-1);")
+
+	var saved bytes.Buffer
+	if err := first.Write(&saved); err != nil { t.Fatal(err) }
+	loaded, err := ReadProfile(&saved)
+	if err != nil { t.Fatalf("could not read profile back: %s", err) }
+	if len(loaded.Counts) != len(first.Counts) { t.Fatalf("wrong number of points read. got=%d, want=%d", len(loaded.Counts), len(first.Counts)) }
+	for point, count := range first.Counts {
+		if loaded.Counts[point] != count { t.Errorf("%v read back wrong. got=%d, want=%d", point, loaded.Counts[point], count) }
+	}
+
+	loaded.Merge(second)
+	merged := map[Point]int64{
+		{"dir with spaces/sign.mx", 2, 3, BRANCH_THEN}: 1,
+		{"dir with spaces/sign.mx", 2, 3, BRANCH_ELSE}: 2,
+		{"dir with spaces/sign.mx", 2, 16, STATEMENT}:  1,
+		{"dir with spaces/sign.mx", 5, 1, STATEMENT}:   1,
+	}
+	for point, expected := range merged {
+		if loaded.Counts[point] != expected { t.Errorf("%v merged wrong. got=%d, want=%d", point, loaded.Counts[point], expected) }
+	}
+}
+
+func TestReadProfileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"statement a.mx:1.1 1\n", `not a coverage profile, expected "mode: count"`},
+		{"mode: count\nstatement a.mx:1.1\n", `line 2: malformed point "statement a.mx:1.1"`},
+		{"mode: count\nstatement a.mx 1\n", `line 2: malformed position "a.mx"`},
+		{"mode: count\nloop a.mx:1.1 1\n", `line 2: unknown kind "loop"`},
+	}
+
+	for _, tt := range tests {
+		_, err := ReadProfile(strings.NewReader(tt.input))
+		if err == nil || err.Error() != tt.expected { t.Errorf("%q: wrong error. got=%v, want=%q", tt.input, err, tt.expected) }
+	}
+}
+
+func TestSummary(t *testing.T) {
+	profile := cover(t, "sign.mx", SOURCE)
+
+	var out bytes.Buffer
+	profile.WriteSummary(&out)
+	expected := `sign.mx  statements 75.0% (6/8)  branches 50.0% (2/4)  blocks 50.0% (2/4)
+total    statements 75.0% (6/8)  branches 50.0% (2/4)  blocks 50.0% (2/4)
+`
+	if out.String() != expected { t.Errorf("wrong summary. got=\n%s\nwant=\n%s", out.String(), expected) }
+}
+
+func TestLCOV(t *testing.T) {
+	profile := cover(t, "sign.mx", SOURCE)
+	profile.Merge(cover(t, "other.mx", "if (false) { 1 }"))
+
+	var out bytes.Buffer
+	profile.WriteLCOV(&out)
+	expected := `TN:
+SF:other.mx
+BRDA:1,1,0,0
+BRDA:1,1,1,1
+BRF:2
+BRH:1
+DA:1,1
+LF:1
+LH:1
+end_of_record
+TN:
+SF:sign.mx
+BRDA:2,3,0,0
+BRDA:2,3,1,2
+BRDA:3,3,0,2
+BRDA:3,3,1,0
+BRF:4
+BRH:2
+DA:1,1
+DA:2,2
+DA:3,2
+DA:5,1
+DA:6,1
+LF:5
+LH:5
+end_of_record
+`
+	if out.String() != expected { t.Errorf("wrong LCOV. got=\n%s\nwant=\n%s", out.String(), expected) }
+}
+
+func TestHTML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sign.mx")
+	if err := os.WriteFile(path, []byte(SOURCE), 0644); err != nil { t.Fatal(err) }
+	profile := cover(t, path, SOURCE)
+	profile.Merge(cover(t, "missing.mx", "1"))
+
+	var out bytes.Buffer
+	if err := profile.WriteHTML(&out); err != nil { t.Fatal(err) }
+	html := out.String()
+
+	expected := []string{
+		`<span class="line partial" title="statement at column 3 ran 2 times`,
+		`<span class="number">2</span>  if (n &lt; 0) { return -1; }</span>`,
+		`<span class="line covered" title="statement at column 1 ran once"><span class="number">5</span>sign(5);</span>`,
+		`<span class="line " title=""><span class="number">4</span>};</span>`,
+		`<td>75.0% (6/8)</td><td>50.0% (2/4)</td><td>50.0% (2/4)</td>`,
+		`<h2 id="file1">missing.mx</h2>` + "\n<p>Source not found</p>",
+	}
+	for _, want := range expected {
+		if !strings.Contains(html, want) { t.Errorf("HTML report is missing %q. got=\n%s", want, html) }
+	}
+}
@@ -0,0 +1,242 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+type tally struct {
+	hit   int
+	total int
+}
+
+func (t *tally) add(count int64) {
+	t.total++
+	if count > 0 { t.hit++ }
+}
+
+func (t *tally) merge(other tally) {
+	t.hit += other.hit
+	t.total += other.total
+}
+
+func (t tally) String() string {
+	if t.total == 0 { return "-" }
+	return fmt.Sprintf("%.1f%% (%d/%d)", 100*float64(t.hit)/float64(t.total), t.hit, t.total)
+}
+
+/*
+ The points of one file with how much of each kind ran
+ */
+type fileReport struct {
+	name       string
+	points     []Point
+	statements tally
+	branches   tally
+	blocks     tally
+}
+
+func (p *Profile) files() []*fileReport {
+	files := []*fileReport{}
+	for _, point := range p.Points() {
+		if len(files) == 0 || files[len(files)-1].name != point.File { files = append(files, &fileReport{name: point.File}) }
+		file := files[len(files)-1]
+		file.points = append(file.points, point)
+
+		switch point.Kind {
+		case STATEMENT:
+			file.statements.add(p.Counts[point])
+		case BLOCK:
+			file.blocks.add(p.Counts[point])
+		case BRANCH_THEN, BRANCH_ELSE:
+			file.branches.add(p.Counts[point])
+		}
+	}
+
+	return files
+}
+
+/*
+ Write how much of each file ran, and of all of them together:
+ fib.mx  statements 90.0% (9/10)  branches 50.0% (1/2)  blocks 100.0% (2/2)
+ */
+func (p *Profile) WriteSummary(w io.Writer) error {
+	out := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	total := &fileReport{name: "total"}
+
+	for _, file := range p.files() {
+		fmt.Fprintf(out, "%s\tstatements %s\tbranches %s\tblocks %s\n", file.name, file.statements, file.branches, file.blocks)
+		total.statements.merge(file.statements)
+		total.branches.merge(file.branches)
+		total.blocks.merge(file.blocks)
+	}
+	fmt.Fprintf(out, "%s\tstatements %s\tbranches %s\tblocks %s\n", total.name, total.statements, total.branches, total.blocks)
+
+	return out.Flush()
+}
+
+/*
+ Write the profile in the LCOV tracefile format read by genhtml and most CI coverage services. A line's count is the
+ most times any statement on it ran. Each if is a block of two branches, its then and its else, numbered by the
+ column it starts at
+ */
+func (p *Profile) WriteLCOV(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	for _, file := range p.files() {
+		fmt.Fprintf(out, "TN:\nSF:%s\n", file.name)
+
+		lines := []int{}
+		lineCounts := map[int]int64{}
+		branches, branchesHit := 0, 0
+		for _, point := range file.points {
+			count := p.Counts[point]
+			switch point.Kind {
+			case STATEMENT:
+				if _, ok := lineCounts[point.Line]; !ok { lines = append(lines, point.Line) }
+				if count >= lineCounts[point.Line] { lineCounts[point.Line] = count }
+
+			case BRANCH_THEN, BRANCH_ELSE:
+				branch := 0
+				if point.Kind == BRANCH_ELSE { branch = 1 }
+				taken := "-" // The if itself never ran
+				then, otherwise := p.branchCounts(point)
+				if then+otherwise > 0 { taken = strconv.FormatInt(count, 10) }
+				fmt.Fprintf(out, "BRDA:%d,%d,%d,%s\n", point.Line, point.Column, branch, taken)
+				branches++
+				if count > 0 { branchesHit++ }
+			}
+		}
+		fmt.Fprintf(out, "BRF:%d\nBRH:%d\n", branches, branchesHit)
+
+		linesHit := 0
+		for _, line := range lines {
+			fmt.Fprintf(out, "DA:%d,%d\n", line, lineCounts[line])
+			if lineCounts[line] > 0 { linesHit++ }
+		}
+		fmt.Fprintf(out, "LF:%d\nLH:%d\nend_of_record\n", len(lines), linesHit)
+	}
+
+	return out.Flush()
+}
+
+func (p *Profile) branchCounts(point Point) (then, otherwise int64) {
+	point.Kind = BRANCH_THEN
+	then = p.Counts[point]
+	point.Kind = BRANCH_ELSE
+	return then, p.Counts[point]
+}
+
+type htmlFile struct {
+	Name       string
+	Anchor     string
+	Statements string
+	Branches   string
+	Blocks     string
+	Missing    bool // The source couldn't be read, only the summary is shown
+	Lines      []htmlLine
+}
+
+type htmlLine struct {
+	Number int
+	Text   string
+	Class  string // covered, partial, uncovered or "" for lines with nothing to run
+	Title  string // What ran on the line and how often
+}
+
+var htmlReport = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Moxie coverage</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-family: monospace; }
+.line { display: block; white-space: pre; }
+.number { display: inline-block; width: 4em; margin-right: 1em; text-align: right; color: #888; user-select: none; }
+.covered { background: #d7f5d7; }
+.partial { background: #fff2b3; }
+.uncovered { background: #f8d0d0; }
+td, th { padding: 0 1em; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Moxie coverage</h1>
+<table>
+<tr><th>File</th><th>Statements</th><th>Branches</th><th>Blocks</th></tr>
+{{range .}}<tr><td><a href="#{{.Anchor}}">{{.Name}}</a></td><td>{{.Statements}}</td><td>{{.Branches}}</td><td>{{.Blocks}}</td></tr>
+{{end}}</table>
+{{range .}}<h2 id="{{.Anchor}}">{{.Name}}</h2>
+{{if .Missing}}<p>Source not found</p>
+{{else}}<pre>{{range .Lines}}<span class="line {{.Class}}" title="{{.Title}}"><span class="number">{{.Number}}</span>{{.Text}}</span>{{end}}</pre>
+{{end}}{{end}}</body>
+</html>
+`))
+
+/*
+ Write a standalone HTML page with the summary and the source of every file, each line colored by whether everything on
+ it ran, some of it did or none of it did. Sources are read from the paths in the profile
+ */
+func (p *Profile) WriteHTML(w io.Writer) error {
+	files := []htmlFile{}
+
+	for i, file := range p.files() {
+		page := htmlFile{
+			Name:       file.name,
+			Anchor:     fmt.Sprintf("file%d", i),
+			Statements: file.statements.String(),
+			Branches:   file.branches.String(),
+			Blocks:     file.blocks.String(),
+		}
+
+		source, err := os.ReadFile(file.name)
+		if err != nil {
+			page.Missing = true
+			files = append(files, page)
+			continue
+		}
+
+		byLine := map[int][]Point{}
+		for _, point := range file.points { byLine[point.Line] = append(byLine[point.Line], point) }
+
+		for i, text := range strings.Split(strings.TrimSuffix(string(source), "\n"), "\n") {
+			line := htmlLine{Number: i + 1, Text: text}
+			line.Class, line.Title = p.describeLine(byLine[i+1])
+			page.Lines = append(page.Lines, line)
+		}
+		files = append(files, page)
+	}
+
+	return htmlReport.Execute(w, files)
+}
+
+func (p *Profile) describeLine(points []Point) (class, title string) {
+	if len(points) == 0 { return "", "" }
+
+	hit := 0
+	descriptions := []string{}
+	for _, point := range points {
+		count := p.Counts[point]
+		if count > 0 { hit++ }
+		times := "never ran"
+		if count == 1 { times = "ran once" } else if count > 1 { times = fmt.Sprintf("ran %d times", count) }
+		descriptions = append(descriptions, fmt.Sprintf("%s at column %d %s", point.Kind, point.Column, times))
+	}
+
+	switch hit {
+	case len(points):
+		class = "covered"
+	case 0:
+		class = "uncovered"
+	default:
+		class = "partial"
+	}
+
+	return class, strings.Join(descriptions, "\n")
+}
@@ -3,18 +3,42 @@ package evaluator
 import (
 	"mockc/object"
 	"fmt"
+	"sort"
+	"unicode/utf8"
 )
 
+/*
+ The names of every builtin, sorted
+ */
+func BuiltinNames() []string {
+	names := []string{}
+	for name := range builtins { names = append(names, name) }
+	sort.Strings(names)
+
+	return names
+}
+
+/*
+ The builtin with the given name
+ */
+func LookupBuiltin(name string) (*object.BuiltIn, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+const MAX_LENGTH = 1 << 26 // The longest string, in bytes, or array a builtin will build, bigger ones are an error rather than a crash
+
 // Basically a second environment but for our builtin functions
 var builtins = map[string]*object.BuiltIn {
 	"len": &object.BuiltIn{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args))}
 
 			switch arg := args[0].(type) {
 			case *object.Array: return &object.Integer{Value: int64(len(arg.Elements))}
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
+			case *object.String: // Characters rather than bytes, matching string indexing
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *object.Hash: return &object.Integer{Value: int64(arg.Len())}
 			default:
 				return newError("Argument to `len` not supported, got %s", args[0].Type())
 			}
@@ -22,7 +46,7 @@ var builtins = map[string]*object.BuiltIn {
 	},
 
 	"first": &object.BuiltIn {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
 			if args[0].Type() != object.ARRAY_OBJECT { return newError("Argument to 'first' must be ARRAY, got %s", args[0].Type()) }
 			arr := args[0].(*object.Array)
@@ -33,7 +57,7 @@ var builtins = map[string]*object.BuiltIn {
 	},
 
 	"last": &object.BuiltIn {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
 			if args[0].Type() != object.ARRAY_OBJECT { return newError("Argument to 'last' must be ARRAY, got %s", args[0].Type()) }
 			arr := args[0].(*object.Array)
@@ -45,7 +69,7 @@ var builtins = map[string]*object.BuiltIn {
 	},
 
 	"rest": &object.BuiltIn {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
 			if args[0].Type() != object.ARRAY_OBJECT { return newError("Argument to 'rest' must be ARRAY, got %s", args[0].Type()) }
 			arr := args[0].(*object.Array)
@@ -62,7 +86,7 @@ var builtins = map[string]*object.BuiltIn {
 	},
 
 	"push": &object.BuiltIn {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
 			if args[0].Type() != object.ARRAY_OBJECT { return newError("Argument to 'push' must be ARRAY, got %s", args[0].Type()) }
 			arr := args[0].(*object.Array)
@@ -77,8 +101,8 @@ var builtins = map[string]*object.BuiltIn {
 	},
 
 	"print": &object.BuiltIn {
-		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args { fmt.Println(arg.Inspect()) }
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			for _, arg := range args { fmt.Fprintln(env.Runtime().Stdout, arg.Inspect()) }
 			return NEWLINE // The null return looked bad so I added a new constant to evaluator
 		},
 	},
@@ -0,0 +1,85 @@
+package evaluator
+
+import (
+	"mockc/object"
+	"strings"
+	"unicode/utf8"
+)
+
+// Assertion builtins for tests written in Moxie. A failed assertion is an ordinary error, so it stops the test the
+// same way any runtime error would, and its message is what `mockc test` reports
+func init() {
+	builtins["assert"] = &object.BuiltIn{Fn: builtinAssert}
+	builtins["assert_eq"] = &object.BuiltIn{Fn: builtinAssertEq}
+	builtins["assert_error"] = &object.BuiltIn{Fn: builtinAssertError}
+}
+
+/*
+ assert(cond) fails unless cond is truthy, assert(cond, message) adds message to the failure
+ */
+func builtinAssert(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=1 or 2", len(args)) }
+	if isTruthy(args[0]) { return NULL }
+
+	return assertionError("assert failed", args[1:], "")
+}
+
+/*
+ assert_eq(actual, expected) fails unless both are structurally equal, showing where their printed forms differ
+ An optional third argument adds a message to the failure
+ */
+func builtinAssertEq(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 { return newError("Wrong number of arguments. got=%d, want=2 or 3", len(args)) }
+	if object.Equal(args[0], args[1]) { return NULL }
+
+	return assertionError("assert_eq failed", args[2:], inspectDiff(args[1], args[0]))
+}
+
+/*
+ assert_error(f) calls f with no arguments and fails unless it raises an error, returning the error's message
+ assert_error(f, text) also fails unless the message contains text
+ */
+func builtinAssertError(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=1 or 2", len(args)) }
+	if !isCallable(args[0]) { return newError("Argument to 'assert_error' must be FUNCTION, got %s", args[0].Type()) }
+
+	want := ""
+	if len(args) == 2 {
+		str, ok := args[1].(*object.String)
+		if !ok { return newError("Argument to 'assert_error' must be STRING, got %s", args[1].Type()) }
+		want = str.Value
+	}
+
+	result := applyFunction(args[0], []object.Object{}, env)
+	errObj, ok := result.(*object.Error)
+	if !ok { return newError("assert_error failed: no error was raised, got %s", result.Inspect()) }
+	if !strings.Contains(errObj.Message, want) {
+		return newError("assert_error failed: error %q does not contain %q", errObj.Message, want)
+	}
+
+	return &object.String{Value: errObj.Message}
+}
+
+func assertionError(summary string, message []object.Object, details string) *object.Error {
+	if len(message) == 1 { summary += ": " + message[0].Inspect() }
+
+	return newError("%s%s", summary, details)
+}
+
+/*
+ Show the printed forms of both values one above the other with a caret under the first character that differs
+ */
+func inspectDiff(expected, actual object.Object) string {
+	want, got := expected.Inspect(), actual.Inspect()
+	if want == got { // Ex. "1" and 1 print the same, so the types are the difference
+		want += " (" + string(expected.Type()) + ")"
+		got += " (" + string(actual.Type()) + ")"
+	}
+
+	common := 0
+	for common < len(want) && common < len(got) && want[common] == got[common] { common++ }
+	for common > 0 && common < len(got) && !utf8.RuneStart(got[common]) { common-- } // Point at the start of a character, not inside it
+
+	caret := strings.Repeat(" ", utf8.RuneCountInString(got[:common]))
+	return "\n  - expected: " + want + "\n  + actual:   " + got + "\n              " + caret + "^"
+}
@@ -0,0 +1,109 @@
+package evaluator
+
+import "mockc/object"
+
+// Channel builtins. Channels pass values between tasks, a send waits for a receiver unless the channel has room to
+// hold the value until one comes along
+func init() {
+	channelBuiltins := map[string]object.BuiltInFunction{
+		"channel": builtinChannel,
+		"send":    builtinSend,
+		"recv":    builtinRecv,
+		"close":   builtinClose,
+		"select":  builtinSelect,
+	}
+
+	for name, fn := range channelBuiltins { builtins[name] = &object.BuiltIn{Fn: fn} }
+}
+
+/*
+ channel() is a channel where every send waits for a receiver, channel(n) can hold n values no one has received yet
+ */
+func builtinChannel(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) > 1 { return newError("Wrong number of arguments. got=%d, want=0 or 1", len(args)) }
+	if len(args) == 0 { return object.NewChannel(0) }
+
+	capacity, ok := args[0].(*object.Integer)
+	if !ok { return newError("Argument to 'channel' must be INTEGER, got %s", args[0].Type()) }
+	if capacity.Value < 0 { return newError("Capacity for 'channel' must not be negative, got %d", capacity.Value) }
+	if capacity.Value > MAX_LENGTH { return newError("Capacity for 'channel' is too big, the limit is %d", MAX_LENGTH) }
+	return object.NewChannel(int(capacity.Value))
+}
+
+/*
+ send(ch, value) waits until value is received or there's room for it. Sending on a closed channel is an error
+ */
+func builtinSend(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+	channel, ok := args[0].(*object.Channel)
+	if !ok { return newError("Argument to 'send' must be CHANNEL, got %s", args[0].Type()) }
+
+	if !channel.Send(args[1]) { return newError("Send on closed channel") }
+	return NULL
+}
+
+/*
+ recv(ch) waits for the next value sent on a channel, or returns null once it's closed and empty
+ recv(ch, default) returns default instead of null, same as next
+ */
+func builtinRecv(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=1 or 2", len(args)) }
+	channel, ok := args[0].(*object.Channel)
+	if !ok { return newError("Argument to 'recv' must be CHANNEL, got %s", args[0].Type()) }
+
+	value, ok := channel.Recv()
+	if ok { return value }
+	if len(args) == 2 { return args[1] }
+	return NULL
+}
+
+/*
+ close(ch) tells receivers nothing more is coming. Values already sent can still be received
+ */
+func builtinClose(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	channel, ok := args[0].(*object.Channel)
+	if !ok { return newError("Argument to 'close' must be CHANNEL, got %s", args[0].Type()) }
+
+	if !channel.Close() { return newError("Channel is already closed") }
+	return NULL
+}
+
+/*
+ select(cases) waits until one of several channel operations can go ahead, does it and returns [index, value]: which
+ case ran and what it received. A case is a channel to receive from or a [channel, value] pair to send on. The value is
+ null for sends and for a receive from a closed channel
+ select(cases, default) returns default straight away if no case is ready
+ */
+func builtinSelect(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=1 or 2", len(args)) }
+	arr, ok := args[0].(*object.Array)
+	if !ok { return newError("Argument to 'select' must be ARRAY, got %s", args[0].Type()) }
+	if len(arr.Elements) == 0 && len(args) == 1 { return newError("select with no cases would wait forever") }
+
+	cases := []object.SelectCase{}
+	for i, element := range arr.Elements {
+		selectCase, ok := toSelectCase(element)
+		if !ok { return newError("Case %d of 'select' must be CHANNEL or [CHANNEL, value], got %s", i, element.Inspect()) }
+		cases = append(cases, selectCase)
+	}
+
+	index, value, ok := object.Select(cases, len(args) == 1)
+	if index < 0 { return args[1] }
+	if cases[index].Send != nil && !ok { return newError("Send on closed channel") }
+	if value == nil { value = NULL }
+
+	return &object.Array{Elements: []object.Object{&object.Integer{Value: int64(index)}, value}}
+}
+
+func toSelectCase(obj object.Object) (object.SelectCase, bool) {
+	switch obj := obj.(type) {
+	case *object.Channel:
+		return object.SelectCase{Channel: obj}, true
+	case *object.Array:
+		if len(obj.Elements) != 2 { return object.SelectCase{}, false }
+		channel, ok := obj.Elements[0].(*object.Channel)
+		return object.SelectCase{Channel: channel, Send: obj.Elements[1]}, ok
+	}
+	return object.SelectCase{}, false
+}
@@ -0,0 +1,512 @@
+package evaluator
+
+import (
+	"mockc/object"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Higher-order and collection builtins. These call back into Moxie functions through applyFunction, which depends on
+// Eval and so on the builtins map itself, so they're registered in init() instead of the map literal in builtin.go
+// Most of them also read iterators. map and filter stay lazy on an iterator and return another one, the rest read it
+// as far as they need to
+func init() {
+	collectionBuiltins := map[string]object.BuiltInFunction{
+		"map":      builtinMap,
+		"filter":   builtinFilter,
+		"reduce":   builtinReduce,
+		"each":     builtinEach,
+		"sort":     builtinSort,
+		"reverse":  builtinReverse,
+		"zip":      builtinZip,
+		"range":    builtinRange,
+		"contains": builtinContains,
+		"index_of": builtinIndexOf,
+		"slice":    builtinSlice,
+		"concat":   builtinConcat,
+		"flatten":  builtinFlatten,
+		"unique":   builtinUnique,
+		"group_by": builtinGroupBy,
+	}
+
+	for name, fn := range collectionBuiltins { builtins[name] = &object.BuiltIn{Fn: fn} }
+}
+
+/*
+ map(arr, f) returns a new array holding f(element) for every element
+ map(it, f) returns an iterator that calls f on each value as it's read
+ */
+func builtinMap(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+	sequence, fn, err := sequenceAndFunctionArgs("map", args)
+	if err != nil { return err }
+
+	if source, ok := sequence.(*object.Iterator); ok {
+		return object.NewIterator(func() (object.Object, bool) {
+			value, ok := source.Next()
+			if !ok || isError(value) { return value, ok }
+			return applyFunction(fn, []object.Object{value}, env), true
+		}, source.Close)
+	}
+
+	arr := sequence.(*object.Array)
+	results := make([]object.Object, 0, len(arr.Elements))
+	for _, element := range arr.Elements {
+		result := applyFunction(fn, []object.Object{element}, env)
+		if isError(result) { return result }
+		results = append(results, result)
+	}
+
+	return &object.Array{Elements: results}
+}
+
+/*
+ filter(arr, f) returns a new array of the elements for which f(element) is truthy
+ filter(it, f) returns an iterator that skips the values for which f(value) isn't truthy as it's read
+ */
+func builtinFilter(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+	sequence, fn, err := sequenceAndFunctionArgs("filter", args)
+	if err != nil { return err }
+
+	if source, ok := sequence.(*object.Iterator); ok {
+		return object.NewIterator(func() (object.Object, bool) {
+			for {
+				value, ok := source.Next()
+				if !ok || isError(value) { return value, ok }
+
+				keep := applyFunction(fn, []object.Object{value}, env)
+				if isError(keep) { return keep, true }
+				if isTruthy(keep) { return value, true }
+			}
+		}, source.Close)
+	}
+
+	arr := sequence.(*object.Array)
+	results := []object.Object{}
+	for _, element := range arr.Elements {
+		keep := applyFunction(fn, []object.Object{element}, env)
+		if isError(keep) { return keep }
+		if isTruthy(keep) { results = append(results, element) }
+	}
+
+	return &object.Array{Elements: results}
+}
+
+/*
+ reduce(arr, f, initial) folds the array from the left with f(accumulator, element)
+ Without an initial value the first element is used and reducing an empty array is an error
+ */
+func builtinReduce(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 { return newError("Wrong number of arguments. got=%d, want=2 or 3", len(args)) }
+	sequence, fn, err := sequenceAndFunctionArgs("reduce", args)
+	if err != nil { return err }
+
+	var accumulator object.Object // nil until there's an initial value or a first element to start from
+	if len(args) == 3 { accumulator = args[2] }
+
+	failure := eachElement(sequence, func(element object.Object) object.Object {
+		if accumulator == nil {
+			accumulator = element
+			return nil
+		}
+
+		accumulator = applyFunction(fn, []object.Object{accumulator, element}, env)
+		if isError(accumulator) { return accumulator }
+		return nil
+	})
+	if failure != nil { return failure }
+	if accumulator == nil { return newError("Cannot reduce an empty array without an initial value") }
+
+	return accumulator
+}
+
+/*
+ each(arr, f) calls f(element) for its side effects
+ */
+func builtinEach(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+	sequence, fn, err := sequenceAndFunctionArgs("each", args)
+	if err != nil { return err }
+
+	failure := eachElement(sequence, func(element object.Object) object.Object {
+		result := applyFunction(fn, []object.Object{element}, env)
+		if isError(result) { return result }
+		return nil
+	})
+	if failure != nil { return failure }
+
+	return NULL
+}
+
+/*
+ sort(arr) returns a sorted copy using each element's natural ordering, see object.Comparable
+ sort(arr, cmp) orders with cmp(a, b) instead, which returns a negative, zero or positive integer like object.Compare
+ Both are stable
+ */
+func builtinSort(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=1 or 2", len(args)) }
+	elements, err := sequenceElements("sort", args[0])
+	if err != nil { return err }
+
+	sorted := make([]object.Object, len(elements))
+	copy(sorted, elements)
+
+	var failure object.Object // sort.SliceStable can't be interrupted, so remember the first error and stop comparing
+	less := func(i, j int) bool {
+		if failure != nil { return false }
+
+		result, ok := object.Compare(sorted[i], sorted[j])
+		if !ok { failure = newError("Cannot compare %s and %s", sorted[i].Inspect(), sorted[j].Inspect()) }
+		return result < 0
+	}
+
+	if len(args) == 2 {
+		comparator := args[1]
+		if !isCallable(comparator) { return newError("Argument to 'sort' must be FUNCTION, got %s", comparator.Type()) }
+
+		less = func(i, j int) bool {
+			if failure != nil { return false }
+
+			result := applyFunction(comparator, []object.Object{sorted[i], sorted[j]}, env)
+			integer, ok := result.(*object.Integer)
+			if !ok {
+				failure = result
+				if !isError(result) { failure = newError("Comparator for 'sort' must return INTEGER, got %s", result.Type()) }
+				return false
+			}
+			return integer.Value < 0
+		}
+	}
+
+	sort.SliceStable(sorted, less)
+	if failure != nil { return failure }
+
+	return &object.Array{Elements: sorted}
+}
+
+/*
+ reverse(arr) returns a reversed copy, reverse(s) reverses a string character by character
+ */
+func builtinReverse(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+
+	switch arg := args[0].(type) {
+	case *object.Array:
+		length := len(arg.Elements)
+		reversed := make([]object.Object, length)
+		for i, element := range arg.Elements { reversed[length - 1 - i] = element }
+
+		return &object.Array{Elements: reversed}
+	case *object.String:
+		runes := []rune(arg.Value)
+		for i, j := 0, len(runes) - 1; i < j; i, j = i + 1, j - 1 { runes[i], runes[j] = runes[j], runes[i] }
+
+		return &object.String{Value: string(runes)}
+	case *object.Iterator:
+		elements, err := sequenceElements("reverse", arg)
+		if err != nil { return err }
+		return builtinReverse(env, &object.Array{Elements: elements})
+	default:
+		return newError("Argument to 'reverse' must be ARRAY, STRING or ITERATOR, got %s", args[0].Type())
+	}
+}
+
+/*
+ zip(a, b, ...) pairs up the elements at each index, stopping at the end of the shortest array. Iterators are read in
+ step with the arrays, so zipping an endless iterator with an array only reads as many values as the array has
+ */
+func builtinZip(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) < 2 { return newError("Wrong number of arguments. got=%d, want=2 or more", len(args)) }
+
+	iterators := []*object.Iterator{}
+	for _, arg := range args {
+		if arg.Type() != object.ARRAY_OBJECT && arg.Type() != object.ITERATOR_OBJECT {
+			return newError("Argument to 'zip' must be ARRAY or ITERATOR, got %s", arg.Type())
+		}
+		iterator, _ := toIterator(arg)
+		iterators = append(iterators, iterator)
+	}
+	defer func() {
+		for _, iterator := range iterators { iterator.Close() }
+	}()
+
+	zipped := []object.Object{}
+	for {
+		tuple := make([]object.Object, len(args))
+		for j, iterator := range iterators {
+			value, ok := iterator.Next()
+			if !ok { return &object.Array{Elements: zipped} }
+			if isError(value) { return value }
+			tuple[j] = value
+		}
+		zipped = append(zipped, &object.Array{Elements: tuple})
+	}
+}
+
+/*
+ range(end), range(start, end) and range(start, end, step) build an array of integers from start up to, but not
+ including, end. A negative step counts down
+ */
+func builtinRange(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 3 { return newError("Wrong number of arguments. got=%d, want=1 to 3", len(args)) }
+
+	bounds := []int64{}
+	for _, arg := range args {
+		integer, ok := arg.(*object.Integer)
+		if !ok { return newError("Argument to 'range' must be INTEGER, got %s", arg.Type()) }
+		bounds = append(bounds, integer.Value)
+	}
+
+	start, end, step := int64(0), bounds[0], int64(1)
+	if len(bounds) > 1 { start, end = bounds[0], bounds[1] }
+	if len(bounds) > 2 { step = bounds[2] }
+	if step == 0 { return newError("Step for 'range' must not be zero") }
+
+	// Count the elements up front in unsigned arithmetic, stepping until past end could overflow near the int64 limits
+	var count uint64
+	if step > 0 && start < end { count = (uint64(end) - uint64(start) - 1) / uint64(step) + 1 }
+	if step < 0 && start > end { count = (uint64(start) - uint64(end) - 1) / (uint64(-(step + 1)) + 1) + 1 }
+	if count > MAX_LENGTH { return newError("Result of 'range' is too long, the limit is %d elements", MAX_LENGTH) }
+
+	elements := make([]object.Object, count)
+	value := start
+	for i := range elements {
+		elements[i] = &object.Integer{Value: value}
+		value += step // Wraps after the last element, which is never used
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+/*
+ contains(arr, value) reports whether any element is equal to value, using the same structural equality as ==
+ contains(s, substr) reports whether substr occurs in s
+ */
+func builtinContains(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+
+	switch arg := args[0].(type) {
+	case *object.Array:
+		return nativeBoolToBooleanObject(indexOf(arg, args[1]) >= 0)
+	case *object.Iterator: // Stops reading at the first match
+		index, err := iteratorIndexOf(arg, args[1])
+		if err != nil { return err }
+		return nativeBoolToBooleanObject(index >= 0)
+	case *object.String:
+		substr, ok := args[1].(*object.String)
+		if !ok { return newError("Argument to 'contains' must be STRING, got %s", args[1].Type()) }
+		return nativeBoolToBooleanObject(strings.Contains(arg.Value, substr.Value))
+	default:
+		return newError("Argument to 'contains' must be ARRAY, STRING or ITERATOR, got %s", args[0].Type())
+	}
+}
+
+/*
+ index_of(arr, value) returns the index of the first element equal to value, or -1
+ index_of(s, substr) returns the character index of the first occurrence of substr in s, or -1
+ */
+func builtinIndexOf(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+
+	switch arg := args[0].(type) {
+	case *object.Array:
+		return &object.Integer{Value: int64(indexOf(arg, args[1]))}
+	case *object.Iterator:
+		index, err := iteratorIndexOf(arg, args[1])
+		if err != nil { return err }
+		return &object.Integer{Value: int64(index)}
+	case *object.String:
+		substr, ok := args[1].(*object.String)
+		if !ok { return newError("Argument to 'index_of' must be STRING, got %s", args[1].Type()) }
+
+		byteIndex := strings.Index(arg.Value, substr.Value)
+		if byteIndex < 0 { return &object.Integer{Value: -1} }
+		return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value[:byteIndex]))}
+	default:
+		return newError("Argument to 'index_of' must be ARRAY, STRING or ITERATOR, got %s", args[0].Type())
+	}
+}
+
+func indexOf(arr *object.Array, value object.Object) int {
+	for i, element := range arr.Elements {
+		if object.Equal(element, value) { return i }
+	}
+
+	return -1
+}
+
+/*
+ Read the iterator up to the first value equal to value, returning how many came before it, or -1
+ */
+func iteratorIndexOf(iterator *object.Iterator, value object.Object) (int, object.Object) {
+	index := 0
+	found := eachElement(iterator, func(element object.Object) object.Object {
+		if object.Equal(element, value) { return TRUE }
+		index++
+		return nil
+	})
+
+	if found == nil { return -1, nil }
+	if isError(found) { return 0, found }
+	return index, nil
+}
+
+/*
+ slice(arr, start) and slice(arr, start, end) copy the elements from start up to, but not including, end
+ Negative indexes count back from the end and out of range indexes are clamped, like Python's slices
+ */
+func builtinSlice(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 { return newError("Wrong number of arguments. got=%d, want=2 or 3", len(args)) }
+	if args[0].Type() == object.STRING_OBJECT { return builtinSubstring(env, args...) }
+	if args[0].Type() != object.ARRAY_OBJECT { return newError("Argument to 'slice' must be ARRAY, got %s", args[0].Type()) }
+	arr := args[0].(*object.Array)
+
+	start, end, err := sliceBounds("slice", args[1:], len(arr.Elements))
+	if err != nil { return err }
+
+	return sliceArray(arr, start, end)
+}
+
+func sliceArray(arr *object.Array, start, end int) *object.Array {
+	sliced := make([]object.Object, end - start)
+	copy(sliced, arr.Elements[start:end])
+
+	return &object.Array{Elements: sliced}
+}
+
+/*
+ Turn the optional start and end arguments of a slice into clamped indexes of a sequence with the given length
+ */
+func sliceBounds(name string, args []object.Object, length int) (int, int, *object.Error) {
+	bounds := []int{0, length}
+	for i, arg := range args {
+		integer, ok := arg.(*object.Integer)
+		if !ok { return 0, 0, newError("Argument to '%s' must be INTEGER, got %s", name, arg.Type()) }
+
+		index := integer.Value
+		if index < 0 { index += int64(length) } // Count back from the end
+		if index < 0 { index = 0 }
+		if index > int64(length) { index = int64(length) }
+		bounds[i] = int(index)
+	}
+
+	if bounds[1] < bounds[0] { bounds[1] = bounds[0] } // An empty slice rather than an error
+	return bounds[0], bounds[1], nil
+}
+
+/*
+ concat(a, b, ...) joins arrays end to end, iterators are read to the end first
+ */
+func builtinConcat(env *object.Environment, args ...object.Object) object.Object {
+	elements := []object.Object{}
+	for _, arg := range args {
+		argElements, err := sequenceElements("concat", arg)
+		if err != nil { return err }
+		elements = append(elements, argElements...)
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+/*
+ flatten(arr) splices nested arrays into their parent all the way down
+ flatten(arr, depth) only flattens depth levels
+ */
+func builtinFlatten(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=1 or 2", len(args)) }
+	if args[0].Type() != object.ARRAY_OBJECT { return newError("Argument to 'flatten' must be ARRAY, got %s", args[0].Type()) }
+
+	depth := int64(-1) // Negative means no limit
+	if len(args) == 2 {
+		integer, ok := args[1].(*object.Integer)
+		if !ok { return newError("Argument to 'flatten' must be INTEGER, got %s", args[1].Type()) }
+		depth = integer.Value
+	}
+
+	return &object.Array{Elements: flatten(args[0].(*object.Array).Elements, depth)}
+}
+
+func flatten(elements []object.Object, depth int64) []object.Object {
+	flattened := []object.Object{}
+	for _, element := range elements {
+		nested, ok := element.(*object.Array)
+		if !ok || depth == 0 {
+			flattened = append(flattened, element)
+			continue
+		}
+		flattened = append(flattened, flatten(nested.Elements, depth - 1)...)
+	}
+
+	return flattened
+}
+
+/*
+ unique(arr) drops every element equal to one earlier in the array
+ */
+func builtinUnique(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	elements, err := sequenceElements("unique", args[0])
+	if err != nil { return err }
+
+	seen := object.NewHash() // Hashable elements are deduplicated in O(1), anything else by scanning what's been kept
+	unique := &object.Array{Elements: []object.Object{}}
+	for _, element := range elements {
+		if key, ok := element.(object.Hashable); ok {
+			if _, duplicate := seen.Get(key); duplicate { continue }
+			seen.Set(key, TRUE)
+		} else if indexOf(unique, element) >= 0 {
+			continue
+		}
+		unique.Elements = append(unique.Elements, element)
+	}
+
+	return unique
+}
+
+/*
+ group_by(arr, f) buckets the elements into a hash keyed by f(element)
+ Groups appear in the order their first element did
+ */
+func builtinGroupBy(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+	sequence, fn, err := sequenceAndFunctionArgs("group_by", args)
+	if err != nil { return err }
+
+	groups := object.NewHash()
+	failure := eachElement(sequence, func(element object.Object) object.Object {
+		result := applyFunction(fn, []object.Object{element}, env)
+		if isError(result) { return result }
+
+		key, ok := result.(object.Hashable)
+		if !ok { return newError("Type %s is not hashable", result.Type()) }
+
+		group, ok := groups.Get(key)
+		if !ok {
+			group = &object.Array{Elements: []object.Object{}}
+			groups.Set(key, group)
+		}
+		group.(*object.Array).Elements = append(group.(*object.Array).Elements, element)
+		return nil
+	})
+	if failure != nil { return failure }
+
+	return groups
+}
+
+/*
+ Validate the (array or iterator, function) arguments shared by most higher-order builtins
+ */
+func sequenceAndFunctionArgs(name string, args []object.Object) (object.Object, object.Object, *object.Error) {
+	if args[0].Type() != object.ARRAY_OBJECT && args[0].Type() != object.ITERATOR_OBJECT {
+		return nil, nil, newError("Argument to '%s' must be ARRAY or ITERATOR, got %s", name, args[0].Type())
+	}
+	if !isCallable(args[1]) { return nil, nil, newError("Argument to '%s' must be FUNCTION, got %s", name, args[1].Type()) }
+
+	return args[0], args[1], nil
+}
+
+func isCallable(obj object.Object) bool {
+	return obj.Type() == object.FUNCTION_OBJECT || obj.Type() == object.BUILTIN_OBJECT || obj.Type() == object.STRUCT_TYPE_OBJECT
+}
@@ -0,0 +1,127 @@
+package evaluator
+
+import (
+	"fmt"
+	"mockc/object"
+	"strings"
+)
+
+// Formatted output builtins. Output goes through the interpreter's Runtime, so hosts and tests can capture it
+func init() {
+	builtins["printf"] = &object.BuiltIn{Fn: builtinPrintf}
+	builtins["sprintf"] = &object.BuiltIn{Fn: builtinSprintf}
+	builtins["eprint"] = &object.BuiltIn{Fn: builtinEprint}
+}
+
+/*
+ printf(format, args...) writes the formatted string to stdout, without adding a newline
+ */
+func builtinPrintf(env *object.Environment, args ...object.Object) object.Object {
+	formatted, err := formatArgs("printf", args)
+	if err != nil { return err }
+
+	fmt.Fprint(env.Runtime().Stdout, formatted)
+	return NEWLINE
+}
+
+/*
+ sprintf(format, args...) returns the formatted string. Verbs are written like Go's and can take the same flags, width
+ and precision, ex. %-8s or %05d:
+   %v  any value as the REPL would print it
+   %s  a string
+   %q  a string in double quotes with escapes
+   %d  an integer in base 10, %b %o %x %X in base 2, 8 and 16
+   %t  a boolean
+   %%  a literal percent sign
+ */
+func builtinSprintf(env *object.Environment, args ...object.Object) object.Object {
+	formatted, err := formatArgs("sprintf", args)
+	if err != nil { return err }
+
+	return &object.String{Value: formatted}
+}
+
+/*
+ eprint(args...) is print for stderr, each argument on its own line
+ */
+func builtinEprint(env *object.Environment, args ...object.Object) object.Object {
+	for _, arg := range args { fmt.Fprintln(env.Runtime().Stderr, arg.Inspect()) }
+	return NEWLINE
+}
+
+/*
+ Shared argument handling for printf and sprintf, the format string followed by the values for its verbs
+ */
+func formatArgs(name string, args []object.Object) (string, *object.Error) {
+	if len(args) < 1 { return "", newError("Wrong number of arguments. got=%d, want=1 or more", len(args)) }
+	format, ok := args[0].(*object.String)
+	if !ok { return "", newError("Argument to '%s' must be STRING, got %s", name, args[0].Type()) }
+
+	return formatValues(format.Value, args[1:])
+}
+
+func formatValues(format string, args []object.Object) (string, *object.Error) {
+	var out strings.Builder
+	next := 0
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			out.WriteByte(format[i])
+			continue
+		}
+
+		start := i
+		i++
+		for i < len(format) && strings.IndexByte("-+# 0.123456789", format[i]) >= 0 { i++ } // Flags, width and precision
+		if i == len(format) { return "", newError("Format ends in the middle of verb %s", format[start:]) }
+
+		verb := format[i]
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+		if next == len(args) { return "", newError("Missing argument for verb %s", format[start:i + 1]) }
+
+		formatted, err := formatValue(format[start:i], verb, args[next])
+		if err != nil { return "", err }
+		out.WriteString(formatted)
+		next++
+	}
+
+	if next < len(args) { return "", newError("Too many arguments for format. got=%d, used=%d", len(args), next) }
+
+	return out.String(), nil
+}
+
+/*
+ Check that the argument fits the verb and hand it to Go's fmt as the matching Go value, spec is everything before the
+ verb including the '%'
+ */
+func formatValue(spec string, verb byte, arg object.Object) (string, *object.Error) {
+	mismatch := func(want string) *object.Error {
+		return newError("Verb %s%c expects %s, got %s", spec, verb, want, arg.Type())
+	}
+
+	switch verb {
+	case 'v':
+		return fmt.Sprintf(spec + "s", arg.Inspect()), nil
+	case 's', 'q':
+		str, ok := arg.(*object.String)
+		if !ok { return "", mismatch("STRING") }
+		return fmt.Sprintf(spec + string(verb), str.Value), nil
+	case 'd', 'b', 'o', 'x', 'X':
+		switch arg := arg.(type) {
+		case *object.Integer:
+			return fmt.Sprintf(spec + string(verb), arg.Value), nil
+		case *object.BigInteger:
+			return fmt.Sprintf(spec + string(verb), arg.Value), nil
+		}
+		return "", mismatch("INTEGER")
+	case 't':
+		boolean, ok := arg.(*object.Boolean)
+		if !ok { return "", mismatch("BOOLEAN") }
+		return fmt.Sprintf(spec + "t", boolean.Value), nil
+	default:
+		return "", newError("Unknown format verb %s%c", spec, verb)
+	}
+}
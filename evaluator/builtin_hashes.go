@@ -0,0 +1,173 @@
+package evaluator
+
+import "mockc/object"
+
+// Hash builtins. Hashes are never modified in place, anything that changes a hash returns a new one. Every result
+// follows the insertion order of its input, so keys(h), values(h) and entries(h) always line up with each other
+func init() {
+	hashBuiltins := map[string]object.BuiltInFunction{
+		"keys":         builtinKeys,
+		"values":       builtinValues,
+		"entries":      builtinEntries,
+		"has":          builtinHas,
+		"get":          builtinGet,
+		"delete":       builtinDelete,
+		"merge":        builtinMerge,
+		"map_values":   builtinMapValues,
+		"from_entries": builtinFromEntries,
+	}
+
+	for name, fn := range hashBuiltins { builtins[name] = &object.BuiltIn{Fn: fn} }
+}
+
+func builtinKeys(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	hash, err := hashArg("keys", args[0])
+	if err != nil { return err }
+
+	keys := []object.Object{}
+	for _, pair := range hash.Pairs() { keys = append(keys, pair.Key) }
+
+	return &object.Array{Elements: keys}
+}
+
+func builtinValues(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	hash, err := hashArg("values", args[0])
+	if err != nil { return err }
+
+	values := []object.Object{}
+	for _, pair := range hash.Pairs() { values = append(values, pair.Value) }
+
+	return &object.Array{Elements: values}
+}
+
+/*
+ entries(h) returns the pairs of h as an array of [key, value] arrays, the inverse of from_entries
+ */
+func builtinEntries(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	hash, err := hashArg("entries", args[0])
+	if err != nil { return err }
+
+	entries := []object.Object{}
+	for _, pair := range hash.Pairs() {
+		entries = append(entries, &object.Array{Elements: []object.Object{pair.Key, pair.Value}})
+	}
+
+	return &object.Array{Elements: entries}
+}
+
+/*
+ has(h, key) tells a missing key apart from one holding null, which h[key] can't
+ */
+func builtinHas(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+	hash, key, err := hashAndKeyArgs("has", args)
+	if err != nil { return err }
+
+	_, ok := hash.Get(key)
+	return nativeBoolToBooleanObject(ok)
+}
+
+/*
+ get(h, key) is the same as h[key], get(h, key, default) returns default instead of null when key is missing
+ */
+func builtinGet(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 { return newError("Wrong number of arguments. got=%d, want=2 or 3", len(args)) }
+	hash, key, err := hashAndKeyArgs("get", args)
+	if err != nil { return err }
+
+	if value, ok := hash.Get(key); ok { return value }
+	if len(args) == 3 { return args[2] }
+
+	return NULL
+}
+
+/*
+ delete(h, key) returns a copy of h without key, the remaining pairs keep their order
+ */
+func builtinDelete(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+	hash, key, err := hashAndKeyArgs("delete", args)
+	if err != nil { return err }
+
+	return hash.Without(key)
+}
+
+/*
+ merge(a, b, ...) combines hashes left to right, later values win
+ Keys keep the position they had in the first hash they appeared in
+ */
+func builtinMerge(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) < 1 { return newError("Wrong number of arguments. got=%d, want=1 or more", len(args)) }
+
+	result := object.NewHash()
+	for _, arg := range args {
+		hash, err := hashArg("merge", arg)
+		if err != nil { return err }
+
+		for _, pair := range hash.Pairs() { result.Set(pair.Key.(object.Hashable), pair.Value) }
+	}
+
+	return result
+}
+
+/*
+ map_values(h, f) returns a hash with the same keys and f(value) for each value
+ */
+func builtinMapValues(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+	hash, err := hashArg("map_values", args[0])
+	if err != nil { return err }
+	if !isCallable(args[1]) { return newError("Argument to 'map_values' must be FUNCTION, got %s", args[1].Type()) }
+
+	result := object.NewHash()
+	for _, pair := range hash.Pairs() {
+		value := applyFunction(args[1], []object.Object{pair.Value}, env)
+		if isError(value) { return value }
+		result.Set(pair.Key.(object.Hashable), value)
+	}
+
+	return result
+}
+
+/*
+ from_entries(arr) builds a hash from an array of [key, value] arrays, in array order
+ */
+func builtinFromEntries(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	if args[0].Type() != object.ARRAY_OBJECT { return newError("Argument to 'from_entries' must be ARRAY, got %s", args[0].Type()) }
+
+	result := object.NewHash()
+	for _, element := range args[0].(*object.Array).Elements {
+		entry, ok := element.(*object.Array)
+		if !ok || len(entry.Elements) != 2 { return newError("Entries passed to 'from_entries' must be [key, value], got %s", element.Inspect()) }
+
+		key, ok := entry.Elements[0].(object.Hashable)
+		if !ok { return newError("Type %s is not hashable", entry.Elements[0].Type()) }
+		result.Set(key, entry.Elements[1])
+	}
+
+	return result
+}
+
+func hashArg(name string, arg object.Object) (*object.Hash, *object.Error) {
+	hash, ok := arg.(*object.Hash)
+	if !ok { return nil, newError("Argument to '%s' must be HASH, got %s", name, arg.Type()) }
+
+	return hash, nil
+}
+
+/*
+ Validate the (hash, key) arguments shared by has, get and delete
+ */
+func hashAndKeyArgs(name string, args []object.Object) (*object.Hash, object.Hashable, *object.Error) {
+	hash, err := hashArg(name, args[0])
+	if err != nil { return nil, nil, err }
+
+	key, ok := args[1].(object.Hashable)
+	if !ok { return nil, nil, newError("Type %s is not hashable", args[1].Type()) }
+
+	return hash, key, nil
+}
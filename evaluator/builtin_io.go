@@ -0,0 +1,188 @@
+package evaluator
+
+import (
+	"io"
+	"mockc/object"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File and process builtins. Everything here goes through the Policy of the interpreter's Runtime, which denies all of
+// it unless the host grants it, so embedding programs stay in control of what scripts can touch
+func init() {
+	ioBuiltins := map[string]object.BuiltInFunction{
+		"read_file":  builtinReadFile,
+		"write_file": builtinWriteFile,
+		"list_dir":   builtinListDir,
+		"exists":     builtinExists,
+		"getenv":     builtinGetenv,
+		"read_line":  builtinReadLine,
+		"exit":       builtinExit,
+	}
+
+	for name, fn := range ioBuiltins { builtins[name] = &object.BuiltIn{Fn: fn} }
+}
+
+/*
+ read_file(path) returns the whole file as a string
+ */
+func builtinReadFile(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	path, err := allowedPath(env, "read_file", args[0], false)
+	if err != nil { return err }
+
+	content, readErr := os.ReadFile(path)
+	if readErr != nil { return ioError("read_file", readErr) }
+
+	return &object.String{Value: string(content)}
+}
+
+/*
+ write_file(path, content) creates or replaces the file, the directory it goes in must already exist
+ */
+func builtinWriteFile(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+	content, ok := args[1].(*object.String)
+	if !ok { return newError("Argument to 'write_file' must be STRING, got %s", args[1].Type()) }
+	path, err := allowedPath(env, "write_file", args[0], true)
+	if err != nil { return err }
+
+	if writeErr := os.WriteFile(path, []byte(content.Value), 0644); writeErr != nil { return ioError("write_file", writeErr) }
+
+	return NULL
+}
+
+/*
+ list_dir(path) returns the names of the directory's entries in sorted order
+ */
+func builtinListDir(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	path, err := allowedPath(env, "list_dir", args[0], false)
+	if err != nil { return err }
+
+	entries, readErr := os.ReadDir(path) // Already sorted by name
+	if readErr != nil { return ioError("list_dir", readErr) }
+
+	names := make([]string, len(entries))
+	for i, entry := range entries { names[i] = entry.Name() }
+
+	return stringsToArray(names)
+}
+
+/*
+ exists(path) checks for a file or directory. Paths outside the allowed directories are an error rather than false,
+ so scripts can't probe the rest of the file system
+ */
+func builtinExists(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	path, err := allowedPath(env, "exists", args[0], false)
+	if err != nil { return err }
+
+	_, statErr := os.Stat(path)
+	return nativeBoolToBooleanObject(statErr == nil)
+}
+
+/*
+ getenv(name) returns the variable's value or null if it's unset, getenv(name, default) returns default instead
+ */
+func builtinGetenv(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=1 or 2", len(args)) }
+	name, ok := args[0].(*object.String)
+	if !ok { return newError("Argument to 'getenv' must be STRING, got %s", args[0].Type()) }
+	if !env.Runtime().Policy.AllowEnv { return newError("Permission denied: 'getenv' is not allowed") }
+
+	if value, ok := os.LookupEnv(name.Value); ok { return &object.String{Value: value} }
+	if len(args) == 2 { return args[1] }
+
+	return NULL
+}
+
+/*
+ read_line() returns the next line of input without its line ending, or null once the input is used up
+ */
+func builtinReadLine(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 0 { return newError("Wrong number of arguments. got=%d, want=0", len(args)) }
+	stdin := env.Runtime().Stdin
+	if stdin == nil { return newError("Permission denied: 'read_line' has no input") }
+
+	line, err := stdin.ReadString('\n')
+	if err == io.EOF && line == "" { return NULL }
+	if err != nil && err != io.EOF { return ioError("read_line", err) }
+
+	line = strings.TrimSuffix(line, "\n")
+	return &object.String{Value: strings.TrimSuffix(line, "\r")}
+}
+
+/*
+ exit(code) asks the host to end the program with a status code
+ If the host's Exit hook returns, evaluation still stops with an error so nothing after exit() runs
+ */
+func builtinExit(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	code, ok := args[0].(*object.Integer)
+	if !ok { return newError("Argument to 'exit' must be INTEGER, got %s", args[0].Type()) }
+
+	exit := env.Runtime().Exit
+	if exit == nil { return newError("Permission denied: 'exit' is not allowed") }
+
+	exit(int(code.Value))
+	return newError("Program exited with code %d", code.Value)
+}
+
+/*
+ Resolve a path argument and check it against the policy. Symlinks are followed before checking so a link inside an
+ allowed directory can't point outside of it. A file that doesn't exist yet is checked through its directory, and a link
+ to one through the directory it points into
+ */
+func allowedPath(env *object.Environment, name string, arg object.Object, write bool) (string, *object.Error) {
+	str, ok := arg.(*object.String)
+	if !ok { return "", newError("Argument to '%s' must be STRING, got %s", name, arg.Type()) }
+
+	policy := env.Runtime().Policy
+	if write && policy.ReadOnly { return "", newError("Permission denied: '%s' is not allowed in read-only mode", name) }
+
+	path, err := resolvePath(str.Value)
+	if err != nil { return "", ioError(name, err) }
+
+	for _, dir := range policy.AllowedDirs {
+		allowed, err := resolvePath(dir)
+		if err != nil { continue } // A missing allowed directory can't contain anything
+
+		if path == allowed || strings.HasPrefix(path, allowed + string(filepath.Separator)) { return path, nil }
+	}
+
+	return "", newError("Permission denied: '%s' cannot access %s", name, str.Value)
+}
+
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil { return "", err }
+
+	resolved, err := filepath.EvalSymlinks(abs)
+	if os.IsNotExist(err) { // Resolve the parent instead and put the missing name back on
+		parent, err := filepath.EvalSymlinks(filepath.Dir(abs))
+		if err != nil { return "", err }
+
+		// A dangling link is still followed by writes, so check where it points rather than the link itself
+		if info, err := os.Lstat(abs); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(abs)
+			if err != nil { return "", err }
+			if !filepath.IsAbs(target) { target = filepath.Join(parent, target) }
+			return resolvePath(target)
+		}
+
+		return filepath.Join(parent, filepath.Base(abs)), nil
+	}
+
+	return resolved, err
+}
+
+/*
+ Report an OS error without Go's "open /abs/path:" prefix noise, keeping only the reason
+ */
+func ioError(name string, err error) *object.Error {
+	if pathErr, ok := err.(*os.PathError); ok { err = pathErr.Err }
+
+	return newError("'%s' failed: %s", name, err.Error())
+}
@@ -0,0 +1,160 @@
+package evaluator
+
+import "mockc/object"
+
+// Iterator builtins. Iterators come from generators or iter(), and are read lazily: nothing is produced until it's
+// asked for, so an iterator can describe a sequence that never ends as long as only part of it is read
+func init() {
+	iteratorBuiltins := map[string]object.BuiltInFunction{
+		"next":    builtinNext,
+		"iter":    builtinIter,
+		"collect": builtinCollect,
+		"take":    builtinTake,
+		"count":   builtinCount,
+	}
+
+	for name, fn := range iteratorBuiltins { builtins[name] = &object.BuiltIn{Fn: fn} }
+}
+
+/*
+ next(it) reads the next value of an iterator, or null once it's used up
+ next(it, default) returns default instead of null, for sequences that can contain null
+ */
+func builtinNext(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=1 or 2", len(args)) }
+	iterator, ok := args[0].(*object.Iterator)
+	if !ok { return newError("Argument to 'next' must be ITERATOR, got %s", args[0].Type()) }
+
+	value, ok := iterator.Next()
+	if ok { return value }
+	if len(args) == 2 { return args[1] }
+	return NULL
+}
+
+/*
+ iter(x) returns an iterator over the elements of an array, the characters of a string or the keys of a hash, in the
+ same order a for loop would visit them
+ */
+func builtinIter(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+
+	iterator, ok := toIterator(args[0])
+	if !ok { return newError("Argument to 'iter' must be ARRAY, STRING, HASH, CHANNEL or ITERATOR, got %s", args[0].Type()) }
+	return iterator
+}
+
+/*
+ collect(it) reads every remaining value of an iterator into an array
+ */
+func builtinCollect(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+
+	elements, err := sequenceElements("collect", args[0])
+	if err != nil { return err }
+	return &object.Array{Elements: elements}
+}
+
+/*
+ take(it, n) is an iterator over the first n values of it, which is closed after the nth. take(arr, n) is the first n
+ elements of an array
+ */
+func builtinTake(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+	count, ok := args[1].(*object.Integer)
+	if !ok { return newError("Argument to 'take' must be INTEGER, got %s", args[1].Type()) }
+	if count.Value < 0 { return newError("Count for 'take' must not be negative, got %d", count.Value) }
+
+	switch source := args[0].(type) {
+	case *object.Array:
+		end := int(count.Value)
+		if end > len(source.Elements) { end = len(source.Elements) }
+		return sliceArray(source, 0, end)
+
+	case *object.Iterator:
+		remaining := count.Value
+		if remaining == 0 { source.Close() }
+		return object.NewIterator(func() (object.Object, bool) {
+			if remaining <= 0 { return nil, false }
+			remaining--
+			value, ok := source.Next()
+			if remaining == 0 { source.Close() } // Nothing more will be read, so let a generator finish now
+			return value, ok
+		}, source.Close)
+
+	default:
+		return newError("Argument to 'take' must be ARRAY or ITERATOR, got %s", args[0].Type())
+	}
+}
+
+/*
+ count(), count(start) and count(start, step) count up from start, or 0, forever. A negative step counts down
+ */
+func builtinCount(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) > 2 { return newError("Wrong number of arguments. got=%d, want=0 to 2", len(args)) }
+
+	bounds := []int64{0, 1}
+	for i, arg := range args {
+		integer, ok := arg.(*object.Integer)
+		if !ok { return newError("Argument to 'count' must be INTEGER, got %s", arg.Type()) }
+		bounds[i] = integer.Value
+	}
+
+	current := object.Object(&object.Integer{Value: bounds[0]})
+	step := &object.Integer{Value: bounds[1]}
+	return object.NewIterator(func() (object.Object, bool) {
+		value := current
+		current = evalInfixExpression(current, "+", step) // Carries on into big integers rather than overflowing
+		return value, true
+	}, nil)
+}
+
+var iteratorLimit = MAX_LENGTH // Only changed by tests, which would otherwise read millions of values to reach it
+
+/*
+ Every element of an array or every remaining value of an iterator, for builtins that need the whole sequence at once
+ An iterator with more than MAX_LENGTH values left is an error, ex. collect(count()) would never finish
+ */
+func sequenceElements(name string, arg object.Object) ([]object.Object, object.Object) {
+	switch arg := arg.(type) {
+	case *object.Array:
+		return arg.Elements, nil
+
+	case *object.Iterator:
+		elements := []object.Object{}
+		for {
+			value, ok := arg.Next()
+			if !ok { return elements, nil }
+			if isError(value) { return nil, value }
+			if len(elements) == iteratorLimit {
+				arg.Close()
+				return nil, newError("Iterator passed to '%s' is too long, the limit is %d values", name, iteratorLimit)
+			}
+			elements = append(elements, value)
+		}
+
+	default:
+		return nil, newError("Argument to '%s' must be ARRAY or ITERATOR, got %s", name, arg.Type())
+	}
+}
+
+/*
+ Call visit with each element of an array or iterator in turn, stopping early at the first non-nil result, which is
+ returned. An iterator left with values in it is closed
+ */
+func eachElement(sequence object.Object, visit func(object.Object) object.Object) object.Object {
+	if arr, ok := sequence.(*object.Array); ok {
+		for _, element := range arr.Elements {
+			if result := visit(element); result != nil { return result }
+		}
+		return nil
+	}
+
+	iterator := sequence.(*object.Iterator)
+	defer iterator.Close()
+	for {
+		value, ok := iterator.Next()
+		if !ok { return nil }
+		if isError(value) { return value }
+		if result := visit(value); result != nil { return result }
+	}
+}
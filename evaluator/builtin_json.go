@@ -0,0 +1,259 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"mockc/object"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSON builtins. Objects become hashes that keep the key order of the document, and only integers are supported as
+// numbers since Moxie has no floats
+func init() {
+	builtins["json_parse"] = &object.BuiltIn{Fn: builtinJSONParse}
+	builtins["json_stringify"] = &object.BuiltIn{Fn: builtinJSONStringify}
+}
+
+/*
+ json_parse(str) decodes a JSON document into hashes, arrays, strings, integers, booleans and null
+ */
+func builtinJSONParse(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	str, ok := args[0].(*object.String)
+	if !ok { return newError("Argument to 'json_parse' must be STRING, got %s", args[0].Type()) }
+
+	decoder := json.NewDecoder(strings.NewReader(str.Value))
+	decoder.UseNumber() // Keep the number's text so big integers don't lose precision through float64
+
+	parser := &jsonParser{decoder: decoder, input: str.Value}
+	value := parser.parseValue()
+	if isError(value) { return value }
+
+	trailing := parser.tokenStart(decoder.InputOffset())
+	if _, err := decoder.Token(); err != io.EOF { // Only one value is allowed per document
+		return parser.errorAt(trailing, "Unexpected data after JSON value")
+	}
+
+	return value
+}
+
+type jsonParser struct {
+	decoder *json.Decoder
+	input   string
+}
+
+func (jp *jsonParser) parseValue() object.Object {
+	offset := jp.tokenStart(jp.decoder.InputOffset())
+	tok, err := jp.decoder.Token()
+	if err != nil { return jp.decodeError(err, offset) }
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '[' { return jp.parseArray() }
+		return jp.parseObject() // Token only hands out the opening delimiters here, closing ones end the loops below
+	case json.Number:
+		return jp.parseNumber(tok, offset)
+	case string:
+		return &object.String{Value: tok}
+	case bool:
+		return nativeBoolToBooleanObject(tok)
+	default: // nil is the only other token Token produces
+		return NULL
+	}
+}
+
+func (jp *jsonParser) parseArray() object.Object {
+	elements := []object.Object{}
+	for jp.decoder.More() {
+		element := jp.parseValue()
+		if isError(element) { return element }
+		elements = append(elements, element)
+	}
+
+	if err := jp.closeDelimiter(); err != nil { return err }
+	return &object.Array{Elements: elements}
+}
+
+func (jp *jsonParser) parseObject() object.Object {
+	hash := object.NewHash()
+	for jp.decoder.More() {
+		offset := jp.decoder.InputOffset()
+		key, err := jp.decoder.Token()
+		if err != nil { return jp.decodeError(err, offset) }
+
+		value := jp.parseValue()
+		if isError(value) { return value }
+		hash.Set(&object.String{Value: key.(string)}, value) // Token guarantees object keys are strings
+	}
+
+	if err := jp.closeDelimiter(); err != nil { return err }
+	return hash
+}
+
+func (jp *jsonParser) closeDelimiter() *object.Error {
+	offset := jp.decoder.InputOffset()
+	if _, err := jp.decoder.Token(); err != nil { return jp.decodeError(err, offset) }
+
+	return nil
+}
+
+/*
+ JSON numbers may be written with fractions or exponents, which is fine as long as the value is a whole number
+ Exponents are bounded first since expanding 1e5000000 would build a five million digit number
+ */
+func (jp *jsonParser) parseNumber(number json.Number, offset int64) object.Object {
+	if value, err := number.Int64(); err == nil { return &object.Integer{Value: value} }
+
+	if e := strings.IndexAny(number.String(), "eE"); e >= 0 {
+		exponent, err := strconv.ParseInt(number.String()[e+1:], 10, 64)
+		if err != nil || exponent > MAX_EXPONENT || exponent < -MAX_EXPONENT {
+			return jp.errorAt(offset, "JSON number %s is out of range", number.String())
+		}
+	}
+
+	rat, ok := new(big.Rat).SetString(number.String())
+	if !ok || !rat.IsInt() {
+		return jp.errorAt(offset, "JSON number %s is not an integer", number.String())
+	}
+
+	return normalizeBigInteger(rat.Num())
+}
+
+/*
+ InputOffset points just past the previous token, skip the whitespace and separators after it so errors point at the
+ token itself
+ */
+func (jp *jsonParser) tokenStart(offset int64) int64 {
+	for offset < int64(len(jp.input)) && strings.IndexByte(" \t\r\n,:", jp.input[offset]) >= 0 { offset++ }
+
+	return offset
+}
+
+/*
+ Turn a decoder error into a Moxie error pointing at where it happened
+ */
+func (jp *jsonParser) decodeError(err error, offset int64) *object.Error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Offset < int64(len(jp.input)) {
+		return jp.errorAt(syntaxErr.Offset - 1, "Invalid JSON: %s", syntaxErr.Error()) // Offset is just past the bad byte
+	}
+	if errors.As(err, &syntaxErr) || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return jp.errorAt(int64(len(jp.input)), "Unexpected end of JSON input")
+	}
+
+	return jp.errorAt(offset, "Invalid JSON: %s", err.Error())
+}
+
+/*
+ Build an error with the line and column of a byte offset in the input, both counted from 1
+ */
+func (jp *jsonParser) errorAt(offset int64, format string, a ...interface{}) *object.Error {
+	if offset > int64(len(jp.input)) { offset = int64(len(jp.input)) }
+
+	before := jp.input[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndex(before, "\n") + 1:]) + 1
+
+	return newError(format + " at line %d, column %d", append(a, line, column)...)
+}
+
+const MAX_EXPONENT = 10000 // Largest exponent json_parse accepts in either direction, enough for any sane integer
+const MAX_INDENT = 10 // The same limit as JavaScript's JSON.stringify, which truncates where this is an error
+
+/*
+ json_stringify(value) encodes a value as compact JSON
+ json_stringify(value, indent) pretty prints it, indent is up to 10 spaces or the string of up to 10 characters to
+ indent with
+ */
+func builtinJSONStringify(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=1 or 2", len(args)) }
+
+	indent := ""
+	if len(args) == 2 {
+		switch arg := args[1].(type) {
+		case *object.Integer:
+			if arg.Value < 0 || arg.Value > MAX_INDENT { return newError("Indent for 'json_stringify' must be 0 to %d, got %d", MAX_INDENT, arg.Value) }
+			indent = strings.Repeat(" ", int(arg.Value))
+		case *object.String:
+			if utf8.RuneCountInString(arg.Value) > MAX_INDENT {
+				return newError("Indent for 'json_stringify' must be at most %d characters, got %q", MAX_INDENT, arg.Value)
+			}
+			indent = arg.Value
+		default:
+			return newError("Argument to 'json_stringify' must be INTEGER or STRING, got %s", arg.Type())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeJSON(&out, args[0], indent, 0); err != nil { return err }
+
+	return &object.String{Value: out.String()}
+}
+
+func writeJSON(out *bytes.Buffer, value object.Object, indent string, depth int) *object.Error {
+	switch value := value.(type) {
+	case *object.Integer, *object.BigInteger, *object.Boolean:
+		out.WriteString(value.Inspect())
+	case *object.Null:
+		out.WriteString("null")
+	case *object.String:
+		writeJSONString(out, value.Value)
+	case *object.Array:
+		if len(value.Elements) == 0 {
+			out.WriteString("[]")
+			return nil
+		}
+
+		out.WriteString("[")
+		for i, element := range value.Elements {
+			if i > 0 { out.WriteString(",") }
+			writeJSONNewline(out, indent, depth + 1)
+			if err := writeJSON(out, element, indent, depth + 1); err != nil { return err }
+		}
+		writeJSONNewline(out, indent, depth)
+		out.WriteString("]")
+	case *object.Hash:
+		if value.Len() == 0 {
+			out.WriteString("{}")
+			return nil
+		}
+
+		out.WriteString("{")
+		for i, pair := range value.Pairs() {
+			key, ok := pair.Key.(*object.String)
+			if !ok { return newError("JSON object keys must be STRING, got %s", pair.Key.Type()) }
+
+			if i > 0 { out.WriteString(",") }
+			writeJSONNewline(out, indent, depth + 1)
+			writeJSONString(out, key.Value)
+			out.WriteString(":")
+			if indent != "" { out.WriteString(" ") }
+			if err := writeJSON(out, pair.Value, indent, depth + 1); err != nil { return err }
+		}
+		writeJSONNewline(out, indent, depth)
+		out.WriteString("}")
+	default:
+		return newError("Cannot convert %s to JSON", value.Type())
+	}
+
+	return nil
+}
+
+func writeJSONNewline(out *bytes.Buffer, indent string, depth int) {
+	if indent == "" { return } // Compact output stays on one line
+
+	out.WriteString("\n")
+	out.WriteString(strings.Repeat(indent, depth))
+}
+
+func writeJSONString(out *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false) // Leave <, > and & readable, this isn't going into a web page
+	encoder.Encode(s)
+	out.Truncate(out.Len() - 1) // Encode always ends with a newline
+}
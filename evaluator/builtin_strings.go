@@ -0,0 +1,276 @@
+package evaluator
+
+import (
+	"mockc/object"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// String builtins. Indexes, lengths and widths all count characters (runes) rather than bytes, so multi-byte UTF-8
+// text behaves the same as ASCII
+func init() {
+	stringBuiltins := map[string]object.BuiltInFunction{
+		"split":       builtinSplit,
+		"join":        builtinJoin,
+		"trim":        builtinTrim,
+		"trim_left":   builtinTrimLeft,
+		"trim_right":  builtinTrimRight,
+		"trim_prefix": builtinTrimPrefix,
+		"trim_suffix": builtinTrimSuffix,
+		"upper":       builtinUpper,
+		"lower":       builtinLower,
+		"replace":     builtinReplace,
+		"starts_with": builtinStartsWith,
+		"ends_with":   builtinEndsWith,
+		"repeat":      builtinRepeat,
+		"substring":   builtinSubstring,
+		"pad_left":    builtinPadLeft,
+		"pad_right":   builtinPadRight,
+		"chars":       builtinChars,
+	}
+
+	for name, fn := range stringBuiltins { builtins[name] = &object.BuiltIn{Fn: fn} }
+}
+
+/*
+ split(s) splits around runs of whitespace
+ split(s, sep) splits around every sep, an empty sep splits into characters
+ */
+func builtinSplit(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=1 or 2", len(args)) }
+	strs, err := stringArgs("split", args)
+	if err != nil { return err }
+
+	var parts []string
+	if len(strs) == 1 {
+		parts = strings.Fields(strs[0])
+	} else {
+		parts = strings.Split(strs[0], strs[1])
+	}
+
+	return stringsToArray(parts)
+}
+
+/*
+ join(arr, sep) joins an array of strings with sep between each
+ */
+func builtinJoin(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=1 or 2", len(args)) }
+	if args[0].Type() != object.ARRAY_OBJECT { return newError("Argument to 'join' must be ARRAY, got %s", args[0].Type()) }
+
+	separator := ""
+	if len(args) == 2 {
+		sep, ok := args[1].(*object.String)
+		if !ok { return newError("Argument to 'join' must be STRING, got %s", args[1].Type()) }
+		separator = sep.Value
+	}
+
+	parts := []string{}
+	for _, element := range args[0].(*object.Array).Elements {
+		str, ok := element.(*object.String)
+		if !ok { return newError("Elements passed to 'join' must be STRING, got %s", element.Type()) }
+		parts = append(parts, str.Value)
+	}
+
+	return &object.String{Value: strings.Join(parts, separator)}
+}
+
+/*
+ trim(s) strips leading and trailing whitespace, trim(s, cutset) strips any of the characters in cutset instead
+ */
+func builtinTrim(env *object.Environment, args ...object.Object) object.Object {
+	return trimWith("trim", args, strings.TrimSpace, strings.Trim)
+}
+
+func builtinTrimLeft(env *object.Environment, args ...object.Object) object.Object {
+	trimSpace := func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) }
+	return trimWith("trim_left", args, trimSpace, strings.TrimLeft)
+}
+
+func builtinTrimRight(env *object.Environment, args ...object.Object) object.Object {
+	trimSpace := func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }
+	return trimWith("trim_right", args, trimSpace, strings.TrimRight)
+}
+
+func trimWith(name string, args []object.Object, space func(string) string, cutset func(string, string) string) object.Object {
+	if len(args) != 1 && len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=1 or 2", len(args)) }
+	strs, err := stringArgs(name, args)
+	if err != nil { return err }
+
+	if len(strs) == 1 { return &object.String{Value: space(strs[0])} }
+	return &object.String{Value: cutset(strs[0], strs[1])}
+}
+
+/*
+ trim_prefix(s, prefix) and trim_suffix(s, suffix) remove one exact occurrence from that end if it's there
+ */
+func builtinTrimPrefix(env *object.Environment, args ...object.Object) object.Object {
+	return stringPairBuiltin("trim_prefix", args, func(s, prefix string) object.Object {
+		return &object.String{Value: strings.TrimPrefix(s, prefix)}
+	})
+}
+
+func builtinTrimSuffix(env *object.Environment, args ...object.Object) object.Object {
+	return stringPairBuiltin("trim_suffix", args, func(s, suffix string) object.Object {
+		return &object.String{Value: strings.TrimSuffix(s, suffix)}
+	})
+}
+
+func builtinUpper(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	strs, err := stringArgs("upper", args)
+	if err != nil { return err }
+
+	return &object.String{Value: strings.ToUpper(strs[0])}
+}
+
+func builtinLower(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	strs, err := stringArgs("lower", args)
+	if err != nil { return err }
+
+	return &object.String{Value: strings.ToLower(strs[0])}
+}
+
+/*
+ replace(s, old, new) replaces every old with new, replace(s, old, new, n) only the first n
+ */
+func builtinReplace(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 3 && len(args) != 4 { return newError("Wrong number of arguments. got=%d, want=3 or 4", len(args)) }
+	strs, err := stringArgs("replace", args[:3])
+	if err != nil { return err }
+
+	count := -1 // strings.Replace treats a negative count as no limit
+	if len(args) == 4 {
+		n, ok := args[3].(*object.Integer)
+		if !ok { return newError("Argument to 'replace' must be INTEGER, got %s", args[3].Type()) }
+		count = int(n.Value)
+	}
+
+	return &object.String{Value: strings.Replace(strs[0], strs[1], strs[2], count)}
+}
+
+func builtinStartsWith(env *object.Environment, args ...object.Object) object.Object {
+	return stringPairBuiltin("starts_with", args, func(s, prefix string) object.Object {
+		return nativeBoolToBooleanObject(strings.HasPrefix(s, prefix))
+	})
+}
+
+func builtinEndsWith(env *object.Environment, args ...object.Object) object.Object {
+	return stringPairBuiltin("ends_with", args, func(s, suffix string) object.Object {
+		return nativeBoolToBooleanObject(strings.HasSuffix(s, suffix))
+	})
+}
+
+/*
+ repeat(s, n) concatenates n copies of s
+ */
+func builtinRepeat(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+	if args[0].Type() != object.STRING_OBJECT { return newError("Argument to 'repeat' must be STRING, got %s", args[0].Type()) }
+	count, ok := args[1].(*object.Integer)
+	if !ok { return newError("Argument to 'repeat' must be INTEGER, got %s", args[1].Type()) }
+	if count.Value < 0 { return newError("Count for 'repeat' must not be negative, got %d", count.Value) }
+
+	str := args[0].(*object.String).Value
+	if str != "" && count.Value > int64(MAX_LENGTH / len(str)) { // Checked by dividing, multiplying could overflow
+		return newError("Result of 'repeat' is too long, the limit is %d bytes", MAX_LENGTH)
+	}
+
+	return &object.String{Value: strings.Repeat(str, int(count.Value))}
+}
+
+/*
+ substring(s, start) and substring(s, start, end) take the characters from start up to, but not including, end
+ Indexes follow the same rules as slice
+ */
+func builtinSubstring(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 { return newError("Wrong number of arguments. got=%d, want=2 or 3", len(args)) }
+	if args[0].Type() != object.STRING_OBJECT { return newError("Argument to 'substring' must be STRING, got %s", args[0].Type()) }
+	runes := []rune(args[0].(*object.String).Value)
+
+	start, end, err := sliceBounds("substring", args[1:], len(runes))
+	if err != nil { return err }
+
+	return &object.String{Value: string(runes[start:end])}
+}
+
+/*
+ pad_left(s, width) and pad_right(s, width) pad s with spaces until it's width characters long
+ An optional third argument pads with that string instead, cut short if it overshoots
+ */
+func builtinPadLeft(env *object.Environment, args ...object.Object) object.Object {
+	return pad("pad_left", args, func(s, padding string) string { return padding + s })
+}
+
+func builtinPadRight(env *object.Environment, args ...object.Object) object.Object {
+	return pad("pad_right", args, func(s, padding string) string { return s + padding })
+}
+
+func pad(name string, args []object.Object, join func(s, padding string) string) object.Object {
+	if len(args) != 2 && len(args) != 3 { return newError("Wrong number of arguments. got=%d, want=2 or 3", len(args)) }
+	if args[0].Type() != object.STRING_OBJECT { return newError("Argument to '%s' must be STRING, got %s", name, args[0].Type()) }
+	width, ok := args[1].(*object.Integer)
+	if !ok { return newError("Argument to '%s' must be INTEGER, got %s", name, args[1].Type()) }
+	if width.Value < 0 { return newError("Width for '%s' must not be negative, got %d", name, width.Value) }
+	if width.Value > MAX_LENGTH { return newError("Result of '%s' is too long, the limit is %d characters", name, MAX_LENGTH) }
+
+	fill := " "
+	if len(args) == 3 {
+		str, ok := args[2].(*object.String)
+		if !ok { return newError("Argument to '%s' must be STRING, got %s", name, args[2].Type()) }
+		if str.Value == "" { return newError("Padding for '%s' must not be empty", name) }
+		fill = str.Value
+	}
+
+	s := args[0].(*object.String).Value
+	missing := int(width.Value) - utf8.RuneCountInString(s)
+	if missing <= 0 { return args[0] }
+
+	padding := []rune(strings.Repeat(fill, missing / utf8.RuneCountInString(fill) + 1))[:missing]
+	return &object.String{Value: join(s, string(padding))}
+}
+
+/*
+ chars(s) splits a string into an array of one character strings
+ */
+func builtinChars(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 1 { return newError("Wrong number of arguments. got=%d, want=1", len(args)) }
+	strs, err := stringArgs("chars", args)
+	if err != nil { return err }
+
+	return stringsToArray(strings.Split(strs[0], ""))
+}
+
+/*
+ Check that every argument is a string and unwrap them
+ */
+func stringArgs(name string, args []object.Object) ([]string, *object.Error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, ok := arg.(*object.String)
+		if !ok { return nil, newError("Argument to '%s' must be STRING, got %s", name, arg.Type()) }
+		strs[i] = str.Value
+	}
+
+	return strs, nil
+}
+
+/*
+ Shared argument handling for builtins taking exactly two strings
+ */
+func stringPairBuiltin(name string, args []object.Object, fn func(a, b string) object.Object) object.Object {
+	if len(args) != 2 { return newError("Wrong number of arguments. got=%d, want=2", len(args)) }
+	strs, err := stringArgs(name, args)
+	if err != nil { return err }
+
+	return fn(strs[0], strs[1])
+}
+
+func stringsToArray(strs []string) *object.Array {
+	elements := make([]object.Object, len(strs))
+	for i, s := range strs { elements[i] = &object.String{Value: s} }
+
+	return &object.Array{Elements: elements}
+}
@@ -4,8 +4,12 @@ import (
 	"mockc/ast"
 	"mockc/object"
 	"fmt"
+	"math"
+	"math/big"
 )
 
+// The singletons below are shared by every interpreter in the process and every task they spawn, which is only safe
+// because nothing ever changes them. Builtins must return new objects rather than modify one of these
 var (
 	// No need to create new Null objects everytime null is used. Null is null afterall...
 	NULL  = &object.Null{}
@@ -33,6 +37,12 @@ func Eval(node ast.Node, env *object.Environment) object.Object { // Placeholder
 		return evalBlockStatements(node, env)
 
 	case *ast.ReturnStatement:
+		if call, ok := node.ReturnValue.(*ast.CallExpression); ok { // Returning a call's value is always a tail call
+			val := evalTailCall(call, env)
+			if isError(val) { return val }
+			return &object.ReturnValue{Value: val}
+		}
+
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
@@ -42,22 +52,30 @@ func Eval(node ast.Node, env *object.Environment) object.Object { // Placeholder
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		if isError(val) { return val }
-		env.Set(node.Name.Value, val)
+		if node.Pattern != nil { return destructure(node.Pattern, val, env) }
+		bind(node.Name, val, env)
+
+	case *ast.StructStatement:
+		fields := []string{}
+		for _, field := range node.Fields { fields = append(fields, field.Value) }
+		bind(node.Name, &object.StructType{Name: node.Name.Value, Fields: fields}, env)
 
 	// Evaluating expressions
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Patterns: node.Patterns, Env: env, Body: body, Scope: node.Scope, Literal: node}
+
+	case *ast.ImplStatement:
+		return evalImplStatement(node, env)
 
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) { return function }
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) { return args[0] }
-		return applyFunction(function, args) // Execute the function
+		function, args, err := evalCall(node, env)
+		if err != nil { return err }
+		return applyFunction(function, args, env) // Execute the function
 
 	case *ast.IntegerLiteral:
+		if node.Big != nil { return &object.BigInteger{Value: node.Big} }
 		return &object.Integer{Value: node.Value}
 
 	case *ast.Boolean:
@@ -106,8 +124,32 @@ func Eval(node ast.Node, env *object.Environment) object.Object { // Placeholder
 
 		return evalIndexExpression(left, index)
 
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+
+	case *ast.MemberExpression:
+		obj := Eval(node.Object, env)
+		if isError(obj) { return obj }
+
+		return evalMemberExpression(obj, node.Property.Value)
+
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
+	case *ast.ForExpression:
+		return evalForExpression(node, env)
+
+	case *ast.SpawnExpression:
+		return evalSpawnExpression(node, env)
+
+	case *ast.AwaitExpression:
+		return evalAwaitExpression(node, env)
+
+	case *ast.YieldExpression:
+		return evalYieldExpression(node, env)
 	}
 
 	return nil
@@ -117,11 +159,12 @@ func evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range stmts {
+		traceStatement(statement, env)
 		result = Eval(statement, env)
 
 		switch result := result.(type) { // Could this be turned into an If/Else
 		case *object.ReturnValue:
-			return result.Value
+			return resolveTailCall(result.Value)
 		case *object.Error:
 			return result
 		}
@@ -163,47 +206,70 @@ func evalNotOperatorExpression(right object.Object) object.Object {
 }
 
 func evalNegativeOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJECT { // Unlike !, - only works on ints
+	switch right := right.(type) { // Unlike !, - only works on ints
+	case *object.Integer:
+		if right.Value == math.MinInt64 { return normalizeBigInteger(new(big.Int).Neg(big.NewInt(right.Value))) }
+		return &object.Integer{Value: -right.Value}
+	case *object.BigInteger:
+		return normalizeBigInteger(new(big.Int).Neg(right.Value))
+	default:
 		return newError("Unsupported negative operand: %s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 func evalInfixExpression(left object.Object, operator string, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJECT && right.Type() == object.INTEGER_OBJECT:
 		return evalIntegerInfixExpression(left, operator, right)
+	case isInteger(left) && isInteger(right): // At least one side is a BigInteger
+		return evalBigIntegerInfixExpression(toBigInt(left), operator, toBigInt(right))
 	case left.Type() != right.Type():
 		return newError("Operand type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	case left.Type() == object.STRING_OBJECT && right.Type() == object.STRING_OBJECT:
 		return evalStringInfixExpression(left, operator, right)
-	// The next two cases are made possible with pointer comparison
-	// If something is pointing to the same address as TRUE, Eval knows it's true and vice versa
-	// These are also placed below the integer operands case so that int == int works, as we use different objects for each instance of int
+	// Equality is structural, so two arrays or hashes with the same contents are equal even though they're different
+	// objects. Values without structure, like functions, fall back to pointer identity inside object.Equal
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equal(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
+	case isOrderingOperator(operator):
+		return evalOrderingExpression(left, operator, right)
 	default:
 		return newError("Unknown infix operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
+/*
+ Integer arithmetic stays on int64 until a result would overflow, at which point it's redone with big.Int and the
+ result is promoted to a BigInteger
+ */
 func evalIntegerInfixExpression(left object.Object, operator string, right object.Object) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		sum := leftVal + rightVal
+		if (leftVal > 0 && rightVal > 0 && sum < 0) || (leftVal < 0 && rightVal < 0 && sum >= 0) { break } // Overflowed
+		return &object.Integer{Value: sum}
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		difference := leftVal - rightVal
+		if (leftVal >= 0 && rightVal < 0 && difference < 0) || (leftVal < 0 && rightVal > 0 && difference >= 0) { break }
+		return &object.Integer{Value: difference}
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		if leftVal == 0 || rightVal == 0 { return &object.Integer{Value: 0} }
+		product := leftVal * rightVal
+		if product/rightVal != leftVal || (leftVal == -1 && rightVal == math.MinInt64) ||
+			(rightVal == -1 && leftVal == math.MinInt64) { break }
+		return &object.Integer{Value: product}
 	case "/":
+		if rightVal == 0 { return newError("Division by zero: %d / 0", leftVal) }
+		if leftVal == math.MinInt64 && rightVal == -1 { break } // The only quotient that doesn't fit back in int64
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 { return newError("Division by zero: %d %% 0", leftVal) }
+		return &object.Integer{Value: leftVal % rightVal}
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -212,16 +278,113 @@ func evalIntegerInfixExpression(left object.Object, operator string, right objec
 		return nativeBoolToBooleanObject(leftVal > rightVal)
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
 	default:
 		return newError("Unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
+
+	// Only reached when an arithmetic operator overflowed
+	return evalBigIntegerInfixExpression(big.NewInt(leftVal), operator, big.NewInt(rightVal))
+}
+
+/*
+ Same operators as evalIntegerInfixExpression but on arbitrary precision values
+ Division truncates towards zero and % takes the sign of the dividend, matching the int64 operators
+ */
+func evalBigIntegerInfixExpression(left *big.Int, operator string, right *big.Int) object.Object {
+	switch operator {
+	case "+":
+		return normalizeBigInteger(new(big.Int).Add(left, right))
+	case "-":
+		return normalizeBigInteger(new(big.Int).Sub(left, right))
+	case "*":
+		return normalizeBigInteger(new(big.Int).Mul(left, right))
+	case "/":
+		if right.Sign() == 0 { return newError("Division by zero: %s / 0", left) }
+		return normalizeBigInteger(new(big.Int).Quo(left, right))
+	case "%":
+		if right.Sign() == 0 { return newError("Division by zero: %s %% 0", left) }
+		return normalizeBigInteger(new(big.Int).Rem(left, right))
+	case "==":
+		return nativeBoolToBooleanObject(left.Cmp(right) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(left.Cmp(right) != 0)
+	case ">":
+		return nativeBoolToBooleanObject(left.Cmp(right) > 0)
+	case "<":
+		return nativeBoolToBooleanObject(left.Cmp(right) < 0)
+	case ">=":
+		return nativeBoolToBooleanObject(left.Cmp(right) >= 0)
+	case "<=":
+		return nativeBoolToBooleanObject(left.Cmp(right) <= 0)
+	default:
+		return newError("Unknown operator: %s %s %s", object.BIG_INTEGER_OBJECT, operator, object.BIG_INTEGER_OBJECT)
+	}
+}
+
+func isInteger(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJECT || obj.Type() == object.BIG_INTEGER_OBJECT
+}
+
+func toBigInt(obj object.Object) *big.Int {
+	if integer, ok := obj.(*object.Integer); ok { return big.NewInt(integer.Value) }
+	return obj.(*object.BigInteger).Value
+}
+
+/*
+ Demote results that fit in 64 bits back to Integer, so a value only has one representation
+ */
+func normalizeBigInteger(value *big.Int) object.Object {
+	if value.IsInt64() { return &object.Integer{Value: value.Int64()} }
+	return &object.BigInteger{Value: value}
 }
 
 func evalStringInfixExpression(left object.Object, operator string, right object.Object) object.Object {
-	if operator != "+" { return newError("Unknown string operator: %s %s %s", left.Type(), operator, right.Type())}
 	leftString := left.(*object.String).Value
 	rightString := right.(*object.String).Value
-	return &object.String{Value: leftString + rightString}
+
+	switch {
+	case operator == "+":
+		return &object.String{Value: leftString + rightString}
+	case operator == "==":
+		return nativeBoolToBooleanObject(leftString == rightString)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(leftString != rightString)
+	case isOrderingOperator(operator): // Lexicographic, see object.String.Compare
+		return evalOrderingExpression(left, operator, right)
+	default:
+		return newError("Unknown string operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isOrderingOperator(operator string) bool {
+	return operator == "<" || operator == ">" || operator == "<=" || operator == ">="
+}
+
+/*
+ Evaluate <, >, <= and >= for any pair of values implementing object.Comparable
+ */
+func evalOrderingExpression(left object.Object, operator string, right object.Object) object.Object {
+	if _, ok := left.(object.Comparable); !ok {
+		return newError("Unknown infix operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	result, ok := object.Compare(left, right)
+	if !ok { return newError("Cannot compare %s %s %s", left.Inspect(), operator, right.Inspect()) }
+
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(result < 0)
+	case ">":
+		return nativeBoolToBooleanObject(result > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(result <= 0)
+	default:
+		return nativeBoolToBooleanObject(result >= 0)
+	}
 }
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
@@ -230,7 +393,9 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 		return condition
 	}
 
-	if isTruthy(condition) { // If the condition is fulfilled execute if
+	taken := isTruthy(condition)
+	traceBranch(ie, taken, env)
+	if taken { // If the condition is fulfilled execute if
 		return Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil { // If the condition is not fulfilled and an else branch exists, execute that
 		return Eval(ie.Alternative, env)
@@ -249,8 +414,10 @@ func isTruthy(obj object.Object) bool {
 
 func evalBlockStatements(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
+	traceBlock(block, env)
 
 	for _, statement := range block.Statements {
+		traceStatement(statement, env)
 		result = Eval(statement, env)
 
 		if result != nil { // Proceed for each statement
@@ -277,7 +444,9 @@ func isError(obj object.Object) bool {
 }
 
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	if val, ok := env.Get(node.Value); ok {
+	if node.Resolved {
+		if val, ok := env.GetSlot(node.Depth, node.Slot, node.Value); ok { return val }
+	} else if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
@@ -300,18 +469,68 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
+/*
+ Call a Moxie function or builtin from Go, ex. a host running the test functions it found in a program
+ */
+func Call(fn object.Object, args []object.Object, env *object.Environment) object.Object {
+	return applyFunction(fn, args, env)
+}
+
+/*
+ Evaluate the function and arguments of a call without making it yet
+ */
+func evalCall(node *ast.CallExpression, env *object.Environment) (object.Object, []object.Object, object.Object) {
+	if member, ok := node.Function.(*ast.MemberExpression); ok { return evalMethodCall(member, node.Arguments, env) }
+
+	function := Eval(node.Function, env)
+	if isError(function) { return nil, nil, function }
+	args := evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) { return nil, nil, args[0] }
+
+	return function, args, nil
+}
+
 /*
  Apply the function to the arguments
+ env is the environment of the caller, builtins use it to reach the interpreter's Runtime
  */
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func applyFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args) // Create an enclosed environment for the function
-		evaluated := Eval(fn.Body, extendedEnv) // Evaluate function body using the new environment
-		return unwrapReturnValue(evaluated)
+		for { // Each tail call the body hands back replaces the current call instead of nesting inside it
+			required := len(fn.Parameters)
+			if fn.Patterns != nil { required = requiredCount(fn.Patterns) } // Parameters with defaults can be left out
+			if len(args) < required { // Every other parameter needs a value, extra arguments are ignored
+				return newError("Wrong number of arguments. got=%d, want=%d", len(args), required)
+			}
+			if isGenerator(fn) { // The body runs as the iterator is read, see iterators.go
+				generatorEnv, err := extendFunctionEnv(fn, args, env.Runtime())
+				if err != nil { return err }
+				return newGenerator(fn, generatorEnv)
+			}
+			tracer := env.Runtime().Tracer
+			if tracer != nil { tracer.Call(fn) }
+			extendedEnv, err := extendFunctionEnv(fn, args, env.Runtime()) // Create an enclosed environment for the function
+			evaluated := err
+			if err == nil { evaluated = unwrapReturnValue(evalTail(fn.Body, extendedEnv)) } // Evaluate function body using the new environment
+			if tracer != nil { tracer.Return() }
+			if err != nil { return err }
+
+			call, ok := evaluated.(*tailCall)
+			if !ok { return evaluated }
+			next, ok := call.fn.(*object.Function)
+			if !ok { return applyFunction(call.fn, call.args, call.env) } // Builtins don't recurse, just call them
+			fn, args = next, call.args
+		}
 
 	case *object.BuiltIn:
-		return fn.Fn(args...)
+		return fn.Fn(env, args...)
+
+	case *object.StructType: // Struct types are their own constructors, taking one value per field
+		if len(args) != len(fn.Fields) {
+			return newError("Wrong number of arguments to %s. got=%d, want=%d", fn.Name, len(args), len(fn.Fields))
+		}
+		return &object.Struct{Definition: fn, Values: args}
 
 	default:
 		return newError("Not a function: %s", fn.Type())
@@ -319,13 +538,66 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 }
 
 /*
- Create an enclosed environment for the function
+ Create an enclosed environment for the function, running under the caller's runtime so a function defined by one task
+ is traced as part of whichever task calls it
+ Parameters with patterns are destructured in order, so defaults can refer to the parameters before them
+ */
+func extendFunctionEnv(fn *object.Function, args []object.Object, runtime *object.Runtime) (*object.Environment, object.Object) {
+	env := enclose(fn.Env, fn.Scope)
+	env.SetRuntime(runtime)
+
+	for paramIndex, param := range fn.Parameters {
+		if fn.Patterns == nil || fn.Patterns[paramIndex] == nil {
+			bind(param, args[paramIndex], env)
+			continue
+		}
+
+		pattern := fn.Patterns[paramIndex]
+		var value object.Object
+		if paramIndex < len(args) {
+			value = args[paramIndex]
+		} else { // Only parameters with defaults can be left out
+			value = Eval(pattern.(*ast.DefaultPattern).Default, env)
+			if isError(value) { return nil, value }
+		}
+		if err := destructure(pattern, value, env); err != nil { return nil, err }
+	}
+
+	return env, nil
+}
+
+/*
+ Tell the runtime's tracer, if there is one, what is about to run
+ */
+func traceStatement(stmt ast.Statement, env *object.Environment) {
+	if tracer := env.Runtime().Tracer; tracer != nil { tracer.Statement(stmt) }
+}
+
+func traceBlock(block *ast.BlockStatement, env *object.Environment) {
+	if tracer := env.Runtime().Tracer; tracer != nil { tracer.Block(block) }
+}
+
+func traceBranch(node *ast.IfExpression, taken bool, env *object.Environment) {
+	if tracer := env.Runtime().Tracer; tracer != nil { tracer.Branch(node, taken) }
+}
+
+/*
+ Create the environment for a function call or match arm, with slots when the resolver has seen its scope
  */
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+func enclose(outer *object.Environment, scope *ast.Scope) *object.Environment {
+	if scope == nil { return object.NewEnclosedEnvironment(outer) }
+	return object.NewScopedEnvironment(outer, scope.Names)
+}
 
-	for paramIndex, param := range fn.Parameters { env.Set(param.Value, args[paramIndex]) }
-	return env
+/*
+ Bind a declared name, straight into its slot if it was resolved
+ */
+func bind(name *ast.Identifier, val object.Object, env *object.Environment) {
+	if name.Resolved {
+		env.SetSlot(name.Slot, name.Value, val)
+	} else {
+		env.Set(name.Value, val)
+	}
 }
 
 /*
@@ -336,10 +608,25 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
+/*
+ Read a field with dot syntax, ex. p.x
+ */
+func evalMemberExpression(obj object.Object, name string) object.Object {
+	instance, ok := obj.(*object.Struct)
+	if !ok { return newError("Field access not supported: %s", obj.Type()) }
+
+	value, ok := instance.Get(name)
+	if !ok { return newError("Unknown field %s on %s", name, instance.Definition.Name) }
+
+	return value
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJECT && index.Type() == object.INTEGER_OBJECT:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJECT && index.Type() == object.INTEGER_OBJECT:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJECT:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -347,34 +634,81 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	}
 }
 
+/*
+ Indexing a string counts characters rather than bytes and returns a one character string
+ */
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	runes := []rune(str.(*object.String).Value)
+	idx := index.(*object.Integer).Value
+	if err := checkIndex("string", idx, len(runes)); err != nil { return err }
+
+	return &object.String{Value: string(runes[idx])}
+}
+
+/*
+ x[start:end] on arrays and strings, with the same clamping and negative indexes as the slice builtin
+ */
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) { return left }
+
+	bounds := []object.Object{}
+	for i, bound := range []ast.Expression{node.Start, node.End} {
+		if bound == nil {
+			if i == 0 { bounds = append(bounds, &object.Integer{Value: 0}) } // A missing end is simply left off
+			continue
+		}
+
+		value := Eval(bound, env)
+		if isError(value) { return value }
+		bounds = append(bounds, value)
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		start, end, err := sliceBounds("slice", bounds, len(left.Elements))
+		if err != nil { return err }
+		return sliceArray(left, start, end)
+	case *object.String:
+		return builtinSubstring(env, append([]object.Object{left}, bounds...)...)
+	default:
+		return newError("Slice operator not supported: %s", left.Type())
+	}
+}
+
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
 	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
-
-	if idx < 0 || idx > max { return newError("Index %d out of bounds for array length %d", idx, max + 1) }
+	if err := checkIndex("array", idx, len(arrayObject.Elements)); err != nil { return err }
 
 	return arrayObject.Elements[idx]
 }
 
+/*
+ Strings and arrays share one bounds check so the same mistake gives the same error on either
+ */
+func checkIndex(kind string, idx int64, length int) *object.Error {
+	if idx < 0 || idx >= int64(length) { return newError("Index %d out of bounds for %s length %d", idx, kind, length) }
+	return nil
+}
+
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
-	for keyNode, valueNode := range node.Pairs { // For all key/values
+	for _, keyNode := range node.Keys { // For all key/values, in source order
 		key := Eval(keyNode, env) // Evaluate the key, if an error occurs, return
 		if isError(key) { return key }
 
 		hashKey, ok := key.(object.Hashable) // Check if key is hashable, if not throw a new error
 		if !ok { return newError("Type %s is not hashable", key.Type()) }
 
-		value := Eval(valueNode, env) // Evaluate the value, if an error occurs return
+		value := Eval(node.Pairs[keyNode], env) // Evaluate the value, if an error occurs return
 		if isError(value) { return value }
 
-		hashed := hashKey.HashKey() // Otherwise, add the key/value pair to the map of pairs
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashKey, value) // Otherwise, add the key/value pair to the hash
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
 func evalHashIndexExpression(left, index object.Object) object.Object {
@@ -383,8 +717,8 @@ func evalHashIndexExpression(left, index object.Object) object.Object {
 	key, ok := index.(object.Hashable)
 	if !ok { return newError("Type %s is not hashable", index.Type()) }
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(key)
 	if !ok { return NULL }
 
-	return pair.Value
-}
\ No newline at end of file
+	return value
+}
@@ -1,9 +1,17 @@
 package evaluator
 
 import (
+	"bytes"
+	"fmt"
 	"mockc/lexer"
 	"mockc/object"
 	"mockc/parser"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -49,6 +57,10 @@ func TestBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
 	}
 
 	for _, tt := range tests {
@@ -77,10 +89,14 @@ func TestNotOperator(t *testing.T) {
 }
 
 func testEval(input string) (object.Object) {
+	return testEvalWithRuntime(input, object.NewRuntime())
+}
+
+func testEvalWithRuntime(input string, runtime *object.Runtime) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
-	env := object.NewEnvironment() // Each test call to eval needs a clean environment
+	env := object.NewEnvironmentWithRuntime(runtime) // Each test call to eval needs a clean environment
 
 	return Eval(program, env)
 }
@@ -113,6 +129,20 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	return true
 }
 
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, wanted=%q", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -271,10 +301,19 @@ func TestFunctionApplication(t *testing.T) {
 		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10}, // Multiple Params
 		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20}, // Nested function call, passing infix exp as param
 		{"fn(x) { x; }(5)", 5},
+		{"fn(x) { x; }(5, 6)", 5}, // Extra arguments are ignored
 	}
 	for _, tt := range tests {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
 	}
+
+	// Too few used to index past the arguments and crash the interpreter, now each parameter without a default needs one
+	for _, input := range []string{"fn(x, y) { x; }(5)", "let f = fn(x) { x; }; f()"} {
+		errObj, ok := testEval(input).(*object.Error)
+		if !ok || !strings.HasPrefix(errObj.Message, "Wrong number of arguments.") {
+			t.Errorf("%s: expected a wrong number of arguments error. got=%+v", input, testEval(input))
+		}
+	}
 }
 
 func TestClosures(t *testing.T) { // This test passes right away thanks to the implementation of enclosed environments
@@ -455,21 +494,50 @@ func TestHashLiterals(t *testing.T) {
 	result, ok := evaluated.(*object.Hash)
 	if !ok { t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated) }
 
-	expected := map[object.HashKey]int64{
-		(&object.String{Value: "one"}).HashKey(): 1,
-		(&object.String{Value: "two"}).HashKey(): 2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey(): 4,
-		TRUE.HashKey(): 5,
-		FALSE.HashKey(): 6,
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{TRUE, 5},
+		{FALSE, 6},
+	}
+
+	if result.Len() != len(expected) { t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len()) }
+
+	for i, tt := range expected {
+		value, ok := result.Get(tt.key)
+		if !ok { t.Errorf("No pair for key %s in hash", tt.key.Inspect()) }
+		testIntegerObject(t, value, tt.value)
+
+		pair := result.Pairs()[i] // Pairs come back in the order they were written in the literal
+		if pair.Key.Inspect() != tt.key.Inspect() {
+			t.Errorf("Pair %d has wrong key. got=%s, want=%s", i, pair.Key.Inspect(), tt.key.Inspect())
+		}
 	}
+}
 
-	if len(result.Pairs) != len(expected) { t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs)) }
+func TestHashInspectOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, "c": 3}`, "{b: 1, a: 2, c: 3}"},
+		{`{3: "x", 1: "y", 2: "z"}`, "{3: x, 1: y, 2: z}"},
+		{`{"a": 1, "b": 2, "a": 3}`, "{a: 3, b: 2}"}, // Duplicate keys keep their first position
+		{`{}`, "{}"},
+	}
 
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
-		if !ok { t.Errorf("No pair for given key in Pairs") }
-		testIntegerObject(t, pair.Value, expectedValue)
+	for _, tt := range tests {
+		for run := 0; run < 10; run++ { // Go randomizes map iteration, so repeat to catch any ordering leaks
+			evaluated := testEval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Fatalf("wrong Inspect for %s. got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+			}
+		}
 	}
 }
 
@@ -516,4 +584,1345 @@ func TestHashIndexExpressions(t *testing.T) {
 			testNullObject(t, evaluated)
 		}
 	}
-}
\ No newline at end of file
+}
+func TestStructuralEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, [2, 3]] == [1, [2, 3]]", true},
+		{"[1, 2] == [1, 2, 3]", false},
+		{"[] == []", true},
+		{`{"a": 1, "b": [2]} == {"a": 1, "b": [2]}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, false}, // Hash equality follows insertion order
+		{`"abc" == "abc"`, true},
+		{`"abc" != "abd"`, true},
+		{"let f = fn(x) { x }; f == f", true},
+		{"fn(x) { x } == fn(x) { x }", false}, // Functions are only equal to themselves
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestOrdering(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"apple" < "banana"`, true},
+		{`"apple" > "Apple"`, true},
+		{`"abc" <= "abc"`, true},
+		{`"ab" < "abc"`, true},
+		{"[1, 2] < [1, 3]", true},
+		{"[1, 2] < [1, 2, 0]", true},
+		{"[2] > [1, 9, 9]", true},
+		{"[[1, 2], 3] >= [[1, 2], 3]", true},
+		{`["a", "b"] < ["a", "c"]`, true},
+		{`[1, "a"] < [1, 2]`, `Cannot compare [1, a] < [1, 2]`},
+		{`{"a": 1} < {"a": 2}`, "Unknown infix operator: HASH < HASH"},
+		{"true < false", "Unknown infix operator: BOOLEAN < BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestIntegerOverflowPromotion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		typ      object.ObjectType
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808", object.BIG_INTEGER_OBJECT},
+		{"-9223372036854775807 - 2", "-9223372036854775809", object.BIG_INTEGER_OBJECT},
+		{"0 - -9223372036854775808", "9223372036854775808", object.BIG_INTEGER_OBJECT},
+		{"4294967296 * 4294967296", "18446744073709551616", object.BIG_INTEGER_OBJECT},
+		{"-9223372036854775808 / -1", "9223372036854775808", object.BIG_INTEGER_OBJECT},
+		{"-(-9223372036854775808)", "9223372036854775808", object.BIG_INTEGER_OBJECT},
+		{"123456789012345678901234567890", "123456789012345678901234567890", object.BIG_INTEGER_OBJECT},
+		{"123456789012345678901234567890 * 10 + 5", "1234567890123456789012345678905", object.BIG_INTEGER_OBJECT},
+		{"123456789012345678901234567890 % 1000", "890", object.INTEGER_OBJECT},
+		{"-123456789012345678901234567890 / 10", "-12345678901234567890123456789", object.BIG_INTEGER_OBJECT},
+		{"9223372036854775808 - 1", "9223372036854775807", object.INTEGER_OBJECT}, // Results that fit are demoted
+		{"-9223372036854775808", "-9223372036854775808", object.INTEGER_OBJECT},
+		{"let n = 99999999999999999999; n * n / n == n", "true", object.BOOLEAN_OBJECT},
+		{"18446744073709551616 > 5", "true", object.BOOLEAN_OBJECT},
+		{"5 >= 18446744073709551616", "false", object.BOOLEAN_OBJECT},
+		{"[18446744073709551616] == [18446744073709551616]", "true", object.BOOLEAN_OBJECT},
+		{`{18446744073709551616: "big"}[18446744073709551616]`, "big", object.STRING_OBJECT},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Type() != tt.typ {
+			t.Errorf("%s: wrong type. got=%s (%s), want=%s", tt.input, evaluated.Type(), evaluated.Inspect(), tt.typ)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong value. got=%s, want=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestModuloAndDivisionByZero(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"10 % 3", 1},
+		{"-10 % 3", -1},
+		{"7 / 2", 3},
+		{"5 / 0", "Division by zero: 5 / 0"},
+		{"5 % 0", "Division by zero: 5 % 0"},
+		{"18446744073709551616 / 0", "Division by zero: 18446744073709551616 / 0"},
+		{"let f = fn(x) { 100 / x }; f(0)", "Division by zero: 100 / 0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"map([1, 2, 3], fn(x) { x * 2 })", "[2, 4, 6]"},
+		{"map([], fn(x) { x })", "[]"},
+		{`map(["a", "bc"], len)`, "[1, 2]"},
+		{"filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })", "[2, 4]"},
+		{"reduce([1, 2, 3, 4], fn(acc, x) { acc + x }, 0)", "10"},
+		{"reduce([1, 2, 3, 4], fn(acc, x) { acc * x })", "24"},
+		{"reduce([], fn(acc, x) { acc + x }, 5)", "5"},
+		{"each([1, 2], fn(x) { x })", "null"},
+		{"each([1, 0], fn(x) { 1 / x })", "Division by zero: 1 / 0"}, // Errors from the callback stop the loop
+		{"sort([3, 1, 2])", "[1, 2, 3]"},
+		{`sort(["pear", "apple", "fig"])`, "[apple, fig, pear]"},
+		{"sort([[2, 1], [1, 5], [1, 2]])", "[[1, 2], [1, 5], [2, 1]]"},
+		{"sort([3, 1, 2], fn(a, b) { b - a })", "[3, 2, 1]"},
+		{`sort(["bb", "a", "ccc", "d"], fn(a, b) { len(a) - len(b) })`, "[a, d, bb, ccc]"}, // Stable
+		{"reverse([1, 2, 3])", "[3, 2, 1]"},
+		{"zip([1, 2, 3], [4, 5])", "[[1, 4], [2, 5]]"},
+		{`zip([1], ["a"], [true])`, "[[1, a, true]]"},
+		{"range(4)", "[0, 1, 2, 3]"},
+		{"range(2, 5)", "[2, 3, 4]"},
+		{"range(10, 0, -3)", "[10, 7, 4, 1]"},
+		{"range(0)", "[]"},
+		{"range(9223372036854775800, 9223372036854775807, 10)", "[9223372036854775800]"},
+		{"range(9223372036854775805, 9223372036854775807)", "[9223372036854775805, 9223372036854775806]"},
+		{"range(-9223372036854775807 - 1, -9223372036854775807, 1)", "[-9223372036854775808]"},
+		{"range(-9223372036854775802, -9223372036854775807 - 1, -3)", "[-9223372036854775802, -9223372036854775805]"},
+		{"range(9223372036854775807, -9223372036854775807 - 1, -9223372036854775807 - 1)", "[9223372036854775807, -1]"},
+		{"contains([1, [2], 3], [2])", "true"},
+		{"contains([1, 2], 5)", "false"},
+		{`index_of(["a", "b", "c"], "c")`, "2"},
+		{"index_of([1, 2], 5)", "-1"},
+		{"slice([1, 2, 3, 4, 5], 1, 3)", "[2, 3]"},
+		{"slice([1, 2, 3, 4, 5], -2)", "[4, 5]"},
+		{"slice([1, 2, 3], 2, 100)", "[3]"},
+		{"slice([1, 2, 3], 2, 1)", "[]"},
+		{"concat([1], [2, 3], [])", "[1, 2, 3]"},
+		{"flatten([1, [2, [3, [4]]]])", "[1, 2, 3, 4]"},
+		{"flatten([1, [2, [3, [4]]]], 1)", "[1, 2, [3, [4]]]"},
+		{"unique([1, 2, 1, 3, 2])", "[1, 2, 3]"},
+		{"unique([[1], [1], [2]])", "[[1], [2]]"},
+		{`group_by([1, 2, 3, 4, 5], fn(x) { x % 2 })`, "{1: [1, 3, 5], 0: [2, 4]}"},
+		{`group_by(["apple", "avocado", "banana"], fn(s) { len(s) })`, "{5: [apple], 7: [avocado], 6: [banana]}"},
+		{"let double = fn(x) { x * 2 }; map(filter(range(6), fn(x) { x > 2 }), double)", "[6, 8, 10]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("%s: got nil", tt.input)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. got=%s, want=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestCollectionBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"map(1, fn(x) { x })", "Argument to 'map' must be ARRAY or ITERATOR, got INTEGER"},
+		{"map([1], 2)", "Argument to 'map' must be FUNCTION, got INTEGER"},
+		{"map([1])", "Wrong number of arguments. got=1, want=2"},
+		{"map([1], fn(x, y) { x })", "Wrong number of arguments. got=1, want=2"},
+		{"map([1, 0], fn(x) { 10 / x })", "Division by zero: 10 / 0"},
+		{"reduce([], fn(acc, x) { acc })", "Cannot reduce an empty array without an initial value"},
+		{"sort([1, \"a\"])", "Cannot compare a and 1"},
+		{"sort([2, 1], fn(a, b) { true })", "Comparator for 'sort' must return INTEGER, got BOOLEAN"},
+		{"range(1, 5, 0)", "Step for 'range' must not be zero"},
+		{"range(-9223372036854775807 - 1, 9223372036854775807)", "Result of 'range' is too long, the limit is 67108864 elements"},
+		{"group_by([1], fn(x) { [x] })", "Type ARRAY is not hashable"},
+		{"zip([1])", "Wrong number of arguments. got=1, want=2 or more"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,,c", ",")`, "[a, b, , c]"},
+		{`split("  one two   three ")`, "[one, two, three]"},
+		{`split("héllo", "")`, "[h, é, l, l, o]"},
+		{`join(["a", "b", "c"], "-")`, "a-b-c"},
+		{`join([])`, ""},
+		{`trim("  hi  ")`, "hi"},
+		{`trim("xxhixx", "x")`, "hi"},
+		{`trim_left("  hi  ")`, "hi  "},
+		{`trim_right("  hi  ")`, "  hi"},
+		{`trim_prefix("prefix-body", "prefix-")`, "body"},
+		{`trim_suffix("file.mx", ".mx")`, "file"},
+		{`upper("über")`, "ÜBER"},
+		{`lower("ÀBC")`, "àbc"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`replace("a-b-c", "-", "+", 1)`, "a+b-c"},
+		{`contains("hello", "ell")`, "true"},
+		{`contains("hello", "xyz")`, "false"},
+		{`starts_with("hello", "he")`, "true"},
+		{`ends_with("hello", "he")`, "false"},
+		{`index_of("héllo", "llo")`, "2"},
+		{`index_of("hello", "z")`, "-1"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", 0)`, ""},
+		{`substring("héllo wörld", 6)`, "wörld"},
+		{`substring("héllo", 1, 3)`, "él"},
+		{`substring("héllo", -3)`, "llo"},
+		{`pad_left("7", 3, "0")`, "007"},
+		{`pad_right("ab", 5)`, "ab   "},
+		{`pad_left("ab", 7, "xy")`, "xyxyxab"},
+		{`pad_left("toolong", 3)`, "toolong"},
+		{`len(repeat("ab", 33554432))`, "67108864"},
+		{`chars("añb")`, "[a, ñ, b]"},
+		{`len("héllo")`, "5"},
+		{`reverse("héllo")`, "olléh"},
+		{`slice("héllo", 1, 2)`, "é"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[4]`, "o"},
+		{`"héllo"[1:3]`, "él"},
+		{`"héllo"[:2]`, "hé"},
+		{`"héllo"[3:]`, "lo"},
+		{`"héllo"[-2:]`, "lo"},
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4][:]", "[1, 2, 3, 4]"},
+		{`let s = "abc"; s[len(s) - 1]`, "c"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("%s: got nil", tt.input)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestStringBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"abc"[3]`, "Index 3 out of bounds for string length 3"},
+		{`"abc"[-1]`, "Index -1 out of bounds for string length 3"},
+		{`""[0]`, "Index 0 out of bounds for string length 0"},
+		{`[][0]`, "Index 0 out of bounds for array length 0"}, // Arrays report the same mistake the same way
+		{`true[0:1]`, "Slice operator not supported: BOOLEAN"},
+		{`upper(1)`, "Argument to 'upper' must be STRING, got INTEGER"},
+		{`join(["a", 1], ",")`, "Elements passed to 'join' must be STRING, got INTEGER"},
+		{`repeat("a", -1)`, "Count for 'repeat' must not be negative, got -1"},
+		{`repeat("ab", 9223372036854775807)`, "Result of 'repeat' is too long, the limit is 67108864 bytes"},
+		{`repeat("ab", 33554433)`, "Result of 'repeat' is too long, the limit is 67108864 bytes"},
+		{`pad_left("a", 9223372036854775807)`, "Result of 'pad_left' is too long, the limit is 67108864 characters"},
+		{`pad_right("a", -1)`, "Width for 'pad_right' must not be negative, got -1"},
+		{`pad_left("a", 3, "")`, "Padding for 'pad_left' must not be empty"},
+		{`split()`, "Wrong number of arguments. got=0, want=1 or 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`keys({"b": 1, "a": 2, 3: 3})`, "[b, a, 3]"},
+		{`values({"b": 1, "a": 2})`, "[1, 2]"},
+		{`entries({"b": 1, "a": 2})`, "[[b, 1], [a, 2]]"},
+		{`keys({})`, "[]"},
+		{`has({"a": 1}, "a")`, "true"},
+		{`has({"a": 1}, "b")`, "false"},
+		{`let h = {"a": first([])}; [h["a"], has(h, "a"), has(h, "b")]`, "[null, true, false]"},
+		{`get({"a": 1}, "a")`, "1"},
+		{`get({"a": 1}, "b")`, "null"},
+		{`get({"a": 1}, "b", 42)`, "42"},
+		{`delete({"a": 1, "b": 2, "c": 3}, "b")`, "{a: 1, c: 3}"},
+		{`delete({"a": 1}, "z")`, "{a: 1}"},
+		{`let h = {"a": 1}; delete(h, "a"); h`, "{a: 1}"}, // The original is untouched
+		{`merge({"a": 1, "b": 2}, {"b": 20, "c": 30})`, "{a: 1, b: 20, c: 30}"},
+		{`merge({"a": 1}, {}, {"a": 3})`, "{a: 3}"},
+		{`map_values({"a": 1, "b": 2}, fn(v) { v * 10 })`, "{a: 10, b: 20}"},
+		{`from_entries([["x", 1], ["y", 2]])`, "{x: 1, y: 2}"},
+		{`from_entries(entries({"k": "v", 1: true}))`, "{k: v, 1: true}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("%s: got nil", tt.input)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestHashBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`keys([1])`, "Argument to 'keys' must be HASH, got ARRAY"},
+		{`has({}, [1])`, "Type ARRAY is not hashable"},
+		{`merge({}, 1)`, "Argument to 'merge' must be HASH, got INTEGER"},
+		{`from_entries([["a"]])`, "Entries passed to 'from_entries' must be [key, value], got [a]"},
+		{`map_values({"a": 0}, fn(v) { 1 / v })`, "Division by zero: 1 / 0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestJSONParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_parse("{\"b\": 1, \"a\": [true, false, null], \"c\": {\"d\": \"e\"}}")`, "{b: 1, a: [true, false, null], c: {d: e}}"},
+		{`json_parse("[]")`, "[]"},
+		{`json_parse("  42 ")`, "42"},
+		{`json_parse("-7")`, "-7"},
+		{`json_parse("123456789012345678901234567890")`, "123456789012345678901234567890"},
+		{`json_parse("1e3")`, "1000"},
+		{`json_parse("2e30")`, "2000000000000000000000000000000"},
+		{`json_parse("2.0")`, "2"},
+		{`json_parse("\"caf\\u00e9\"")`, "café"},
+		{`json_parse("{\"a\": 1, \"a\": 2}")`, "{a: 2}"},
+		{`json_parse("{\"n\": 5}")["n"] + 1`, "6"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("%s: got nil", tt.input)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestJSONStringify(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_stringify({"b": 1, "a": [true, first([]), "x"]})`, `{"b":1,"a":[true,null,"x"]}`},
+		{`json_stringify([])`, "[]"},
+		{`json_stringify({})`, "{}"},
+		{`json_stringify("quote \" and <tag>")`, `"quote \" and <tag>"`},
+		{`json_stringify(18446744073709551616)`, "18446744073709551616"},
+		{`json_stringify({"a": [1, 2], "b": {}}, 2)`, "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": {}\n}"},
+		{`json_stringify([1], "\t")`, "[\n\t1\n]"},
+		{`json_stringify([1], 10)`, "[\n          1\n]"},
+		{`let doc = "{\"z\":[1,{\"y\":null}],\"big\":99999999999999999999}"; json_stringify(json_parse(doc)) == doc`, "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("%s: got nil", tt.input)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_parse("1.5")`, "JSON number 1.5 is not an integer at line 1, column 1"},
+		{`json_parse("1e5000000")`, "JSON number 1e5000000 is out of range at line 1, column 1"},
+		{`json_parse("[1E-99999999999999999999]")`, "JSON number 1E-99999999999999999999 is out of range at line 1, column 2"},
+		{`json_parse("{\"a\":\n  [1, 2.25]}")`, "JSON number 2.25 is not an integer at line 2, column 7"},
+		{`json_parse("[1, 2")`, "Unexpected end of JSON input at line 1, column 6"},
+		{`json_parse("{\"a\" 1}")`, "Invalid JSON: invalid character '1' after object key at line 1, column 6"},
+		{`json_parse("[1] [2]")`, "Unexpected data after JSON value at line 1, column 5"},
+		{`json_parse(1)`, "Argument to 'json_parse' must be STRING, got INTEGER"},
+		{`json_stringify(fn(x) { x })`, "Cannot convert FUNCTION to JSON"},
+		{`json_stringify([len])`, "Cannot convert BUILTIN to JSON"},
+		{`json_stringify({1: "one"})`, "JSON object keys must be STRING, got INTEGER"},
+		{`json_stringify([1], 9223372036854775807)`, "Indent for 'json_stringify' must be 0 to 10, got 9223372036854775807"},
+		{`json_stringify([1], -1)`, "Indent for 'json_stringify' must be 0 to 10, got -1"},
+		{`json_stringify([1], "           ")`, `Indent for 'json_stringify' must be at most 10 characters, got "           "`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestIOBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("bee"), 0644)
+	os.Mkdir(filepath.Join(dir, "a"), 0755)
+	os.Symlink(filepath.Join(dir, "a", "linked.txt"), filepath.Join(dir, "link")) // Dangling until written through
+	t.Setenv("MOXIE_TEST_VAR", "set")
+
+	runtime := object.NewRuntime()
+	runtime.Policy = object.Policy{AllowedDirs: []string{dir}, AllowEnv: true}
+	runtime.SetStdin(strings.NewReader("first\r\nsecond"))
+	exitCode := -1
+	runtime.Exit = func(code int) { exitCode = code }
+
+	path := func(name string) string { return `"` + filepath.Join(dir, name) + `"` }
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"read_file(" + path("b.txt") + ")", "bee"},
+		{"write_file(" + path("c.txt") + `, "sea"); read_file(` + path("c.txt") + ")", "sea"},
+		{"write_file(" + path("link") + `, "ink"); read_file(` + path("a/linked.txt") + ")", "ink"},
+		{"list_dir(" + path("") + ")", []string{"a", "b.txt", "c.txt", "link"}},
+		{"exists(" + path("a") + ")", true},
+		{"exists(" + path("missing") + ")", false},
+		{`getenv("MOXIE_TEST_VAR")`, "set"},
+		{`getenv("MOXIE_TEST_UNSET", "fallback")`, "fallback"},
+		{`read_line()`, "first"},
+		{`read_line()`, "second"},
+		{`read_line()`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithRuntime(tt.input, runtime)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case []string:
+			arr, ok := evaluated.(*object.Array)
+			if !ok || len(arr.Elements) != len(expected) {
+				t.Errorf("%s: expected %d names. got=%s", tt.input, len(expected), evaluated.Inspect())
+				continue
+			}
+			for i, name := range expected { testStringObject(t, arr.Elements[i], name) }
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	evaluated := testEvalWithRuntime("exit(3); 5", runtime)
+	if exitCode != 3 { t.Errorf("exit hook got code %d, want 3", exitCode) }
+	if _, ok := evaluated.(*object.Error); !ok { t.Errorf("evaluation continued after exit. got=%s", evaluated.Inspect()) }
+}
+
+func TestIOPolicy(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	os.Symlink(outside, filepath.Join(dir, "escape"))
+	os.Symlink(filepath.Join(outside, "target"), filepath.Join(dir, "dangling")) // Writing would create the target
+
+	readOnly := object.NewRuntime()
+	readOnly.Policy = object.Policy{AllowedDirs: []string{dir}, ReadOnly: true}
+	writable := object.NewRuntime()
+	writable.Policy = object.Policy{AllowedDirs: []string{dir}}
+
+	tests := []struct {
+		input    string
+		runtime  *object.Runtime
+		expected string
+	}{
+		{`read_file("` + filepath.Join(outside, "x") + `")`, readOnly, "Permission denied: 'read_file' cannot access " + filepath.Join(outside, "x")},
+		{`exists("` + filepath.Join(dir, "..") + `")`, readOnly, "Permission denied: 'exists' cannot access " + filepath.Join(dir, "..")},
+		{`list_dir("` + filepath.Join(dir, "escape") + `")`, readOnly, "Permission denied: 'list_dir' cannot access " + filepath.Join(dir, "escape")},
+		{`write_file("` + filepath.Join(dir, "x") + `", "")`, readOnly, "Permission denied: 'write_file' is not allowed in read-only mode"},
+		{`write_file("` + filepath.Join(dir, "dangling") + `", "")`, writable, "Permission denied: 'write_file' cannot access " + filepath.Join(dir, "dangling")},
+		{`exists("` + filepath.Join(dir, "dangling") + `")`, readOnly, "Permission denied: 'exists' cannot access " + filepath.Join(dir, "dangling")},
+		{`read_file("` + filepath.Join(dir, "missing") + `")`, readOnly, "'read_file' failed: no such file or directory"},
+		{`getenv("HOME")`, object.NewRuntime(), "Permission denied: 'getenv' is not allowed"},
+		{`read_line()`, object.NewRuntime(), "Permission denied: 'read_line' has no input"},
+		{`exit(0)`, object.NewRuntime(), "Permission denied: 'exit' is not allowed"},
+		{`read_file(1)`, readOnly, "Argument to 'read_file' must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithRuntime(tt.input, tt.runtime)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+
+	if _, err := os.Lstat(filepath.Join(outside, "target")); !os.IsNotExist(err) { t.Errorf("write_file followed a dangling link outside the allowed directory") }
+}
+
+func TestOutputStreams(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	runtime := object.NewRuntime()
+	runtime.Stdout = &stdout
+	runtime.Stderr = &stderr
+
+	testEvalWithRuntime(`print("a", 1); printf("%s=%d;", "b", 2); eprint([1, 2])`, runtime)
+
+	if stdout.String() != "a\n1\nb=2;" { t.Errorf("wrong stdout. got=%q", stdout.String()) }
+	if stderr.String() != "[1, 2]\n" { t.Errorf("wrong stderr. got=%q", stderr.String()) }
+}
+
+func TestSprintf(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sprintf("plain")`, "plain"},
+		{`sprintf("%s and %v", "str", [1, "two"])`, "str and [1, two]"},
+		{`sprintf("%q", "say \"hi\"")`, `"say \"hi\""`},
+		{`sprintf("%d|%5d|%-5d|%05d", 7, 7, 7, 7)`, "7|    7|7    |00007"},
+		{`sprintf("%x %X %o %b", 255, 255, 8, 5)`, "ff FF 10 101"},
+		{`sprintf("%d", 9223372036854775807 + 1)`, "9223372036854775808"},
+		{`sprintf("%t %v", true, {"a": 1})`, "true {a: 1}"},
+		{`sprintf("%-4s|%.2s", "ab", "xyz")`, "ab  |xy"},
+		{`sprintf("100%%")`, "100%"},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSprintfErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sprintf("%d", "a")`, "Verb %d expects INTEGER, got STRING"},
+		{`sprintf("%5s", 1)`, "Verb %5s expects STRING, got INTEGER"},
+		{`sprintf("%t", 1)`, "Verb %t expects BOOLEAN, got INTEGER"},
+		{`sprintf("%d %d", 1)`, "Missing argument for verb %d"},
+		{`sprintf("%d", 1, 2)`, "Too many arguments for format. got=2, used=1"},
+		{`sprintf("%y", 1)`, "Unknown format verb %y"},
+		{`sprintf("50%")`, "Format ends in the middle of verb %"},
+		{`printf(1)`, "Argument to 'printf' must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // Empty when the assertion should pass
+	}{
+		{`assert(1 < 2)`, ""},
+		{`assert(false)`, "assert failed"},
+		{`assert(false, "math is broken")`, "assert failed: math is broken"},
+		{`assert_eq({"a": [1, 2]}, {"a": [1, 2]})`, ""},
+		{`assert_eq("héllo", "help")`, "assert_eq failed\n  - expected: help\n  + actual:   héllo\n               ^"},
+		{`assert_eq("1", 1)`, "assert_eq failed\n  - expected: 1 (INTEGER)\n  + actual:   1 (STRING)\n                 ^"},
+		{`assert_error(fn() { 1 / 0 }, "Division")`, ""},
+		{`assert_error(fn() { 1 })`, "assert_error failed: no error was raised, got 1"},
+		{`assert_error(fn() { -true }, "Division")`, `assert_error failed: error "Unsupported negative operand: BOOLEAN" does not contain "Division"`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, isErr := evaluated.(*object.Error)
+		if tt.expected == "" {
+			if isErr { t.Errorf("%s: expected to pass. got=%q", tt.input, errObj.Message) }
+			continue
+		}
+		if !isErr {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"struct Point { x, y }; let p = Point(1, 2); p.x + p.y", 3},
+		{"struct Point { x, y }; Point(1, [2, 3]).y[1]", 3},
+		{"struct Line { from, to }; struct Point { x, y }; Line(Point(0, 0), Point(4, 5)).to.y", 5},
+		{"struct Point { x, y }; Point(1, 2) == Point(1, 2)", true},
+		{"struct Point { x, y }; Point(1, 2) == Point(2, 1)", false},
+		{"struct A { x }; struct B { x }; A(1) == B(1)", false},
+		{"struct Point { x, y }; len(map([1, 2], fn(x) { Point(x, x) }))", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestStructInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`struct Point { x, y }; Point(1, 2)`, "Point{x: 1, y: 2}"},
+		{`struct User { name, tags }; User("ada", ["a", "b"])`, "User{name: ada, tags: [a, b]}"},
+		{`struct Empty {}; Empty()`, "Empty{}"},
+		{`struct Point { x, y }; Point`, "struct Point { x, y }"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong Inspect. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStructErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, y }; Point(1, 2).z", "Unknown field z on Point"},
+		{"struct Point { x, y }; Point(1)", "Wrong number of arguments to Point. got=1, want=2"},
+		{"struct Point { x, y }; Point(1, 2, 3)", "Wrong number of arguments to Point. got=3, want=2"},
+		{"let h = {\"x\": 1}; h.x", "Field access not supported: HASH"},
+		{"5.x", "Field access not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2, 3, 4].filter(fn(x) { x % 2 == 0 }).map(fn(x) { x * 10 })`, "[20, 40]"},
+		{`[3, 1, 2].sort().reverse().len()`, "3"},
+		{`["a", "b"].join("-").upper()`, "A-B"},
+		{`" padded ".trim().pad_left(8, ".")`, "..padded"},
+		{`"a,b,c".split(",").index_of("c")`, "2"},
+		{`{"a": 1, "b": 2}.keys()`, "[a, b]"},
+		{`{"a": 1}.merge({"b": 2}).len()`, "2"},
+		{`let h = {"keys": 5}; h.keys()`, "[keys]"},
+		{`struct Point { x, y }; impl Point { let sum = fn(self) { self.x + self.y }; }; Point(1, 2).sum()`, "3"},
+		{`struct Point { x, y }; impl Point { let add = fn(self, o) { Point(self.x + o.x, self.y + o.y) }; };
+		  Point(1, 2).add(Point(3, 4)).add(Point(1, 1))`, "Point{x: 5, y: 7}"},
+		{`struct Box { f }; impl Box { let f = fn(self) { "method" }; }; Box(fn() { "field" }).f()`, "field"},
+		{`struct C { n }; impl C { let a = fn(self) { 1 }; }; impl C { let a = fn(self) { 2 }; }; C(0).a()`, "2"},
+		{`struct Counter { n }; impl Counter { let up = fn(self) { Counter(self.n + 1) }; };
+		  [Counter(0), Counter(5)].map(fn(c) { c.up().up().n })`, "[2, 7]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMethodCallErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1].upper()`, "Unknown method upper for ARRAY"},
+		{`5.len()`, "Unknown method len for INTEGER"},
+		{`struct P { x }; P(1).norm()`, "Unknown method norm on P"},
+		{`struct P { x }; P(1).x()`, "Not a function: INTEGER"},
+		{`"a".repeat("b")`, "Argument to 'repeat' must be INTEGER, got STRING"},
+		{`[1].map(fn(x) { x }, 2, 3).len()`, "Wrong number of arguments. got=4, want=2"},
+		{`impl Missing { let f = fn(self) { 1 }; }`, "Identifier not found: Missing"},
+		{`let h = {}; impl h { let f = fn(self) { 1 }; }`, "Methods can only be added to struct types, got HASH"},
+		{`struct P { x }; impl P { let f = 5; }`, "Method f of P must be FUNCTION, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (2) { 1 => "one", 2 => "two", _ => "many" }`, "two"},
+		{`match ("b") { "a" => 1, "b" => 2 }`, "2"},
+		{`match (-3) { -3 => "neg", _ => "other" }`, "neg"},
+		{`match (true) { false => 0, true => 1 }`, "1"},
+		{`match (5) { n => n * 2 }`, "10"},
+		{`let sum = fn(arr) { match (arr) { [] => 0, [h, ...t] => h + sum(t) } }; sum([1, 2, 3, 4])`, "10"},
+		{`match ([1, 2, 3]) { [a, b] => "two", [a, b, c] => a + b + c }`, "6"},
+		{`match ([1, 2, 3]) { [_, ...rest] => rest }`, "[2, 3]"},
+		{`match ([[1, 2], [3]]) { [[a, b], [c]] => a + b + c }`, "6"},
+		{`match ({"kind": "circle", "r": 2}) { {"kind": "square", "side": s} => s, {"kind": "circle", r} => r * 3 }`, "6"},
+		{`match ({1: "one"}) { {1: name} => name }`, "one"},
+		{`struct Point { x, y }; match (Point(3, 4)) { {x: 0} => "axis", {x, y} => x + y }`, "7"},
+		{`match (7) { n if n < 5 => "small", n if n < 10 => "medium", _ => "large" }`, "medium"},
+		{`match ([1]) { [x] if x > 1 => "big", [x] => "small" }`, "small"},
+		{`match (2) { 1 => 10, 2 => { let x = 5; x * 4 } }`, "20"},
+		{`let f = fn(x) { match (x) { 0 => { return "zero"; }, _ => "other" }; "after" }; f(0)`, "zero"},
+		{`let x = 1; match (5) { x => x }; x`, "1"},
+		{`match ([1, 2]) { 3 => "int", "a" => "str", {"a": b} => "hash", [a] => "one", _ => "fallback" }`, "fallback"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (3) { 1 => "one", 2 => "two" }`, "Non-exhaustive match: no pattern matched 3"},
+		{`match ([1, 2]) { [a] => a, [] => 0 }`, "Non-exhaustive match: no pattern matched [1, 2]"},
+		{`match (1) {}`, "Non-exhaustive match: no pattern matched 1"},
+		{`match (1) { n if n + true => n }`, "Operand type mismatch: INTEGER + BOOLEAN"},
+		{`match (-true) { _ => 1 }`, "Unsupported negative operand: BOOLEAN"},
+		{`match (1) { n => n / 0 }`, "Division by zero: 1 / 0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; [a, b, rest]`, "[1, 2, [3, 4]]"},
+		{`let [a, ...rest] = [1]; rest`, "[]"},
+		{`let {name, age} = {"name": "ada", "age": 36}; name + " " + sprintf("%d", age)`, "ada 36"},
+		{`let {"user": {name}, "ids": [first, ..._]} = {"user": {"name": "bo"}, "ids": [7, 8]}; [name, first]`, "[bo, 7]"},
+		{`let [a, b = a * 10] = [2]; b`, "20"},
+		{`let {name, role = "guest"} = {"name": "cy"}; role`, "guest"},
+		{`let {pos: [x, y] = [0, 0]} = {}; x + y`, "0"},
+		{`struct Point { x, y }; let {x, y} = Point(3, 4); x * y`, "12"},
+		{`let [_, second] = [1, 2]; second`, "2"},
+		{`let add = fn([a, b]) { a + b }; add([3, 4])`, "7"},
+		{`let greet = fn({name}, greeting = "hi") { greeting + " " + name }; greet({"name": "al"})`, "hi al"},
+		{`let greet = fn({name}, greeting = "hi") { greeting + " " + name }; greet({"name": "al"}, "yo")`, "yo al"},
+		{`let f = fn(a, b = a + 1, [c, d] = [b, b]) { [a, b, c, d] }; f(1)`, "[1, 2, 2, 2]"},
+		{`let sum = fn([h, ...t]) { if (len(t) == 0) { h } else { h + sum(t) } }; sum([1, 2, 3])`, "6"},
+		{`[[1, 2], [3, 4]].map(fn([a, b]) { a * b })`, "[2, 12]"},
+		{`fn(a, b = 2) { a + b }`, "fn(a, b = 2) {\n(a + b)\n}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDestructuringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b] = [1]; a`, "Cannot destructure [1] with [a, b]: expected 2 elements, got 1"},
+		{`let [a, b] = [1, 2, 3]; a`, "Cannot destructure [1, 2, 3] with [a, b]: expected 2 elements, got 3"},
+		{`let [a, b = 1, c = 2] = []; a`, "Cannot destructure [] with [a, b = 1, c = 2]: expected 1 to 3 elements, got 0"},
+		{`let [a, b, ...r] = [1]; a`, "Cannot destructure [1] with [a, b, ...r]: expected at least 2 elements, got 1"},
+		{`let [a] = "a"; a`, `Cannot destructure "a" with [a]: expected ARRAY, got STRING`},
+		{`let {name} = {"nam": 1}; name`, `Cannot destructure {nam: 1} with {"name": name}: missing key "name"`},
+		{`let {"a": [x]} = {"a": 5}; x`, `Cannot destructure {a: 5} with {"a": [x]}: key "a": expected ARRAY, got INTEGER`},
+		{`let [[x, y]] = [[1]]; x`, "Cannot destructure [[1]] with [[x, y]]: element 0: expected 2 elements, got 1"},
+		{`let {x} = 5; x`, "Cannot destructure 5 with {\"x\": x}: expected HASH, got INTEGER"},
+		{`let [a = 1 / 0] = []; a`, "Division by zero: 1 / 0"},
+		{`let f = fn([a, b]) { a }; f([1])`, "Cannot destructure [1] with [a, b]: expected 2 elements, got 1"},
+		{`let f = fn(a, b = 1) { a }; f()`, "Wrong number of arguments. got=0, want=1"},
+		{`let f = fn(a = 1, b) { a }; f(5)`, "Wrong number of arguments. got=1, want=2"},
+		{`let f = fn([a, b] = [1]) { a }; f()`, "Cannot destructure [1] with [a, b] = [1]: expected 2 elements, got 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	defer debug.SetMaxStack(debug.SetMaxStack(8 << 20)) // Far too little for 100000 nested calls without the trampoline
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let countdown = fn(n) { if (n == 0) { "done" } else { countdown(n - 1) } }; countdown(100000)`, "done"},
+		{`let countdown = fn(n) { if (n == 0) { return "done"; } return countdown(n - 1); }; countdown(100000)`, "done"},
+		{`let count = fn(n, acc) { match (n) { 0 => acc, _ => count(n - 1, acc + 1) } }; count(100000, 0)`, "100000"},
+		{`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+		  let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(100001)`, "false"},
+		{`struct C { n }; impl C { let down = fn(self) { if (self.n == 0) { self } else { C(self.n - 1).down() } }; };
+		  C(100000).down()`, "C{n: 0}"},
+		{`let last = fn(arr) { if (len(arr) == 1) { first(arr) } else { last(rest(arr)) } }; last([1, 2, 3])`, "3"},
+		{`let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(20)`, "2432902008176640000"},
+		{`let f = fn() { len([1, 2]) }; f()`, "2"},
+		{`let f = fn(x) { x }; return f(5); 10`, "5"},
+		{`let f = fn(x) { let y = x * 2; return y; }; f(4)`, "8"},
+		{`map([1, 2], fn(x) { return x + 1; })`, "[2, 3]"},
+		{`map([1, 2], fn(x) { return push([], x); })`, "[[1], [2]]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTailCallErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(n) { if (n == 0) { 1 / 0 } else { f(n - 1) } }; f(10)`, "Division by zero: 1 / 0"},
+		{`let f = fn(n) { g(n) }; let g = fn(a, b) { a }; f(1)`, "Wrong number of arguments. got=1, want=2"},
+		{`let f = fn() { return 5(1); }; f()`, "Not a function: INTEGER"},
+		{`let f = fn() { missing(1) }; f()`, "Identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestResolvedScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; let f = fn(a) { let b = a * 10; fn(c) { x + a + b + c } }; f(2)(3)", 26},
+		{"let x = 1; let f = fn() { let y = x; let x = 5; y + x }; f()", 6},       // x is global until rebound
+		{"let x = 1; let f = fn() { let x = x + 1; x }; f() + x", 3},              // The value still sees the outer x
+		{"let f = fn(c) { if (c) { let y = 1; } y }; let y = 7; f(true) + f(false)", 8}, // Unbound slots fall back
+		{"let f = fn(n) { let x = n; let x = x * 2; x }; f(4)", 8},
+		{"let f = fn() { let g = fn() { h() }; let h = fn() { 3 }; g() }; f()", 3},    // Forward references
+		{"let f = fn(n) { let even = fn(n) { if (n == 0) { 1 } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { 0 } else { even(n - 1) } }; even(n) }; f(10)", 1},
+		{"let f = fn(x) { match (x) { [h, ...t] if h > x[1] => h, [a, b] => { let c = a + b; c * x[0] } } }; f([1, 2])", 3},
+		{"let counter = fn() { let n = 0; fn() { let n = n + 1; n } }; let c = counter(); c() + c()", 2},
+		{"let f = fn() { struct P { x } P(4).x }; f()", 4},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+/*
+ The REPL parses and evaluates one line at a time into the same environment, so functions must keep finding globals
+ declared after them
+ */
+func TestGlobalsAcrossPrograms(t *testing.T) {
+	env := object.NewEnvironment()
+	lines := []string{
+		"let f = fn(a) { a + later }",
+		"let later = 10",
+		"let g = fn() { f(1) }",
+		"let later = 20",
+	}
+	for _, line := range lines { Eval(parser.New(lexer.New(line)).ParseProgram(), env) }
+
+	testIntegerObject(t, Eval(parser.New(lexer.New("g()")).ParseProgram(), env), 21)
+}
+
+func TestTypeAnnotationsDontChangeEvaluation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x: int = 5; x", 5},
+		{"let add = fn(a: int, b: int = 2) -> int { a + b }; add(1)", 3},
+		{"let [a, b]: [int] = [1, 2]; a + b", 3},
+		{`let apply = fn(f: fn(int) -> int, x: int) -> int { f(x) }; apply(fn(n) { n * 2 }, 4)`, 8},
+		{`let x: string = 5; x`, 5}, // Only mockc check looks at annotations
+	}
+
+	for _, tt := range tests { testIntegerObject(t, testEval(tt.input), tt.expected) }
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let g = fn() { yield 1; yield 2; }; collect(g())`, "[1, 2]"},
+		{`let g = fn(n) { for (i in range(n)) { yield i * i } }; g(4).collect()`, "[0, 1, 4, 9]"},
+		{`let g = fn() { for (i in count()) { if (i == 3) { return 0; } yield i; } }; collect(g())`, "[0, 1, 2]"},
+		{`let g = fn() { yield 1; }; let it = g(); [next(it), next(it), next(it, "end")]`, "[1, null, end]"},
+		{`let g = fn() { yield 1; }; g()`, "iterator"},
+		{`let g = fn(a, b = a * 2) { yield a; yield b; }; collect(g(3))`, "[3, 6]"},
+		{`let g = fn(xs) { match (xs) { [h, ...t] => { yield h; for (x in g(t)) { yield x } }, _ => 0 } }; collect(g([1, 2, 3]))`, "[1, 2, 3]"},
+		{`let inner = fn() { yield 1; yield 2; }; let outer = fn() { for (x in inner()) { yield x; yield x * 10; } }; collect(outer())`, "[1, 10, 2, 20]"},
+		{`let g = fn() { yield fn(x) { x + 1 } }; next(g())(1)`, "2"}, // Functions inside a generator aren't generators
+		{`let it = count(5, 5); [next(it), next(it)]`, "[5, 10]"},
+		{`count(9223372036854775807).take(2).collect()`, "[9223372036854775807, 9223372036854775808]"},
+		{`take(count(), 3).collect()`, "[0, 1, 2]"},
+		{`take([1, 2, 3], 2)`, "[1, 2]"},
+		{`iter({"a": 1, "b": 2}).collect()`, "[a, b]"},
+		{`let it = iter([1, 2, 3]); next(it); collect(it)`, "[2, 3]"},
+		{`count().map(fn(x) { x * 3 }).filter(fn(x) { x % 2 == 1 }).take(3).collect()`, "[3, 9, 15]"},
+		{`reduce(take(count(1), 4), fn(acc, x) { acc * x })`, "24"},
+		{`sort(iter([3, 1, 2]))`, "[1, 2, 3]"},
+		{`reverse(iter([1, 2]))`, "[2, 1]"},
+		{`unique(iter([1, 1, 2]))`, "[1, 2]"},
+		{`concat([1], iter([2]))`, "[1, 2]"},
+		{`group_by(iter([1, 2, 3]), fn(x) { x % 2 })`, "{1: [1, 3], 0: [2]}"},
+		{`zip(count(), ["a", "b"])`, "[[0, a], [1, b]]"},
+		{`contains(count(), 100)`, "true"},
+		{`index_of(count(10), 12)`, "2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("%s: got nil", tt.input)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. got=%s, want=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`for (x in [1, 2]) { print(x) }`, "null"},
+		{`let f = fn(xs) { for (x in xs) { if (x > 1) { return x; } } "none" }; [f([1, 5, 2]), f([0])]`, "[5, none]"},
+		{`let f = fn() { for (c in "héllo") { if (c == "é") { return c; } } }; f()`, "é"},
+		{`let f = fn(h) { for (k in h) { return k; } }; f({"b": 1, "a": 2})`, "b"},
+		{`let f = fn(h) { for ([k, v] in entries(h)) { if (v == 2) { return k; } } }; f({"b": 1, "a": 2})`, "a"},
+		{`let f = fn() { for ({name} in [{"name": "x"}]) { return name; } }; f()`, "x"},
+		{`let f = fn() { for (x in [1, 2]) { let y = x * 2; } y }; let y = 0; f()`, "0"}, // Bindings stay in the loop
+		{`let fs = fn() { for (x in [1, 2]) { yield fn() { x } } }; map(collect(fs()), fn(f) { f() })`, "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("%s: got nil", tt.input)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. got=%s, want=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestGeneratorErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let g = fn() { yield 1; yield 1 / 0; yield 3; }; collect(g())`, "Division by zero: 1 / 0"},
+		{`let g = fn() { yield next(it); }; let it = g(); next(it)`, "Generator is already running"},
+		{`for (x in 5) { x }`, "Cannot iterate over INTEGER"},
+		{`for ([a, b] in [[1, 2], 3]) { a }`, "Cannot destructure 3 with [a, b]: expected ARRAY, got INTEGER"},
+		{`next([1])`, "Argument to 'next' must be ITERATOR, got ARRAY"},
+		{`iter(1)`, "Argument to 'iter' must be ARRAY, STRING, HASH, CHANNEL or ITERATOR, got INTEGER"},
+		{`collect(1)`, "Argument to 'collect' must be ARRAY or ITERATOR, got INTEGER"},
+		{`take(count(), -1)`, "Count for 'take' must not be negative, got -1"},
+		{`count("a")`, "Argument to 'count' must be INTEGER, got STRING"},
+		{`count().map(fn(x) { 10 / (2 - x) }).collect()`, "Division by zero: 10 / 0"},
+		{`zip(count(), 1)`, "Argument to 'zip' must be ARRAY or ITERATOR, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+/*
+ Builtins that read a whole iterator stop at a limit rather than run out of memory on an endless one
+ */
+func TestEndlessIterators(t *testing.T) {
+	defer func(limit int) { iteratorLimit = limit }(iteratorLimit)
+	iteratorLimit = 100
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`collect(count())`, "Iterator passed to 'collect' is too long, the limit is 100 values"},
+		{`count().sort()`, "Iterator passed to 'sort' is too long, the limit is 100 values"},
+		{`let g = fn() { for (i in count()) { yield i } }; reverse(g())`, "Iterator passed to 'reverse' is too long, the limit is 100 values"},
+		{`len(collect(take(count(), 100)))`, "100"},
+	}
+
+	for _, tt := range tests {
+		if evaluated := testEval(tt.input); evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. got=%s, want=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+/*
+ A generator that isn't read to the end is stopped when its reader closes it, so it doesn't leave a goroutine behind
+ */
+func TestGeneratorsAreClosed(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	inputs := []string{
+		`let g = fn() { for (i in count()) { yield i; } }; take(g(), 3).collect()`,
+		`let g = fn() { for (i in count()) { yield i; } }; contains(g(), 5)`,
+		`let g = fn() { for (i in count()) { yield i; } }; let f = fn() { for (x in g()) { return x; } }; f()`,
+		`let inner = fn() { for (i in count()) { yield i; } }; let outer = fn() { for (x in inner()) { yield x; } }; next(take(outer(), 1))`,
+		`let g = fn() { yield 1; yield 2; }; zip(g(), [1])`,
+	}
+	for _, input := range inputs {
+		if result := testEval(input); isError(result) { t.Fatalf("%s: %s", input, result.Inspect()) }
+	}
+
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("generators left goroutines running. before=%d, after=%d", before, after)
+	}
+}
+
+func TestTasks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = spawn fn() { 1 + 2 }; await f`, "3"},
+		{`let add = fn(a, b) { a + b }; await spawn add(2, 3)`, "5"},
+		{`let f = spawn fn() { 1 }; [await f, await f]`, "[1, 1]"}, // Awaiting twice gives the same result
+		{`spawn fn() { 1 }`, "future"},
+		{`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; map(map(range(10, 15), fn(n) { spawn fib(n) }), fn(f) { await f })`, "[55, 89, 144, 233, 377]"},
+		{`let x = 1; let f = fn() { x + 1 }; let g = spawn f(); let x = 10; await g`, "11"}, // Arguments are evaluated at spawn, names when the task reads them
+		{`let h = spawn fn() { let [a, b] = [1, 2]; a + b }; await h`, "3"},
+		{`struct Point { x, y } let p = spawn Point(1, 2); (await p).y`, "2"},
+		{`let ch = channel(); spawn fn() { send(ch, "ping") }; recv(ch)`, "ping"},
+		{`let ch = channel(2); send(ch, 1); send(ch, 2); close(ch); [recv(ch), recv(ch), recv(ch), recv(ch, "done")]`, "[1, 2, null, done]"},
+		{`let ch = channel(); spawn fn() { for (i in range(3)) { ch.send(i) } ch.close() }; collect(iter(ch))`, "[0, 1, 2]"},
+		{`let ch = channel(); spawn fn() { send(ch, 1); close(ch) }; let f = fn() { for (x in ch) { return x * 10; } }; f()`, "10"},
+		{`let a = channel(); let b = channel(); spawn fn() { send(b, "b") }; select([a, b])`, "[1, b]"},
+		{`let a = channel(1); select([[a, 5]]); recv(a)`, "5"},
+		{`let a = channel(); select([a], "idle")`, "idle"},
+		{`let a = channel(); close(a); select([a])`, "[0, null]"},
+		{`let jobs = channel(); let results = channel(); let worker = fn() { for (n in jobs) { send(results, n * n) } }; let w = spawn worker(); spawn fn() { each([1, 2, 3], fn(n) { send(jobs, n) }); close(jobs) }; let squares = [recv(results), recv(results), recv(results)]; await w; squares`, "[1, 4, 9]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("%s: got nil", tt.input)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. got=%s, want=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestTaskErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = spawn fn() { 1 / 0 }; await f`, "Division by zero: 1 / 0"},
+		{`let f = spawn fn() { 1 / 0 }; let g = spawn fn() { await f }; await g`, "Division by zero: 1 / 0"},
+		{`spawn 5`, "Cannot spawn INTEGER"},
+		{`spawn missing()`, "Identifier not found: missing"},
+		{`await 5`, "Cannot await INTEGER"},
+		{`let ch = channel(); close(ch); send(ch, 1)`, "Send on closed channel"},
+		{`let ch = channel(); close(ch); ch.close()`, "Channel is already closed"},
+		{`let ch = channel(); close(ch); select([[ch, 1]])`, "Send on closed channel"},
+		{`channel(-1)`, "Capacity for 'channel' must not be negative, got -1"},
+		{`channel(4611686018427387904)`, "Capacity for 'channel' is too big, the limit is 67108864"},
+		{`recv([1])`, "Argument to 'recv' must be CHANNEL, got ARRAY"},
+		{`select([1])`, "Case 0 of 'select' must be CHANNEL or [CHANNEL, value], got 1"},
+		{`select([])`, "select with no cases would wait forever"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+/*
+ A channel closed while a task is waiting to send on it wakes the task up with an error instead of leaving it stuck
+ */
+func TestClosingWakesSenders(t *testing.T) {
+	input := `let ch = channel(); let f = spawn fn() { send(ch, 1); send(ch, 2) }; recv(ch); close(ch); await f`
+	evaluated := testEval(input)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "Send on closed channel" {
+		t.Errorf("expected the blocked send to fail. got=%s", evaluated.Inspect())
+	}
+}
+
+/*
+ Tasks printing at the same time, and at the same time as the program that spawned them, to a writer that isn't safe
+ for that on its own. Run with go test -race
+ */
+func TestTasksShareOutput(t *testing.T) {
+	var out bytes.Buffer
+	runtime := object.NewRuntime()
+	runtime.Stdout = &out
+	runtime.Stderr = &out
+
+	input := `let say = fn(n) { each(range(20), fn(i) { print(n); eprint(n) }) };
+let tasks = map(range(4), fn(n) { spawn say(n) });
+say(4);
+each(tasks, fn(task) { await task });`
+	testEvalWithRuntime(input, runtime)
+
+	if lines := strings.Count(out.String(), "\n"); lines != 200 { t.Errorf("wrong number of lines printed. got=%d, want=200", lines) }
+}
+
+/*
+ Many evaluations sharing one preloaded global environment, the way a service checking rules in parallel would use the
+ interpreter. Run with go test -race to catch anything they share that isn't safe to share
+ */
+func TestConcurrentEvaluation(t *testing.T) {
+	prelude := `struct Order { id, total }
+impl Order { let large = fn(self) { self.total > limits["large"] }; }
+let limits = {"large": 100};
+let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+let evens = fn() { for (n in count()) { if (n % 2 == 0) { yield n } } };
+let report = fn(order) { print(order.id); order.large() };`
+	global := object.NewEnvironment()
+	if result := Eval(parser.New(lexer.New(prelude)).ParseProgram(), global); isError(result) { t.Fatalf("prelude failed: %s", result.Inspect()) }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var out bytes.Buffer
+			rules := object.NewRuntime()
+			rules.Stdout = &out
+			input := fmt.Sprintf(`let id = %d;
+struct Line { total }
+impl Line { let double = fn(self) { self.total * 2 }; }
+let order = Order(id, id * 10);
+[report(order), Line(order.total).double(), fib(10), take(evens(), 2).collect(), limits["large"], await spawn fib(id %% 5)]`, i)
+			program := parser.New(lexer.New(input)).ParseProgram()
+			result := Eval(program, object.NewLayeredEnvironment(global, rules))
+
+			expected := fmt.Sprintf("[%t, %d, 55, [0, 2], 100, %d]", i*10 > 100, i*20, []int{0, 1, 1, 2, 3}[i%5])
+			if result.Inspect() != expected { t.Errorf("rule %d: wrong result. got=%s, want=%s", i, result.Inspect(), expected) }
+			if out.String() != fmt.Sprintf("%d\n", i) { t.Errorf("rule %d: wrong output %q", i, out.String()) }
+		}(i)
+	}
+	wg.Wait()
+
+	if _, ok := global.Get("id"); ok { t.Errorf("names defined by evaluations leaked into the shared environment") }
+}
+
+/*
+ Methods added to a shared struct type would be seen by every evaluation, so only the shared environment can add them
+ */
+func TestLayersCannotAddSharedMethods(t *testing.T) {
+	global := object.NewEnvironment()
+	Eval(parser.New(lexer.New(`struct Order { total }`)).ParseProgram(), global)
+
+	layer := object.NewLayeredEnvironment(global, object.NewRuntime())
+	result := Eval(parser.New(lexer.New(`impl Order { let double = fn(self) { self.total * 2 }; }`)).ParseProgram(), layer)
+	if errObj, ok := result.(*object.Error); !ok || errObj.Message != "Cannot add methods to Order, it's shared with other evaluations" {
+		t.Errorf("impl of a shared struct type should fail. got=%v", result)
+	}
+
+	other := object.NewLayeredEnvironment(global, object.NewRuntime())
+	result = Eval(parser.New(lexer.New(`Order(2).double()`)).ParseProgram(), other)
+	if errObj, ok := result.(*object.Error); !ok || errObj.Message != "Unknown method double on Order" {
+		t.Errorf("another evaluation should not see the method. got=%v", result)
+	}
+
+	local := `struct Order { total }; impl Order { let double = fn(self) { self.total * 2 }; }; Order(2).double()`
+	if result := Eval(parser.New(lexer.New(local)).ParseProgram(), other); result.Inspect() != "4" {
+		t.Errorf("a struct type defined in the layer should take methods. got=%s", result.Inspect())
+	}
+}
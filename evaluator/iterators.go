@@ -0,0 +1,174 @@
+package evaluator
+
+import (
+	"mockc/ast"
+	"mockc/object"
+	"runtime"
+)
+
+// Generators. Calling a function whose body yields doesn't run the body, it returns an iterator that runs the body on
+// a goroutine of its own. The body and whoever is reading the iterator take turns: each value read resumes the body,
+// which runs until it yields that value or finishes, so only one of them is ever running and the body keeps its place
+// between values. A generator that's never read to the end is stopped when its iterator is closed, or garbage
+// collected, by making the yield it's suspended at return an error that unwinds the body
+
+const GENERATOR_NAME = " generator" // Where a generator's body finds its generator, not a name programs can write
+
+// Returned by a yield once the generator is closed. Nothing can catch it, so it always ends the body
+var stopped = &object.Error{Message: "Generator was closed"}
+
+type generator struct {
+	fn       *object.Function
+	env      *object.Environment // The call's environment, the body runs in it
+	resume   chan bool           // Sent by the reader, true to run the body to its next yield and false to stop it
+	steps    chan step           // Sent by the body, each value it yields and then how it finished
+	started  bool
+	running  bool // The body is running, so reading the generator from inside itself can't be allowed
+	finished bool
+}
+
+type step struct {
+	value object.Object // A yielded value, or for the last step nil or the error the body stopped with
+	last  bool
+}
+
+// Never seen by Moxie programs, yields find it in their environment by a name no identifier can have
+func (g *generator) Type() object.ObjectType { return "GENERATOR" }
+func (g *generator) Inspect() string { return "generator" }
+
+func isGenerator(fn *object.Function) bool {
+	return fn.Literal != nil && fn.Literal.Generator
+}
+
+/*
+ The iterator a call to a generator function returns, env is the call's environment with the arguments bound
+ */
+func newGenerator(fn *object.Function, env *object.Environment) *object.Iterator {
+	g := &generator{fn: fn, env: env, resume: make(chan bool), steps: make(chan step)}
+	env.Set(GENERATOR_NAME, g)
+
+	iterator := object.NewIterator(g.next, g.stop)
+	// The body's goroutine only holds on to the generator, so an iterator the program dropped halfway can still be
+	// collected, and closing it then lets the goroutine finish instead of waiting forever
+	runtime.SetFinalizer(iterator, func(it *object.Iterator) { it.Close() })
+
+	return iterator
+}
+
+/*
+ Run the body until it yields or finishes. Time spent in the body is traced as a call to the generator function
+ */
+func (g *generator) next() (object.Object, bool) {
+	if g.finished { return nil, false }
+	if g.running { return newError("Generator is already running"), true }
+
+	tracer := g.env.Runtime().Tracer
+	if tracer != nil { tracer.Call(g.fn) }
+	g.running = true
+	if g.started {
+		g.resume <- true
+	} else {
+		g.started = true
+		go g.run()
+	}
+	result := <-g.steps
+	g.running = false
+	if tracer != nil { tracer.Return() }
+
+	if !result.last { return result.value, true }
+	g.finished = true
+	if result.value == nil { return nil, false }
+	return result.value, true
+}
+
+/*
+ Stop a body suspended at a yield and wait for it to unwind, so it's never running at the same time as its reader
+ */
+func (g *generator) stop() {
+	if !g.started || g.finished { return }
+	if g.running { return } // Closed from inside its own body, which is already unwinding with the error that closed it
+	g.finished = true
+	g.resume <- false
+	<-g.steps
+}
+
+func (g *generator) run() {
+	result := resolveTailCall(unwrapReturnValue(Eval(g.fn.Body, g.env)))
+	if !isError(result) { result = nil } // What the body returns isn't part of the sequence
+
+	g.steps <- step{value: result, last: true}
+}
+
+/*
+ Hand a value to the generator's reader and wait until it wants the next one
+ */
+func evalYieldExpression(node *ast.YieldExpression, env *object.Environment) object.Object {
+	value := Eval(node.Value, env)
+	if isError(value) { return value }
+
+	obj, ok := env.Get(GENERATOR_NAME)
+	if !ok { return newError("yield outside of a generator") }
+	g := obj.(*generator)
+
+	g.steps <- step{value: value}
+	if !<-g.resume { return stopped }
+
+	return NULL
+}
+
+/*
+ An iterator over the values of an array, the characters of a string, the keys of a hash, the values received from a
+ channel until it's closed or an iterator itself. ok is false for anything else
+ */
+func toIterator(obj object.Object) (*object.Iterator, bool) {
+	var values []object.Object
+
+	switch obj := obj.(type) {
+	case *object.Iterator:
+		return obj, true
+	case *object.Channel:
+		return object.NewIterator(obj.Recv, nil), true
+	case *object.Array:
+		values = obj.Elements
+	case *object.String:
+		for _, char := range obj.Value { values = append(values, &object.String{Value: string(char)}) }
+	case *object.Hash:
+		for _, pair := range obj.Pairs() { values = append(values, pair.Key) }
+	default:
+		return nil, false
+	}
+
+	index := 0
+	return object.NewIterator(func() (object.Object, bool) {
+		if index >= len(values) { return nil, false }
+		index++
+		return values[index-1], true
+	}, nil), true
+}
+
+/*
+ Run the body once per element, each bound to the pattern in a fresh environment. A return or error inside the body
+ stops the loop and closes the iterator
+ */
+func evalForExpression(node *ast.ForExpression, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if isError(iterable) { return iterable }
+
+	iterator, ok := toIterator(iterable)
+	if !ok { return newError("Cannot iterate over %s", iterable.Type()) }
+	defer iterator.Close()
+
+	for {
+		element, ok := iterator.Next()
+		if !ok { return NULL }
+		if isError(element) { return element }
+
+		loopEnv := enclose(env, node.Scope)
+		if err := destructure(node.Pattern, element, loopEnv); err != nil { return err }
+
+		result := Eval(node.Body, loopEnv)
+		if result != nil && (result.Type() == object.RETURN_OBJECT || result.Type() == object.ERROR_OBJECT) {
+			return result
+		}
+	}
+}
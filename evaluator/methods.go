@@ -0,0 +1,105 @@
+package evaluator
+
+import (
+	"mockc/ast"
+	"mockc/object"
+)
+
+// Method call syntax, value.method(args). Strings, arrays, hashes, iterators and channels have method tables naming
+// the builtin each method calls with the value as its first argument, so arr.filter(f).map(g) is the same as
+// map(filter(arr, f), g). Structs get their methods from impl blocks instead
+var methods = map[object.ObjectType]map[string]string{
+	object.STRING_OBJECT: methodTable(
+		"len", "split", "trim", "trim_left", "trim_right", "trim_prefix", "trim_suffix", "upper", "lower", "replace",
+		"contains", "starts_with", "ends_with", "index_of", "repeat", "substring", "pad_left", "pad_right", "chars",
+		"json_parse",
+	),
+	object.ARRAY_OBJECT: methodTable(
+		"len", "first", "last", "rest", "push", "map", "filter", "reduce", "each", "sort", "reverse", "zip", "contains",
+		"index_of", "slice", "concat", "flatten", "unique", "group_by", "join", "from_entries", "json_stringify",
+	),
+	object.HASH_OBJECT: methodTable(
+		"len", "keys", "values", "entries", "has", "get", "delete", "merge", "map_values", "json_stringify",
+	),
+	object.ITERATOR_OBJECT: methodTable(
+		"next", "collect", "take", "map", "filter", "reduce", "each", "sort", "reverse", "zip", "contains", "index_of",
+		"concat", "unique", "group_by",
+	),
+	object.CHANNEL_OBJECT: methodTable("send", "recv", "close"),
+}
+
+/*
+ Every method in the tables so far shares its builtin's name
+ */
+func methodTable(names ...string) map[string]string {
+	table := map[string]string{}
+	for _, name := range names { table[name] = name }
+
+	return table
+}
+
+/*
+ Evaluate the method and arguments of receiver.method(args), the receiver goes first in the arguments. A struct field
+ holding a function is called as is, without the receiver, so fields shadow methods of the same name
+ */
+func evalMethodCall(member *ast.MemberExpression, arguments []ast.Expression, env *object.Environment) (object.Object, []object.Object, object.Object) {
+	receiver := Eval(member.Object, env)
+	if isError(receiver) { return nil, nil, receiver }
+
+	method := findMethod(receiver, member.Property.Value)
+	if isError(method) { return nil, nil, method }
+
+	args := evalExpressions(arguments, env)
+	if len(args) == 1 && isError(args[0]) { return nil, nil, args[0] }
+
+	if instance, ok := receiver.(*object.Struct); ok {
+		if _, isField := instance.Get(member.Property.Value); isField { return method, args, nil }
+	}
+
+	return method, append([]object.Object{receiver}, args...), nil
+}
+
+/*
+ The builtin a method of values of type t calls, for tools that look at programs without running them
+ */
+func MethodBuiltin(t object.ObjectType, name string) (string, bool) {
+	builtin, ok := methods[t][name]
+	return builtin, ok
+}
+
+func findMethod(receiver object.Object, name string) object.Object {
+	if instance, ok := receiver.(*object.Struct); ok {
+		if field, ok := instance.Get(name); ok { return field }
+		if method, ok := instance.Definition.Method(name); ok { return method }
+
+		return newError("Unknown method %s on %s", name, instance.Definition.Name)
+	}
+
+	if builtin, ok := methods[receiver.Type()][name]; ok { return builtins[builtin] }
+
+	return newError("Unknown method %s for %s", name, receiver.Type())
+}
+
+/*
+ Attach the methods of an impl block to a struct type, later blocks can add methods or replace earlier ones
+ */
+func evalImplStatement(node *ast.ImplStatement, env *object.Environment) object.Object {
+	obj, ok := env.Get(node.Name.Value)
+	if !ok { return newError("Identifier not found: %s", node.Name.Value) }
+
+	definition, ok := obj.(*object.StructType)
+	if !ok { return newError("Methods can only be added to struct types, got %s", obj.Type()) }
+	if env.Shared(node.Name.Value) { // Methods would show up in every other evaluation, and race with their calls
+		return newError("Cannot add methods to %s, it's shared with other evaluations", definition.Name)
+	}
+
+	for _, method := range node.Methods {
+		fn := Eval(method.Value, env)
+		if isError(fn) { return fn }
+		if !isCallable(fn) { return newError("Method %s of %s must be FUNCTION, got %s", method.Name.Value, definition.Name, fn.Type()) }
+
+		definition.SetMethod(method.Name.Value, fn)
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package evaluator
+
+import (
+	"fmt"
+	"mockc/ast"
+	"mockc/object"
+)
+
+/*
+ Evaluate a match expression. Each arm gets its own environment for the names its pattern binds, so bindings from
+ arms that didn't apply never leak into the arm that does
+ */
+func evalMatchExpression(node *ast.MatchExpression, env *object.Environment) object.Object {
+	arm, armEnv, err := selectArm(node, env)
+	if err != nil { return err }
+
+	return Eval(arm.Body, armEnv)
+}
+
+/*
+ Find the first arm whose pattern and guard accept the subject, along with the environment holding its bindings
+ */
+func selectArm(node *ast.MatchExpression, env *object.Environment) (*ast.MatchArm, *object.Environment, object.Object) {
+	subject := Eval(node.Subject, env)
+	if isError(subject) { return nil, nil, subject }
+
+	for _, arm := range node.Arms {
+		armEnv := enclose(env, arm.Scope)
+		mismatch, err := bindPattern(arm.Pattern, subject, armEnv)
+		if err != nil { return nil, nil, err }
+		if mismatch != "" { continue }
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) { return nil, nil, guard }
+			if !isTruthy(guard) { continue }
+		}
+
+		return arm, armEnv, nil
+	}
+
+	return nil, nil, newError("Non-exhaustive match: no pattern matched %s", subject.Inspect())
+}
+
+/*
+ Match value against pattern, binding names in env as it goes. Returns why the value doesn't fit, or "" if it does,
+ and an error if evaluating a default failed. Names bound before a mismatch stay bound, so callers that try again use
+ a fresh environment
+ */
+func bindPattern(pattern ast.Pattern, value object.Object, env *object.Environment) (string, object.Object) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return "", nil
+
+	case *ast.BindingPattern:
+		bind(pattern.Name, value, env)
+		return "", nil
+
+	case *ast.DefaultPattern: // There is a value, so the default isn't needed
+		return bindPattern(pattern.Pattern, value, env)
+
+	case *ast.LiteralPattern:
+		expected := Eval(pattern.Value, env)
+		if !object.Equal(expected, value) { return fmt.Sprintf("expected %s, got %s", pattern.String(), describe(value)), nil }
+		return "", nil
+
+	case *ast.ArrayPattern:
+		return bindArrayPattern(pattern, value, env)
+
+	case *ast.HashPattern:
+		return bindHashPattern(pattern, value, env)
+	}
+
+	return fmt.Sprintf("unsupported pattern %s", pattern.String()), nil
+}
+
+/*
+ Bind a let or parameter pattern, which unlike a match arm has nowhere else to go when the value doesn't fit
+ */
+func destructure(pattern ast.Pattern, value object.Object, env *object.Environment) object.Object {
+	mismatch, err := bindPattern(pattern, value, env)
+	if err != nil { return err }
+	if mismatch != "" { return newError("Cannot destructure %s with %s: %s", describe(value), pattern.String(), mismatch) }
+
+	return nil
+}
+
+/*
+ Bind a pattern that has no value to match, ex. a missing element. Only patterns with a default can do that, the
+ default is evaluated in env so it can refer to names bound before it
+ */
+func bindMissing(pattern ast.Pattern, env *object.Environment, missing string) (string, object.Object) {
+	withDefault, ok := pattern.(*ast.DefaultPattern)
+	if !ok { return missing, nil }
+
+	value := Eval(withDefault.Default, env)
+	if isError(value) { return "", value }
+
+	return bindPattern(withDefault.Pattern, value, env)
+}
+
+func bindArrayPattern(pattern *ast.ArrayPattern, value object.Object, env *object.Environment) (string, object.Object) {
+	arr, ok := value.(*object.Array)
+	if !ok { return fmt.Sprintf("expected ARRAY, got %s", value.Type()), nil }
+
+	length, want := len(arr.Elements), len(pattern.Elements)
+	required := requiredCount(pattern.Elements)
+	if length < required || pattern.Rest == nil && length > want {
+		return fmt.Sprintf("expected %s, got %d", elementCount(required, want, pattern.Rest != nil), length), nil
+	}
+
+	for i, element := range pattern.Elements {
+		var mismatch string
+		var err object.Object
+		if i < length {
+			mismatch, err = bindPattern(element, arr.Elements[i], env)
+		} else {
+			mismatch, err = bindMissing(element, env, "missing element")
+		}
+		if err != nil { return "", err }
+		if mismatch != "" { return fmt.Sprintf("element %d: %s", i, mismatch), nil }
+	}
+
+	if pattern.Rest == nil { return "", nil }
+
+	rest := []object.Object{}
+	if length > want { rest = append(rest, arr.Elements[want:]...) }
+	return bindPattern(pattern.Rest, &object.Array{Elements: rest}, env)
+}
+
+/*
+ Patterns without a default have to be given a value, so everything up to the last of them is required
+ */
+func requiredCount(patterns []ast.Pattern) int {
+	required := 0
+	for i, pattern := range patterns {
+		if _, ok := pattern.(*ast.DefaultPattern); !ok { required = i + 1 }
+	}
+
+	return required
+}
+
+/*
+ Describe how many elements an array pattern takes, ex. "2 elements", "1 to 3 elements" or "at least 1 element"
+ */
+func elementCount(required, max int, rest bool) string {
+	switch {
+	case rest:
+		return fmt.Sprintf("at least %d %s", required, plural(required, "element"))
+	case required == max:
+		return fmt.Sprintf("%d %s", max, plural(max, "element"))
+	default:
+		return fmt.Sprintf("%d to %d elements", required, max)
+	}
+}
+
+/*
+ Hash patterns also take structs apart, looking up their string keys as field names
+ */
+func bindHashPattern(pattern *ast.HashPattern, value object.Object, env *object.Environment) (string, object.Object) {
+	var lookup func(key object.Object) (object.Object, bool)
+	switch value := value.(type) {
+	case *object.Hash:
+		lookup = func(key object.Object) (object.Object, bool) { return value.Get(key.(object.Hashable)) }
+	case *object.Struct:
+		lookup = func(key object.Object) (object.Object, bool) {
+			name, ok := key.(*object.String)
+			if !ok { return nil, false }
+			return value.Get(name.Value)
+		}
+	default:
+		return fmt.Sprintf("expected HASH, got %s", value.Type()), nil
+	}
+
+	for i, keyExpression := range pattern.Keys {
+		key := Eval(keyExpression, env) // Keys are string or integer literals, so always hashable
+		keyName := (&ast.LiteralPattern{Value: keyExpression}).String()
+
+		element, ok := lookup(key)
+		if !ok {
+			mismatch, err := bindMissing(pattern.Values[i], env, "missing key " + keyName)
+			if mismatch != "" || err != nil { return mismatch, err }
+			continue
+		}
+
+		mismatch, err := bindPattern(pattern.Values[i], element, env)
+		if err != nil { return "", err }
+		if mismatch != "" { return fmt.Sprintf("key %s: %s", keyName, mismatch), nil }
+	}
+
+	return "", nil
+}
+
+/*
+ Show a value in a mismatch message, strings are quoted so they can't be mistaken for other values
+ */
+func describe(value object.Object) string {
+	if str, ok := value.(*object.String); ok { return fmt.Sprintf("%q", str.Value) }
+	return value.Inspect()
+}
+
+func plural(n int, word string) string {
+	if n == 1 { return word }
+	return word + "s"
+}
@@ -0,0 +1,82 @@
+package evaluator
+
+import (
+	"mockc/ast"
+	"mockc/object"
+)
+
+// Tail call optimization. A call in tail position, `return f(x)` or the last expression of a function body, isn't made
+// where it's found. Its function and arguments are handed back to applyFunction as a tailCall instead, and
+// applyFunction makes the call in a loop once the current call has returned. Recursion in tail position then runs in
+// constant Go stack, and each finished call's environment can be collected straight away
+
+type tailCall struct {
+	fn   object.Object
+	args []object.Object
+	env  *object.Environment // Where the call was made, for builtins
+}
+
+// Never seen by Moxie programs, applyFunction and evalProgram always make the call before a value escapes
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string { return "tail call" }
+
+/*
+ Evaluate node where its value is the value of the whole function, calls there become tail calls
+ Anything that isn't a call, a block or a branch is evaluated normally
+ */
+func evalTail(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		traceBlock(node, env)
+		last := len(node.Statements) - 1
+		for i, statement := range node.Statements {
+			traceStatement(statement, env)
+			if i == last { return evalTail(statement, env) }
+
+			result := Eval(statement, env)
+			if result != nil && (result.Type() == object.RETURN_OBJECT || result.Type() == object.ERROR_OBJECT) {
+				return result
+			}
+		}
+		return nil
+
+	case *ast.ExpressionStatement:
+		return evalTail(node.Expression, env)
+
+	case *ast.CallExpression:
+		return evalTailCall(node, env)
+
+	case *ast.IfExpression:
+		condition := Eval(node.Condition, env)
+		if isError(condition) { return condition }
+
+		taken := isTruthy(condition)
+		traceBranch(node, taken, env)
+		if taken { return evalTail(node.Consequence, env) }
+		if node.Alternative != nil { return evalTail(node.Alternative, env) }
+		return NULL
+
+	case *ast.MatchExpression:
+		arm, armEnv, err := selectArm(node, env)
+		if err != nil { return err }
+
+		return evalTail(arm.Body, armEnv)
+	}
+
+	return Eval(node, env)
+}
+
+func evalTailCall(node *ast.CallExpression, env *object.Environment) object.Object {
+	fn, args, err := evalCall(node, env)
+	if err != nil { return err }
+
+	return &tailCall{fn: fn, args: args, env: env}
+}
+
+/*
+ Make a tail call that reached the top of a program, ex. a return statement outside of any function
+ */
+func resolveTailCall(obj object.Object) object.Object {
+	if call, ok := obj.(*tailCall); ok { return applyFunction(call.fn, call.args, call.env) }
+	return obj
+}
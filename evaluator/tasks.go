@@ -0,0 +1,55 @@
+package evaluator
+
+import (
+	"mockc/ast"
+	"mockc/object"
+)
+
+// Tasks. spawn runs a function call on a goroutine of its own and hands back a future for its result, await waits for
+// it. Tasks share whatever their functions close over, environments are safe to use from several tasks at once but
+// iterators aren't, so each iterator should only be read by one task
+//
+// An error only ends the task it happens in. It becomes the task's result, so awaiting the task halts the awaiting code
+// with the same error, as if the call had been made there. An error in a task nobody awaits is lost, and a program
+// doesn't wait for its tasks to finish before it ends
+
+/*
+ Evaluate the function and arguments of the call, then run it on a new task. Anything other than a call has to be a
+ function, which the task calls with no arguments
+ */
+func evalSpawnExpression(node *ast.SpawnExpression, env *object.Environment) object.Object {
+	var function object.Object
+	args := []object.Object{}
+
+	if call, ok := node.Task.(*ast.CallExpression); ok {
+		var err object.Object
+		function, args, err = evalCall(call, env)
+		if err != nil { return err }
+	} else {
+		function = Eval(node.Task, env)
+		if isError(function) { return function }
+	}
+
+	switch function.(type) {
+	case *object.Function, *object.BuiltIn, *object.StructType:
+	default:
+		return newError("Cannot spawn %s", function.Type())
+	}
+
+	taskEnv := object.NewEnclosedEnvironment(env) // Only carries the task's runtime, the call gets its own environment
+	taskEnv.SetRuntime(env.Runtime().Fork())
+
+	future := object.NewFuture()
+	go func() { future.Resolve(resolveTailCall(applyFunction(function, args, taskEnv))) }()
+
+	return future
+}
+
+func evalAwaitExpression(node *ast.AwaitExpression, env *object.Environment) object.Object {
+	value := Eval(node.Future, env)
+	if isError(value) { return value }
+
+	future, ok := value.(*object.Future)
+	if !ok { return newError("Cannot await %s", value.Type()) }
+	return future.Wait()
+}
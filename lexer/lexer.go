@@ -1,19 +1,24 @@
 package lexer
 
-import "mockc/token"
+import (
+	"mockc/token"
+	"strings"
+)
 
 type Lexer struct {
 	input        string
 	position     int  //Current position in input (points to curr char)
 	readPosition int  //Current reading position in input (after current char)
 	ch           byte //Current char being examined
+	line         int  //Line and column of ch, counting from 1
+	column       int
 }
 
 /*
 Basically a constructor
 */
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
@@ -22,6 +27,12 @@ func New(input string) *Lexer {
 Read the current char in input and scoot position and readPosition forward by one
 */
 func (l *Lexer) readChar() {
+	if l.ch == '\n' { // Leaving a newline starts the next line
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
+
 	if l.readPosition >= len(l.input) { // Check if we're at the end of our input
 		l.ch = 0 // ASCII for NULL
 	} else {
@@ -32,16 +43,30 @@ func (l *Lexer) readChar() {
 }
 
 /*
-Tokenizes the current character
+Tokenizes the current character, recording where the token starts
 */
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
 	l.skipWhitespace()
+	line, column, offset := l.line, l.column, l.position
+
+	tok := l.readToken()
+	tok.Line, tok.Column, tok.Offset = line, column, offset
+	return tok
+}
+
+/*
+ The source between two token offsets, ex. everything a function literal was written as
+ */
+func (l *Lexer) Text(start, end int) string {
+	return l.input[start:min(end, len(l.input))]
+}
+
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
-		if l.peekChar() == '=' {
+		if l.peekChar() == '=' || l.peekChar() == '>' {
 			tok = l.makeTwoCharToken()
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
@@ -50,6 +75,14 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.readPosition + 1 < len(l.input) && l.input[l.readPosition + 1] == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -67,7 +100,11 @@ func (l *Lexer) NextToken() token.Token {
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '>' {
+			tok = l.makeTwoCharToken()
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '*':
 		tok = newToken(token.TIMES, l.ch)
 	case '/':
@@ -140,7 +177,7 @@ func (l *Lexer) readNumber() string {
 Similar to isLetter but again, with numbers this time.
 */
 func isDigit(ch byte) bool {
-	return '0' <= ch && ch <= '9' || ch == '.'
+	return '0' <= ch && ch <= '9'
 }
 
 /*
@@ -189,14 +226,17 @@ func (l *Lexer) makeTwoCharToken() token.Token {
 	ch := l.ch // Save current cursor char
 	l.readChar() // Advance cursor
 	literal := string(ch) + string(l.ch) // Combine the two
-	tok := token.Token{Type: determineLeadChar(ch), Literal: literal}
+	tok := token.Token{Type: determineLeadChar(ch, l.ch), Literal: literal}
 	return tok
 }
 
-func determineLeadChar(ch byte) token.TokenType {
+func determineLeadChar(ch, next byte) token.TokenType {
 	switch (ch) {
 	case '=':
+		if next == '>' { return token.ARROW }
 		return token.EQ
+	case '-':
+		return token.RETURNS
 	case '!':
 		return token.NEQ
 	case '>':
@@ -207,13 +247,33 @@ func determineLeadChar(ch byte) token.TokenType {
 	return token.ILLEGAL // This should never come up
 }
 
+/*
+ Read a string literal, unescaping \", \\, \n, \t and \r along the way
+ Any other backslash is kept as is
+ */
 func (l *Lexer) readString() string {
-	position := l.position + 1
+	var out strings.Builder
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 { break } // TODO: Possible improvements: Add error handling if EOF is encountered,
-											  // 	   						  Add escape character support
+		if l.ch == '"' || l.ch == 0 { break } // TODO: Possible improvement: Add error handling if EOF is encountered
+
+		if l.ch == '\\' {
+			if escaped, ok := escapes[l.peekChar()]; ok {
+				l.readChar()
+				out.WriteByte(escaped)
+				continue
+			}
+		}
+		out.WriteByte(l.ch)
 	}
 
-	return l.input[position:l.position]
-}
\ No newline at end of file
+	return out.String()
+}
+
+var escapes = map[byte]byte{
+	'"':  '"',
+	'\\': '\\',
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+}
@@ -7,6 +7,29 @@ import (
 	"testing";
 )
 
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"say \"hi\""`, `say "hi"`},
+		{`"back\\slash"`, `back\slash`},
+		{`"line\nbreak"`, "line\nbreak"},
+		{`"tab\there"`, "tab\there"},
+		{`"keep \q"`, `keep \q`},
+	}
+
+	for _, tt := range tests {
+		tok := New(tt.input).NextToken()
+		if tok.Type != token.STRING {
+			t.Fatalf("token type wrong. expected=%q, got=%q", token.STRING, tok.Type)
+		}
+		if tok.Literal != tt.expected {
+			t.Errorf("literal wrong. expected=%q, got=%q", tt.expected, tok.Literal)
+		}
+	}
+}
+
 func TestNextToken(t *testing.T) {
 	input := `let x = 5;
 	let y = 10;
@@ -28,6 +51,11 @@ func TestNextToken(t *testing.T) {
 	"foo bar"
 	[1, 2];
 	:
+	struct p.x
+	match [h, ...t] => h
+	-> x->y -1
+	for (x in xs) { yield x }
+	await spawn f()
 	`
 
 	tests := []struct {
@@ -156,6 +184,50 @@ func TestNextToken(t *testing.T) {
 		// Colon
 		{token.COLON, ":"},
 
+		// Structs and field access
+		{token.STRUCT, "struct"},
+		{token.IDENTIFIER, "p"},
+		{token.DOT, "."},
+		{token.IDENTIFIER, "x"},
+
+		// Match arms and rest patterns
+		{token.MATCH, "match"},
+		{token.LBRACKET, "["},
+		{token.IDENTIFIER, "h"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENTIFIER, "t"},
+		{token.RBRACKET, "]"},
+		{token.ARROW, "=>"},
+		{token.IDENTIFIER, "h"},
+
+		// Return type annotations
+		{token.RETURNS, "->"},
+		{token.IDENTIFIER, "x"},
+		{token.RETURNS, "->"},
+		{token.IDENTIFIER, "y"},
+		{token.MINUS, "-"},
+		{token.INTEGER, "1"},
+
+		// Loops and generators
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENTIFIER, "x"},
+		{token.IN, "in"},
+		{token.IDENTIFIER, "xs"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.YIELD, "yield"},
+		{token.IDENTIFIER, "x"},
+		{token.RBRACE, "}"},
+
+		// Tasks
+		{token.AWAIT, "await"},
+		{token.SPAWN, "spawn"},
+		{token.IDENTIFIER, "f"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+
 		{token.EOF, ""},
 	}
 
@@ -173,3 +245,43 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x >= \"a\nb\" ...\n\tfn"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+		expectedOffset  int
+	}{
+		{"let", 1, 1, 0},
+		{"x", 1, 5, 4},
+		{"=", 1, 7, 6},
+		{"5", 1, 9, 8},
+		{";", 1, 10, 9},
+		{"x", 2, 3, 13},
+		{">=", 2, 5, 15},
+		{"a\nb", 2, 8, 18},
+		{"...", 3, 4, 24}, // Strings can span lines
+		{"fn", 4, 2, 29},
+		{"", 4, 4, 31},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tokenliteral wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - %q has wrong position. expected=%d:%d, got=%d:%d", i, tok.Literal, tt.expectedLine,
+				tt.expectedColumn, tok.Line, tok.Column)
+		}
+		if tok.Offset != tt.expectedOffset {
+			t.Errorf("tests[%d] - %q has wrong offset. expected=%d, got=%d", i, tok.Literal, tt.expectedOffset, tok.Offset)
+		}
+	}
+}
@@ -1,13 +1,27 @@
 package main
 
 import (
-	"fmt"        // Formatting library
-	"mockc/repl" // Our REPL
-	"os"         // Operating system library
-	"os/user"    // User package from the OS library
+	"fmt"          // Formatting library
+	"mockc/object" // Runtime the REPL's programs run under
+	"mockc/repl"   // Our REPL
+	"os"           // Operating system library
+	"os/user"      // User package from the OS library
 )
 
 func main() {
+	if len(os.Args) > 1 { // Subcommands come first, anything else starts the REPL
+		switch os.Args[1] {
+		case "test":
+			os.Exit(testCommand(os.Args[2:]))
+		case "run":
+			os.Exit(runCommand(os.Args[2:]))
+		case "cover":
+			os.Exit(coverCommand(os.Args[2:]))
+		case "check":
+			os.Exit(checkCommand(os.Args[2:]))
+		}
+	}
+
 	user, err := user.Current() // Returns current user
 
 	if err != nil { // If any error is present, panic immediately!
@@ -16,7 +30,21 @@ func main() {
 	fmt.Printf("Hello %s! This is the Moxie programming language!\n",
 		user.Username)
 	fmt.Printf("To start using it, just start typing in commands\n")
-	repl.Start(os.Stdin, os.Stdout) // Assuming this is equiv. to Java System.stdin and System.stdout
+	repl.Start(os.Stdin, os.Stdout, hostRuntime()) // Assuming this is equiv. to Java System.stdin and System.stdout
+}
+
+/*
+ Programs run from the command line are trusted as much as the user running them, so they get the working directory,
+ the environment variables and a real exit
+ */
+func hostRuntime() *object.Runtime {
+	runtime := object.NewRuntime()
+	cwd, err := os.Getwd()
+	if err == nil { runtime.Policy.AllowedDirs = []string{cwd} }
+	runtime.Policy.AllowEnv = true
+	runtime.Exit = os.Exit
+
+	return runtime
 }
 
 
@@ -0,0 +1,149 @@
+package object
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Values tasks use to talk to each other. Unlike Go channels, sending on a closed channel or closing one twice is
+// reported to the caller instead of panicking, so a Moxie program can turn it into an error
+
+/*
+ Channel passes values between tasks. Receiving from a closed channel still hands out whatever was sent before it
+ closed, then reports that it's closed
+ */
+type Channel struct {
+	values   chan Object
+	closed   chan struct{} // Closed by Close, which wakes up every sender and receiver waiting on the channel
+	closeOne sync.Once
+}
+
+/*
+ Constructor for a channel holding up to capacity values no one has received yet. With 0 every send waits for a
+ receiver
+ */
+func NewChannel(capacity int) *Channel {
+	return &Channel{values: make(chan Object, capacity), closed: make(chan struct{})}
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJECT }
+func (c *Channel) Inspect() string { return "channel" }
+
+/*
+ Wait until value is received or there's room for it. False if the channel is closed, including while waiting
+ */
+func (c *Channel) Send(value Object) bool {
+	select {
+	case <-c.closed: // Checked first so sending on a closed channel with room left never goes through
+		return false
+	default:
+	}
+
+	select {
+	case c.values <- value:
+		return true
+	case <-c.closed:
+		return false
+	}
+}
+
+/*
+ Wait for the next value, ok is false once the channel is closed and everything sent before has been received
+ */
+func (c *Channel) Recv() (Object, bool) {
+	select {
+	case value := <-c.values:
+		return value, true
+	case <-c.closed:
+		return c.drain()
+	}
+}
+
+func (c *Channel) drain() (Object, bool) {
+	select {
+	case value := <-c.values:
+		return value, true
+	default:
+		return nil, false
+	}
+}
+
+/*
+ Close the channel, false if it already was
+ */
+func (c *Channel) Close() bool {
+	closed := false
+	c.closeOne.Do(func() {
+		close(c.closed)
+		closed = true
+	})
+	return closed
+}
+
+/*
+ One channel operation in a Select, a receive unless Send is set
+ */
+type SelectCase struct {
+	Channel *Channel
+	Send    Object
+}
+
+/*
+ Wait until one of cases can go ahead and do it, picking at random if several can. Returns which case ran, the value
+ it received (nil for a send) and false if its channel turned out to be closed. Unless block is set Select doesn't
+ wait, and returns -1 if no case is ready
+ */
+func Select(cases []SelectCase, block bool) (int, Object, bool) {
+	options := []reflect.SelectCase{} // Two per case: the operation itself and its channel closing
+	for _, c := range cases {
+		operation := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.Channel.values)}
+		if c.Send != nil {
+			operation = reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(c.Channel.values), Send: reflect.ValueOf(c.Send)}
+		}
+		options = append(options, operation, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.Channel.closed)})
+	}
+	if !block { options = append(options, reflect.SelectCase{Dir: reflect.SelectDefault}) }
+
+	chosen, received, _ := reflect.Select(options)
+	if chosen == len(cases)*2 { return -1, nil, false }
+
+	index := chosen / 2
+	if chosen%2 == 1 { // Closed
+		if cases[index].Send != nil { return index, nil, false }
+		value, ok := cases[index].Channel.drain()
+		return index, value, ok
+	}
+	if cases[index].Send != nil { return index, nil, true }
+	return index, received.Interface().(Object), true
+}
+
+/*
+ Future is the result of a spawned task, available once the task finishes
+ */
+type Future struct {
+	done   chan struct{}
+	result Object
+}
+
+func NewFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+func (f *Future) Type() ObjectType { return FUTURE_OBJECT }
+func (f *Future) Inspect() string { return "future" }
+
+/*
+ Set the result and wake up everyone waiting for it. Only the task the future belongs to calls this, once
+ */
+func (f *Future) Resolve(result Object) {
+	f.result = result
+	close(f.done)
+}
+
+/*
+ Wait for the task to finish and return its result
+ */
+func (f *Future) Wait() Object {
+	<-f.done
+	return f.result
+}
@@ -0,0 +1,125 @@
+package object
+
+import "math/big"
+
+// Structural equality and ordering shared by the evaluator's comparison operators and the sort builtin
+
+/*
+ Values with a natural ordering
+ Compare returns a negative number, zero or a positive number when the receiver is less than, equal to or greater than
+ other, ok is false when the two values can't be ordered against each other
+ */
+type Comparable interface {
+	Object
+	Compare(other Object) (result int, ok bool)
+}
+
+/*
+ Deep equality, arrays, hashes and structs are equal when their contents are
+ Values without a notion of structure, like functions, are only equal to themselves
+ */
+func Equal(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer, *BigInteger:
+		result, ok := Compare(a, b)
+		return ok && result == 0
+	case *String, *Boolean:
+		return keysEqual(a, b)
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Array:
+		other, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(other.Elements) { return false }
+
+		for i, element := range a.Elements {
+			if !Equal(element, other.Elements[i]) { return false }
+		}
+		return true
+	case *Hash:
+		other, ok := b.(*Hash)
+		return ok && a.Equals(other)
+	case *Struct:
+		other, ok := b.(*Struct)
+		if !ok || a.Definition != other.Definition { return false } // Same shape from different declarations still differs
+
+		for i, value := range a.Values {
+			if !Equal(value, other.Values[i]) { return false }
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+/*
+ Order a against b, ok is false if a isn't Comparable or the two can't be ordered
+ */
+func Compare(a, b Object) (int, bool) {
+	comparable, ok := a.(Comparable)
+	if !ok { return 0, false }
+
+	return comparable.Compare(b)
+}
+
+func (i *Integer) Compare(other Object) (int, bool) {
+	switch o := other.(type) {
+	case *Integer:
+		switch {
+		case i.Value < o.Value:
+			return -1, true
+		case i.Value > o.Value:
+			return 1, true
+		default:
+			return 0, true
+		}
+	case *BigInteger:
+		return big.NewInt(i.Value).Cmp(o.Value), true
+	default:
+		return 0, false
+	}
+}
+
+func (bi *BigInteger) Compare(other Object) (int, bool) {
+	switch o := other.(type) {
+	case *Integer:
+		return bi.Value.Cmp(big.NewInt(o.Value)), true
+	case *BigInteger:
+		return bi.Value.Cmp(o.Value), true
+	default:
+		return 0, false
+	}
+}
+
+/*
+ Strings are ordered byte by byte, which for UTF-8 text is the same as ordering by code point
+ */
+func (s *String) Compare(other Object) (int, bool) {
+	o, ok := other.(*String)
+	if !ok { return 0, false }
+
+	switch {
+	case s.Value < o.Value:
+		return -1, true
+	case s.Value > o.Value:
+		return 1, true
+	default:
+		return 0, true
+	}
+}
+
+/*
+ Arrays are ordered lexicographically, the first unequal element decides and a proper prefix sorts first
+ */
+func (a *Array) Compare(other Object) (int, bool) {
+	o, ok := other.(*Array)
+	if !ok { return 0, false }
+
+	for i := 0; i < len(a.Elements) && i < len(o.Elements); i++ {
+		result, ok := Compare(a.Elements[i], o.Elements[i])
+		if !ok { return 0, false } // One incomparable pair makes the whole arrays incomparable
+		if result != 0 { return result, true }
+	}
+
+	return len(a.Elements) - len(o.Elements), true
+}
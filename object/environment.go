@@ -1,45 +1,200 @@
 package object
 
-// Declared variables are saved in a hashmap-based environment, defined below
+import (
+	"sort"
+	"sync"
+)
+
+// Declared variables are saved in an environment, defined below. Function calls and match arms the resolver has seen
+// keep their names in slots, everything else (ex. the global environment) keeps them in a hashmap
+// Spawned tasks share the environments they close over, so every environment guards its names with a lock of its own
 
 /*
  Constructor for enclosed environments, ex. environment of a function
  */
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: outer, runtime: outer.runtime} // Enclosed environments share their outer's runtime
+}
+
+/*
+ Constructor for enclosed environments with one slot per name, in the order the resolver assigned them
+ names is shared by every environment of the same scope, so it must not be changed
+ */
+func NewScopedEnvironment(outer *Environment, names []string) *Environment {
+	return &Environment{slots: make([]Object, len(names)), names: names, outer: outer, runtime: outer.runtime}
 }
 
 /*
  Constructor for an unenclosed environment, ex. the global environment
+ It gets a fresh Runtime with no capabilities
  */
 func NewEnvironment() *Environment {
+	return NewEnvironmentWithRuntime(NewRuntime())
+}
+
+/*
+ Constructor for the global environment of one evaluation against a shared, preloaded one, ex. a service checking many
+ rules at once against the same definitions. Names the evaluation defines stay in the new environment and everything
+ else is looked up in shared, so evaluations running side by side never see each other's names. Struct types from
+ shared can't be given methods, every evaluation would see those too. Everything runs under runtime, including
+ functions defined in shared
+ */
+func NewLayeredEnvironment(shared *Environment, runtime *Runtime) *Environment {
+	return &Environment{store: make(map[string]Object), outer: shared, runtime: runtime, layer: true}
+}
+
+/*
+ Constructor for a global environment whose programs run under a runtime set up by the host
+ */
+func NewEnvironmentWithRuntime(runtime *Runtime) *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: s, outer: nil, runtime: runtime}
 }
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	mu      sync.RWMutex
+	store   map[string]Object // Names without a slot. nil in scoped environments until one is set
+	slots   []Object          // A nil slot hasn't been bound yet
+	names   []string          // Name of each slot
+	outer   *Environment
+	runtime *Runtime
+	layer   bool // Made by NewLayeredEnvironment, everything further out is shared with other evaluations
 }
 
+/*
+ The runtime of the interpreter this environment belongs to
+ */
+func (e *Environment) Runtime() *Runtime { return e.runtime }
+
+/*
+ Run everything evaluated in this environment under runtime instead of its outer's, ex. a function called by a spawned
+ task. Only for environments nothing has been evaluated in yet
+ */
+func (e *Environment) SetRuntime(runtime *Runtime) { e.runtime = runtime }
+
 /*
  Fetch from environment map
  If an outer map exists, check there if name not in self
  */
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
+	obj, ok := e.getLocal(name)
 	if !ok && e.outer != nil { // If the name cannot be found and there's an outer environemnt, check there
 		obj, ok = e.outer.Get(name)
 	}
 	return obj, ok
 }
 
+func (e *Environment) getLocal(name string) (Object, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for slot, slotName := range e.names {
+		if slotName == name && e.slots[slot] != nil { return e.slots[slot], true }
+	}
+	obj, ok := e.store[name]
+	return obj, ok
+}
+
+/*
+ Whether name is bound beyond a layered environment, in the environment it shares with other evaluations
+ */
+func (e *Environment) Shared(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.getLocal(name); ok { return false }
+		if env.layer && env.outer != nil {
+			_, ok := env.outer.Get(name)
+			return ok
+		}
+	}
+
+	return false
+}
+
+/*
+ Fetch a resolved name from its slot, depth environments out
+ A slot that hasn't been bound yet falls back to looking the name up further out, same as Get would
+ */
+func (e *Environment) GetSlot(depth, slot int, name string) (Object, bool) {
+	env := e
+	for ; depth > 0 && env.outer != nil; depth-- { env = env.outer }
+
+	env.mu.RLock()
+	obj, ok := env.store[name]
+	if slot < len(env.slots) && env.slots[slot] != nil { obj, ok = env.slots[slot], true }
+	env.mu.RUnlock()
+
+	if ok { return obj, true }
+	if env.outer == nil { return nil, false }
+	return env.outer.Get(name)
+}
+
 /*
  Add a value to the environment
  */
 func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for slot, slotName := range e.names {
+		if slotName == name {
+			e.slots[slot] = val
+			return val
+		}
+	}
+
+	if e.store == nil { e.store = make(map[string]Object) } // Ex. a host setting a name the resolver never saw
 	e.store[name] = val
 	return val
-}
\ No newline at end of file
+}
+
+/*
+ Bind a resolved name in its slot of this environment
+ */
+func (e *Environment) SetSlot(slot int, name string, val Object) Object {
+	if slot >= len(e.slots) || e.names[slot] != name { return e.Set(name, val) } // Not the scope it was resolved for
+
+	e.mu.Lock()
+	e.slots[slot] = val
+	e.mu.Unlock()
+	return val
+}
+
+/*
+ The environment this one is enclosed by, nil for a global environment
+ */
+func (e *Environment) Outer() *Environment { return e.outer }
+
+/*
+ The names the resolver gave slots to, in slot order, nil if the environment has no slots
+ */
+func (e *Environment) SlotNames() []string { return e.names }
+
+/*
+ A name bound directly in an environment and its value
+ */
+type Binding struct {
+	Name  string
+	Value Object
+}
+
+/*
+ Every name bound directly in this environment, not in the ones enclosing it. Slots come first in slot order, then the
+ other names sorted. Slots that haven't been bound yet are left out
+ */
+func (e *Environment) Bindings() []Binding {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	bindings := []Binding{}
+	for slot, name := range e.names {
+		if e.slots[slot] != nil { bindings = append(bindings, Binding{Name: name, Value: e.slots[slot]}) }
+	}
+
+	names := []string{}
+	for name := range e.store { names = append(names, name) }
+	sort.Strings(names)
+	for _, name := range names { bindings = append(bindings, Binding{Name: name, Value: e.store[name]}) }
+
+	return bindings
+}
@@ -0,0 +1,47 @@
+package object
+
+/*
+ Iterator hands out a sequence's values one at a time, ex. the values a generator yields, so sequences never need to
+ be held in memory all at once and can go on forever. Iterators are used up as they're read, so each value is only
+ handed out once
+ */
+type Iterator struct {
+	next func() (Object, bool) // The next value, false once there are none left
+	stop func()                // Called once when the iterator is closed, nil if there's nothing to clean up
+	done bool
+}
+
+/*
+ Constructor for an iterator producing the values next returns. stop releases whatever is producing them, ex. a
+ generator suspended in the middle of its body, and may be nil
+ */
+func NewIterator(next func() (Object, bool), stop func()) *Iterator {
+	return &Iterator{next: next, stop: stop}
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJECT }
+func (it *Iterator) Inspect() string { return "iterator" }
+
+/*
+ The next value, ok is false once there are none left. An error ends the iterator, it's returned as a value once and
+ every later call reports that the iterator is used up
+ */
+func (it *Iterator) Next() (Object, bool) {
+	if it.done { return nil, false }
+
+	value, ok := it.next()
+	if !ok || value.Type() == ERROR_OBJECT { it.Close() }
+	if !ok { return nil, false }
+
+	return value, true
+}
+
+/*
+ Stop iterating before the end, ex. when a loop returns early. Later calls to Next report that the iterator is used
+ up. Closing an iterator more than once does nothing
+ */
+func (it *Iterator) Close() {
+	if it.done { return }
+	it.done = true
+	if it.stop != nil { it.stop() }
+}
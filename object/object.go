@@ -6,11 +6,15 @@ import (
 	"mockc/ast"
 	"strings"
 	"hash/fnv"
+	"math/big"
+	"sync"
+	"sync/atomic"
 )
 
 type ObjectType string
 const (
 	INTEGER_OBJECT  = "INTEGER"
+	BIG_INTEGER_OBJECT = "BIG_INTEGER"
 	BOOLEAN_OBJECT  = "BOOLEAN"
 	NULL_OBJECT     = "NULL"
 	RETURN_OBJECT   = "RETURN"
@@ -20,6 +24,11 @@ const (
 	BUILTIN_OBJECT  = "BUILTIN"
 	ARRAY_OBJECT    = "ARRAY"
 	HASH_OBJECT     = "HASH"
+	STRUCT_TYPE_OBJECT = "STRUCT_TYPE"
+	STRUCT_OBJECT   = "STRUCT"
+	ITERATOR_OBJECT = "ITERATOR"
+	CHANNEL_OBJECT  = "CHANNEL"
+	FUTURE_OBJECT   = "FUTURE"
 )
 
 // All values encountered when evaluating Moxie source code will be wrapped in a struct fulfilling the Object interface
@@ -29,10 +38,11 @@ type Object interface { // Note for myself: interfaces abstractly define behavio
 }
 
 type Hashable interface {
+	Object
 	HashKey() HashKey
 }
 
-type HashKey struct { // Possible hashing improvements: separate chaining for collisions, caching hash keys for improved performance
+type HashKey struct { // Only a digest of the key, hashes chain colliding keys and compare them with keysEqual
 	Type  ObjectType
 	Value uint64
 }
@@ -47,6 +57,25 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+/*
+ Integers that don't fit in 64 bits
+ The evaluator only produces a BigInteger when a value is out of Integer's range, so any value that fits is always an
+ Integer and the two never need to compare equal
+ */
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (bi *BigInteger) Type() ObjectType { return BIG_INTEGER_OBJECT }
+func (bi *BigInteger) Inspect() string { return bi.Value.String() }
+func (bi *BigInteger) HashKey() HashKey {
+	hash := fnv.New64a()
+	hash.Write([]byte{byte(bi.Value.Sign() + 1)}) // Bytes drops the sign, so mix it in first
+	hash.Write(bi.Value.Bytes())
+
+	return HashKey{Type: bi.Type(), Value: hash.Sum64()}
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -86,8 +115,11 @@ func (e *Error) Inspect() string { return e.Message }
 
 type Function struct {
 	Parameters []*ast.Identifier
+	Patterns   []ast.Pattern // Same as the literal's, nil when every parameter is a plain name
 	Body       *ast.BlockStatement
+	Scope      *ast.Scope // Slots for each call's environment, nil if the literal was never resolved
 	Env 	   *Environment
+	Literal    *ast.FunctionLiteral // Where the function was defined, for its name and position
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJECT }
@@ -96,7 +128,7 @@ func (f *Function) Inspect() string {
 	var out bytes.Buffer
 	params := []string{}
 
-	for _, p := range f.Parameters { params = append(params, p.String())}
+	for i, p := range f.Parameters { params = append(params, ast.ParameterString(p, f.Patterns, i))}
 
 	out.WriteString("fn")
 	out.WriteString("(")
@@ -110,18 +142,26 @@ func (f *Function) Inspect() string {
 
 type String struct {
 	Value string
+
+	hashKey atomic.Pointer[HashKey] // Cached by HashKey, strings are never modified after creation
 }
 
 func (s *String) Type() ObjectType { return STRING_OBJECT }
 func (s *String) Inspect() string { return s.Value }
 func (s *String) HashKey() HashKey {
+	if key := s.hashKey.Load(); key != nil { return *key } // Repeated lookups with the same string skip rehashing
+
 	hash := fnv.New64a()
 	hash.Write([]byte(s.Value))
 
-	return HashKey{Type: s.Type(), Value: hash.Sum64()}
+	key := &HashKey{Type: s.Type(), Value: hash.Sum64()}
+	s.hashKey.Store(key) // Strings can be shared between tasks, two of them storing the same key at once is harmless
+	return *key
 }
 
-type BuiltInFunction func(args ...Object) Object // Basic built in abstract signature, accepts 0 or more objects as args and returns an object
+// Basic built in abstract signature, accepts 0 or more objects as args and returns an object
+// env is the caller's environment, which gives builtins access to the interpreter's Runtime
+type BuiltInFunction func(env *Environment, args ...Object) Object
 
 type BuiltIn struct {
 	Fn BuiltInFunction
@@ -155,8 +195,22 @@ type HashPair struct {
 	Value Object
 }
 
+/*
+ Hashes remember the order their keys were first inserted in. Lookups go through index in O(1), while entries keeps the
+ pairs in insertion order so iteration, equality and Inspect all behave the same way on every run
+ Different keys can share a HashKey, so each index bucket lists every position with that digest and lookups compare
+ the full keys before accepting a match
+ */
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	index   map[HashKey][]int // Positions in entries of every key with this digest
+	entries []HashPair
+}
+
+/*
+ Constructor for an empty hash
+ */
+func NewHash() *Hash {
+	return &Hash{index: make(map[HashKey][]int)}
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJECT }
@@ -164,7 +218,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.entries {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 
@@ -173,4 +227,178 @@ func (h *Hash) Inspect() string {
 	out.WriteString("}")
 
 	return out.String()
-}
\ No newline at end of file
+}
+
+/*
+ Add a key/value pair to the hash
+ Overwriting an existing key replaces its value but keeps the key in its original position
+ */
+func (h *Hash) Set(key Hashable, value Object) {
+	if h.index == nil { h.index = make(map[HashKey][]int) } // Allows &Hash{} to be used directly
+
+	hashed := key.HashKey()
+	if position, ok := h.find(hashed, key); ok {
+		h.entries[position].Value = value
+		return
+	}
+
+	h.index[hashed] = append(h.index[hashed], len(h.entries))
+	h.entries = append(h.entries, HashPair{Key: key, Value: value})
+}
+
+/*
+ Fetch the value stored under key, ok is false if the key is missing
+ */
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	position, ok := h.find(key.HashKey(), key)
+	if !ok { return nil, false }
+
+	return h.entries[position].Value, true
+}
+
+/*
+ A copy of the hash without key, the remaining pairs keep their order
+ */
+func (h *Hash) Without(key Hashable) *Hash {
+	result := NewHash()
+	for _, pair := range h.entries {
+		if keysEqual(pair.Key, key) { continue }
+		result.Set(pair.Key.(Hashable), pair.Value)
+	}
+
+	return result
+}
+
+/*
+ Search the bucket for hashed for an entry whose key is really equal to key
+ */
+func (h *Hash) find(hashed HashKey, key Hashable) (int, bool) {
+	for _, position := range h.index[hashed] { // Usually zero or one entries, more only on a digest collision
+		if keysEqual(h.entries[position].Key, key) { return position, true }
+	}
+
+	return 0, false
+}
+
+/*
+ Number of pairs in the hash
+ */
+func (h *Hash) Len() int { return len(h.entries) }
+
+/*
+ The hash's pairs in insertion order
+ The returned slice is shared with the hash, so callers must not modify it
+ */
+func (h *Hash) Pairs() []HashPair { return h.entries }
+
+/*
+ Two hashes are equal when they hold equal pairs in the same insertion order
+ */
+func (h *Hash) Equals(other *Hash) bool {
+	if h.Len() != other.Len() { return false }
+
+	for i, pair := range h.entries {
+		otherPair := other.entries[i]
+		if !keysEqual(pair.Key, otherPair.Key) || !Equal(pair.Value, otherPair.Value) { return false }
+	}
+
+	return true
+}
+
+/*
+ Compare two keys by their full values rather than their digests
+ */
+func keysEqual(a, b Object) bool {
+	switch a := a.(type) {
+	case *String:
+		other, ok := b.(*String)
+		return ok && a.Value == other.Value
+	case *Integer:
+		other, ok := b.(*Integer)
+		return ok && a.Value == other.Value
+	case *BigInteger:
+		other, ok := b.(*BigInteger)
+		return ok && a.Value.Cmp(other.Value) == 0
+	case *Boolean:
+		other, ok := b.(*Boolean)
+		return ok && a.Value == other.Value
+	default:
+		return a == b
+	}
+}
+
+// Declared with struct Point { x, y }, calling it with one value per field constructs a Struct
+type StructType struct {
+	Name    string
+	Fields  []string
+	methods map[string]Object // Added by impl blocks, each is called with the instance as its first argument
+	mu      sync.RWMutex      // impl blocks can run while other tasks are calling methods
+}
+
+func (st *StructType) Method(name string) (Object, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	method, ok := st.methods[name]
+	return method, ok
+}
+
+/*
+ Every method added so far, by name
+ */
+func (st *StructType) Methods() map[string]Object {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	methods := map[string]Object{}
+	for name, method := range st.methods { methods[name] = method }
+	return methods
+}
+
+/*
+ Add a method or replace the one with the same name
+ */
+func (st *StructType) SetMethod(name string, method Object) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.methods == nil { st.methods = map[string]Object{} }
+	st.methods[name] = method
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJECT }
+func (st *StructType) Inspect() string { return "struct " + st.Name + " { " + strings.Join(st.Fields, ", ") + " }" }
+
+/*
+ Position of a field in Struct.Values, or -1 if the type has no such field
+ */
+func (st *StructType) FieldIndex(name string) int {
+	for i, field := range st.Fields {
+		if field == name { return i }
+	}
+
+	return -1
+}
+
+type Struct struct {
+	Definition *StructType
+	Values     []Object // One per field, in declaration order
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJECT }
+func (s *Struct) Inspect() string {
+	fields := []string{}
+	for i, field := range s.Definition.Fields { fields = append(fields, field + ": " + s.Values[i].Inspect()) }
+
+	return s.Definition.Name + "{" + strings.Join(fields, ", ") + "}"
+}
+
+/*
+ Look up a field's value by name
+ */
+func (s *Struct) Get(name string) (Object, bool) {
+	index := s.Definition.FieldIndex(name)
+	if index < 0 { return nil, false }
+
+	return s.Values[index], true
+}
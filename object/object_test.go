@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -16,4 +20,217 @@ func TestStringHashKey(t *testing.T) {
 	if hello1.HashKey() == diff1.HashKey() {
 		t.Errorf("strings with different content have same hash keys")
 	}
-}
\ No newline at end of file
+}
+func TestHashInsertionOrder(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&String{Value: "zebra"}, &Integer{Value: 1})
+	hash.Set(&Integer{Value: 10}, &Integer{Value: 2})
+	hash.Set(&Boolean{Value: true}, &Integer{Value: 3})
+	hash.Set(&String{Value: "zebra"}, &Integer{Value: 4}) // Overwrite keeps the original slot
+
+	if hash.Len() != 3 {
+		t.Fatalf("hash has wrong number of pairs. got=%d", hash.Len())
+	}
+
+	expectedKeys := []string{"zebra", "10", "true"}
+	for i, pair := range hash.Pairs() {
+		if pair.Key.Inspect() != expectedKeys[i] {
+			t.Errorf("pair %d has wrong key. got=%q, want=%q", i, pair.Key.Inspect(), expectedKeys[i])
+		}
+	}
+
+	if hash.Inspect() != "{zebra: 4, 10: 2, true: 3}" {
+		t.Errorf("hash.Inspect() is wrong. got=%q", hash.Inspect())
+	}
+
+	value, ok := hash.Get(&String{Value: "zebra"})
+	if !ok || value.Inspect() != "4" {
+		t.Errorf("hash.Get returned wrong value. got=%v, ok=%t", value, ok)
+	}
+	if _, ok := hash.Get(&String{Value: "missing"}); ok {
+		t.Errorf("hash.Get found a key that was never set")
+	}
+}
+
+func TestHashEquals(t *testing.T) {
+	build := func(keys ...string) *Hash {
+		hash := &Hash{}
+		for _, key := range keys {
+			hash.Set(&String{Value: key}, &Integer{Value: 1})
+		}
+		return hash
+	}
+
+	if !build("a", "b").Equals(build("a", "b")) {
+		t.Errorf("hashes with the same pairs in the same order are not equal")
+	}
+	if build("a", "b").Equals(build("b", "a")) {
+		t.Errorf("hashes with different insertion order are equal")
+	}
+	if build("a").Equals(build("a", "b")) {
+		t.Errorf("hashes with different lengths are equal")
+	}
+}
+
+func TestStringHashKeyCached(t *testing.T) {
+	str := &String{Value: "cache me"}
+	first := str.HashKey()
+
+	if str.hashKey.Load() == nil {
+		t.Fatalf("hash key was not cached after the first call")
+	}
+	if str.HashKey() != first {
+		t.Errorf("cached hash key differs from the computed one")
+	}
+}
+
+// collidingKey hashes every instance to the same digest, standing in for two strings with the same FNV-64 hash
+type collidingKey struct{ name string }
+
+func (c *collidingKey) Type() ObjectType { return "COLLIDING" }
+func (c *collidingKey) Inspect() string  { return c.name }
+func (c *collidingKey) HashKey() HashKey { return HashKey{Type: "COLLIDING", Value: 42} }
+
+func TestHashKeyCollisions(t *testing.T) {
+	first := &collidingKey{name: "first"}
+	second := &collidingKey{name: "second"}
+
+	hash := NewHash()
+	hash.Set(first, &Integer{Value: 1})
+	hash.Set(second, &Integer{Value: 2})
+
+	if hash.Len() != 2 {
+		t.Fatalf("colliding keys overwrote each other. got %d pairs", hash.Len())
+	}
+
+	for key, expected := range map[*collidingKey]string{first: "1", second: "2"} {
+		value, ok := hash.Get(key)
+		if !ok || value.Inspect() != expected {
+			t.Errorf("wrong value for %s. got=%v, want=%s", key.name, value, expected)
+		}
+	}
+
+	if _, ok := hash.Get(&collidingKey{name: "third"}); ok {
+		t.Errorf("lookup matched a different key that only shares its digest")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	array := func(values ...int64) *Array {
+		elements := []Object{}
+		for _, v := range values {
+			elements = append(elements, &Integer{Value: v})
+		}
+		return &Array{Elements: elements}
+	}
+
+	tests := []struct {
+		left, right Object
+		expected    int
+		ok          bool
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 2}, -1, true},
+		{&String{Value: "b"}, &String{Value: "a"}, 1, true},
+		{array(1, 2), array(1, 2), 0, true},
+		{array(1, 2), array(1, 2, 3), -1, true},
+		{array(3), array(1, 2, 3), 1, true},
+		{&Integer{Value: 1}, &String{Value: "1"}, 0, false},
+		{&Boolean{Value: true}, &Boolean{Value: false}, 0, false},
+	}
+
+	for _, tt := range tests {
+		result, ok := Compare(tt.left, tt.right)
+		if ok != tt.ok {
+			t.Errorf("Compare(%s, %s) ok=%t, want %t", tt.left.Inspect(), tt.right.Inspect(), ok, tt.ok)
+			continue
+		}
+		if sign(result) != tt.expected {
+			t.Errorf("Compare(%s, %s)=%d, want sign %d", tt.left.Inspect(), tt.right.Inspect(), result, tt.expected)
+		}
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func TestScopedEnvironment(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("x", &Integer{Value: 1})
+	env := NewScopedEnvironment(global, []string{"x", "y"})
+
+	if obj, ok := env.GetSlot(0, 0, "x"); !ok || obj.Inspect() != "1" {
+		t.Errorf("unbound slot should fall back to outer x. got=%v, %t", obj, ok)
+	}
+
+	env.SetSlot(0, "x", &Integer{Value: 2})
+	env.Set("y", &Integer{Value: 3})  // Names with slots are stored in them
+	env.Set("z", &Integer{Value: 4})  // Names without one still work
+	inner := NewScopedEnvironment(env, []string{"w"})
+
+	expected := map[string]string{"x": "2", "y": "3", "z": "4"}
+	for name, value := range expected {
+		if obj, ok := inner.Get(name); !ok || obj.Inspect() != value {
+			t.Errorf("wrong value for %s. got=%v, want=%s", name, obj, value)
+		}
+	}
+	if obj, ok := inner.GetSlot(1, 1, "y"); !ok || obj.Inspect() != "3" {
+		t.Errorf("wrong value for slot of y. got=%v", obj)
+	}
+	if _, ok := inner.Get("w"); ok {
+		t.Errorf("unbound slot w should not be found")
+	}
+}
+
+func TestChannels(t *testing.T) {
+	ch := NewChannel(1)
+	if !ch.Send(&Integer{Value: 1}) { t.Fatalf("send with room left failed") }
+	if index, _, _ := Select([]SelectCase{{Channel: ch, Send: &Integer{Value: 2}}}, false); index != -1 {
+		t.Errorf("select should not send on a full channel. got=%d", index)
+	}
+
+	if !ch.Close() { t.Errorf("first close should succeed") }
+	if ch.Close() { t.Errorf("second close should fail") }
+	if ch.Send(&Integer{Value: 3}) { t.Errorf("send on a closed channel should fail") }
+
+	if value, ok := ch.Recv(); !ok || value.Inspect() != "1" { t.Errorf("values sent before close should be kept. got=%v, %t", value, ok) }
+	if index, value, ok := Select([]SelectCase{{Channel: ch}}, true); index != 0 || value != nil || ok {
+		t.Errorf("receive from a drained closed channel should report it. got=%d, %v, %t", index, value, ok)
+	}
+}
+
+/*
+ Readers and writers of one environment from many goroutines, the way spawned tasks share the environments they close
+ over. Run with go test -race
+ */
+func TestEnvironmentConcurrentAccess(t *testing.T) {
+	global := NewEnvironment()
+	env := NewScopedEnvironment(global, []string{"x"})
+	global.Set("shared", &Integer{Value: 1})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				env.SetSlot(0, "x", &Integer{Value: int64(j)})
+				global.Set(fmt.Sprintf("name%d", i), &Integer{Value: int64(j)})
+				if _, ok := env.GetSlot(1, 0, "shared"); !ok { t.Errorf("shared name went missing") }
+				if _, ok := env.Get("x"); !ok { t.Errorf("slot x went missing") }
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		if obj, ok := env.Get(fmt.Sprintf("name%d", i)); !ok || obj.Inspect() != "99" { t.Errorf("wrong value for name%d. got=%v", i, obj) }
+	}
+}
@@ -0,0 +1,131 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"mockc/ast"
+	"os"
+	"sync"
+)
+
+/*
+ Runtime holds the host-facing state of one interpreter: where input comes from, where output goes and what the
+ program is allowed to touch. Every environment enclosed by the same global environment shares its Runtime, so
+ builtins can reach it through whichever environment they're called from
+ */
+type Runtime struct {
+	Stdin  LineReader    // Read by read_line, nil means the program has no input
+	Stdout io.Writer     // Written by print and printf
+	Stderr io.Writer     // Written by eprint
+	Policy Policy
+
+	// Called by exit() with the requested status code. nil means programs aren't allowed to exit. Hosts that don't
+	// want exit() to stop the whole process can record the code instead, evaluation stops either way
+	Exit func(code int)
+
+	Tracer Tracer // Watches the program run, ex. the profiler. nil when nothing is watching
+}
+
+/*
+ LineReader is where programs read their input from, usually a *bufio.Reader
+ */
+type LineReader interface {
+	ReadString(delim byte) (string, error)
+}
+
+/*
+ Tracer is told what a program is doing as the evaluator does it. Calls and returns always come in pairs, a tail call
+ returns from the current call before the next one starts
+ */
+type Tracer interface {
+	Call(fn *Function)              // A Moxie function started running. Builtins aren't traced
+	Return()                        // The innermost call finished
+	Statement(stmt ast.Statement)   // A statement is about to run in the innermost call
+	Block(block *ast.BlockStatement) // A block is about to run its statements, ex. a function body or a branch of an if
+	Branch(node *ast.IfExpression, taken bool) // An if ran its consequence (true) or its alternative, which may be missing
+}
+
+/*
+ Tracers that can follow several call stacks at once implement ForkingTracer. Each spawned task is traced by a fork of
+ its spawner's tracer, tasks spawned under any other tracer aren't traced at all
+ */
+type ForkingTracer interface {
+	Tracer
+	Fork() Tracer // A tracer for a new task. It may be called from, and its methods run on, any goroutine
+}
+
+/*
+ Constructor for a runtime with no input and a policy that denies every capability, the safe default for hosts
+ embedding the interpreter. Output goes to the process's stdout and stderr until the host redirects it
+ */
+func NewRuntime() *Runtime {
+	return &Runtime{Stdout: os.Stdout, Stderr: os.Stderr}
+}
+
+/*
+ Set the reader read_line consumes
+ */
+func (r *Runtime) SetStdin(in io.Reader) {
+	r.Stdin = bufio.NewReader(in)
+}
+
+/*
+ The runtime a spawned task runs under: the same input, output and policy as r, with a tracer of its own
+ It's called on the goroutine running under r. Once r has a task its streams are locked, since the task uses them at
+ the same time as r and the host's writers and readers don't have to be safe for that
+ */
+func (r *Runtime) Fork() *Runtime {
+	r.lockStreams()
+	task := *r
+	task.Tracer = nil
+	if tracer, ok := r.Tracer.(ForkingTracer); ok { task.Tracer = tracer.Fork() }
+
+	return &task
+}
+
+/*
+ Wrap r's streams so only one task uses each at a time. Output shares a lock so a line printed to stdout can't
+ interleave with one printed to stderr when both go to the same place. Streams that are already locked are kept
+ */
+func (r *Runtime) lockStreams() {
+	output := &sync.Mutex{}
+	if locked, ok := r.Stdout.(*lockedWriter); ok { output = locked.mu }
+
+	for _, stream := range []*io.Writer{&r.Stdout, &r.Stderr} {
+		if _, ok := (*stream).(*lockedWriter); !ok && *stream != nil { *stream = &lockedWriter{mu: output, w: *stream} }
+	}
+	if _, ok := r.Stdin.(*lockedReader); !ok && r.Stdin != nil { r.Stdin = &lockedReader{r: r.Stdin} }
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.w.Write(p)
+}
+
+type lockedReader struct {
+	mu sync.Mutex
+	r  LineReader
+}
+
+func (l *lockedReader) ReadString(delim byte) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.r.ReadString(delim)
+}
+
+/*
+ Policy lists the capabilities a host grants to the programs it runs. The zero value grants nothing
+ */
+type Policy struct {
+	AllowedDirs []string // Files can only be read or written inside these directories and their subdirectories
+	ReadOnly    bool     // Forbid write_file even inside AllowedDirs
+	AllowEnv    bool     // Allow getenv
+}
@@ -0,0 +1,155 @@
+package optimizer
+
+import "mockc/ast"
+
+/*
+ Remember a top level let of a function that's safe to substitute into its calls:
+ - the name is declared once in the whole program, so every call to it after this means this function, and it can't
+   call itself
+ - it takes plain parameters, each used at least once, and its body is a single small expression that doesn't bind
+   anything
+ - every other name it uses is declared nowhere in the program, ex. builtins, so nothing at a call site can shadow
+   them
+ */
+func (o *optimizer) register(stmt ast.Statement) {
+	if o.options.InlineLimit <= 0 { return }
+
+	let, ok := stmt.(*ast.LetStatement)
+	if !ok || let.Name == nil || o.declared[let.Name.Value] != 1 { return }
+	fn, ok := let.Value.(*ast.FunctionLiteral)
+	if !ok || fn.Patterns != nil || len(fn.Body.Statements) != 1 { return }
+	body, ok := fn.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok { return }
+
+	uses := map[string]int{}
+	for _, param := range fn.Parameters {
+		if _, duplicate := uses[param.Value]; duplicate { return }
+		uses[param.Value] = 0
+	}
+
+	size, inlinable := 0, true
+	ast.Inspect(body.Expression, func(node ast.Node) bool {
+		size++
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if _, ok := uses[node.Value]; ok {
+				uses[node.Value]++
+			} else if o.declared[node.Value] > 0 {
+				inlinable = false
+			}
+		case *ast.IfExpression, *ast.FunctionLiteral, *ast.MatchExpression, *ast.ForExpression: // These can bind names
+			inlinable = false
+		case *ast.YieldExpression: // Calling a generator doesn't run its body
+			inlinable = false
+		}
+		return inlinable
+	})
+	if !inlinable || size > o.options.InlineLimit { return }
+	for _, count := range uses {
+		if count == 0 { return } // Dropping the argument would hide an error evaluating it
+	}
+
+	o.inlinable[let.Name.Value] = fn
+}
+
+/*
+ Replace a call to an inlinable function with its body. Arguments are substituted for the parameters, so they have to
+ be literals or names, which are safe to evaluate any number of times in any order
+ */
+func (o *optimizer) inline(call *ast.CallExpression) ast.Expression {
+	name, ok := call.Function.(*ast.Identifier)
+	if !ok { return call }
+	fn, ok := o.inlinable[name.Value]
+	if !ok || len(call.Arguments) != len(fn.Parameters) { return call }
+
+	args := map[string]ast.Expression{}
+	for i, arg := range call.Arguments {
+		if _, ok := arg.(*ast.Identifier); !ok && !isLiteral(arg) { return call }
+		args[fn.Parameters[i].Value] = arg
+	}
+
+	body := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression
+	return o.expression(substitute(body, args)) // The arguments may make the body foldable
+}
+
+/*
+ Copy expr with the parameters replaced by their arguments. Names get copied too, since the resolver gives each copy
+ the address it has at its call site
+ */
+func substitute(expr ast.Expression, args map[string]ast.Expression) ast.Expression {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		if arg, ok := args[expr.Value]; ok {
+			name, ok := arg.(*ast.Identifier)
+			if !ok { return arg }
+			expr = name
+		}
+		copy := *expr
+		return &copy
+
+	case *ast.PrefixExpression:
+		return &ast.PrefixExpression{Token: expr.Token, Operator: expr.Operator, Right: substitute(expr.Right, args)}
+
+	case *ast.InfixExpression:
+		return &ast.InfixExpression{Token: expr.Token, Left: substitute(expr.Left, args), Operator: expr.Operator,
+			Right: substitute(expr.Right, args)}
+
+	case *ast.CallExpression:
+		arguments := []ast.Expression{}
+		for _, arg := range expr.Arguments { arguments = append(arguments, substitute(arg, args)) }
+		return &ast.CallExpression{Token: expr.Token, Function: substitute(expr.Function, args), Arguments: arguments}
+
+	case *ast.Array:
+		elements := []ast.Expression{}
+		for _, element := range expr.Elements { elements = append(elements, substitute(element, args)) }
+		return &ast.Array{Token: expr.Token, Elements: elements}
+
+	case *ast.IndexExpression:
+		return &ast.IndexExpression{Token: expr.Token, Left: substitute(expr.Left, args), Index: substitute(expr.Index, args)}
+
+	case *ast.SliceExpression:
+		slice := &ast.SliceExpression{Token: expr.Token, Left: substitute(expr.Left, args)}
+		if expr.Start != nil { slice.Start = substitute(expr.Start, args) }
+		if expr.End != nil { slice.End = substitute(expr.End, args) }
+		return slice
+
+	case *ast.MemberExpression:
+		return &ast.MemberExpression{Token: expr.Token, Object: substitute(expr.Object, args), Property: expr.Property}
+
+	case *ast.HashLiteral:
+		hash := &ast.HashLiteral{Token: expr.Token, Pairs: map[ast.Expression]ast.Expression{}}
+		for _, key := range expr.Keys {
+			copy := substitute(key, args)
+			hash.Keys = append(hash.Keys, copy)
+			hash.Pairs[copy] = substitute(expr.Pairs[key], args)
+		}
+		return hash
+	}
+
+	return expr // Literals are never changed in place, so they can be shared
+}
+
+/*
+ Count the declarations of every name in the program: lets, parameters, struct types and pattern bindings
+ */
+func declarations(program *ast.Program) map[string]int {
+	declared := map[string]int{}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Name != nil { declared[node.Name.Value]++ }
+		case *ast.StructStatement:
+			declared[node.Name.Value]++
+		case *ast.FunctionLiteral:
+			for i, param := range node.Parameters {
+				if node.Patterns == nil || node.Patterns[i] == nil { declared[param.Value]++ }
+			}
+		case *ast.BindingPattern:
+			declared[node.Name.Value]++
+		}
+		return true
+	})
+
+	return declared
+}
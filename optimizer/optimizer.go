@@ -0,0 +1,273 @@
+package optimizer
+
+import (
+	"mockc/ast"
+	"mockc/evaluator"
+	"mockc/object"
+	"mockc/resolver"
+	"mockc/token"
+	"strconv"
+)
+
+// The optimizer rewrites a parsed program into one that does the same thing with less work at run time
+
+const INLINE_LIMIT = 16 // Default for Options.InlineLimit
+
+/*
+ Which passes to run. Every pass is safe to run on its own, but folding is what makes the other two pay off, ex.
+ if (DEBUG_LEVEL > 2) only becomes dead once the condition has been folded
+ Inlining assumes the program is all the code that will ever run in its environment, so turn it off when later
+ programs share the environment and could declare a function again, like REPL lines or layered environments
+ */
+type Options struct {
+	FoldConstants         bool // Replace operators on integer, boolean and string literals with their result
+	EliminateDeadBranches bool // Replace if (true) and if (false) with the branch that runs
+	InlineLimit           int  // Largest function body, in AST nodes, substituted into its calls. 0 turns inlining off
+}
+
+func DefaultOptions() Options {
+	return Options{FoldConstants: true, EliminateDeadBranches: true, InlineLimit: INLINE_LIMIT}
+}
+
+type optimizer struct {
+	options   Options
+	env       *object.Environment               // Constants are folded by evaluating them, so they mean what they would at run time
+	declared  map[string]int                    // How many times each name is declared anywhere in the program
+	inlinable map[string]*ast.FunctionLiteral   // Top level functions seen so far that can be inlined
+}
+
+/*
+ Run the passes in options over program, changing it in place. The result is resolved again since inlining moves
+ names between scopes
+ */
+func Optimize(program *ast.Program, options Options) *ast.Program {
+	o := &optimizer{
+		options:   options,
+		env:       object.NewEnvironment(),
+		declared:  declarations(program),
+		inlinable: map[string]*ast.FunctionLiteral{},
+	}
+
+	program.Statements = o.statements(program.Statements, true)
+	resolver.Resolve(program)
+	return program
+}
+
+/*
+ Optimize a list of statements, splicing in the branch of any if statement whose condition is known. Blocks don't have
+ scopes of their own so this doesn't change what the branch's lets bind. Functions defined at the top level become
+ candidates for inlining in the statements after them
+ */
+func (o *optimizer) statements(stmts []ast.Statement, topLevel bool) []ast.Statement {
+	out := []ast.Statement{}
+
+	for i, stmt := range stmts {
+		stmt = o.statement(stmt)
+		if branch, ok := o.deadBranch(stmt, i == len(stmts)-1); ok {
+			out = append(out, branch...)
+			continue
+		}
+
+		out = append(out, stmt)
+		if topLevel { o.register(stmt) }
+	}
+
+	return out
+}
+
+func (o *optimizer) statement(stmt ast.Statement) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt.Pattern != nil { o.pattern(stmt.Pattern) }
+		stmt.Value = o.expression(stmt.Value)
+
+	case *ast.ImplStatement:
+		for _, method := range stmt.Methods { method.Value = o.expression(method.Value) }
+
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = o.expression(stmt.ReturnValue)
+
+	case *ast.ExpressionStatement:
+		stmt.Expression = o.expression(stmt.Expression)
+	}
+
+	return stmt
+}
+
+func (o *optimizer) block(block *ast.BlockStatement) {
+	if block == nil { return }
+	block.Statements = o.statements(block.Statements, false)
+}
+
+func (o *optimizer) expression(expr ast.Expression) ast.Expression {
+	switch expr := expr.(type) {
+	case *ast.PrefixExpression:
+		expr.Right = o.expression(expr.Right)
+		return o.fold(expr, expr.Right)
+
+	case *ast.InfixExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Right = o.expression(expr.Right)
+		return o.fold(expr, expr.Left, expr.Right)
+
+	case *ast.IfExpression:
+		expr.Condition = o.expression(expr.Condition)
+		o.block(expr.Consequence)
+		o.block(expr.Alternative)
+		if branch, ok := o.liveBranch(expr); ok && branch != nil && len(branch.Statements) == 1 {
+			if value, ok := branch.Statements[0].(*ast.ExpressionStatement); ok { return value.Expression }
+		}
+
+	case *ast.FunctionLiteral:
+		for _, pattern := range expr.Patterns { o.pattern(pattern) }
+		o.block(expr.Body)
+
+	case *ast.CallExpression:
+		expr.Function = o.expression(expr.Function)
+		for i, arg := range expr.Arguments { expr.Arguments[i] = o.expression(arg) }
+		return o.inline(expr)
+
+	case *ast.Array:
+		for i, element := range expr.Elements { expr.Elements[i] = o.expression(element) }
+
+	case *ast.IndexExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Index = o.expression(expr.Index)
+
+	case *ast.SliceExpression:
+		expr.Left = o.expression(expr.Left)
+		if expr.Start != nil { expr.Start = o.expression(expr.Start) }
+		if expr.End != nil { expr.End = o.expression(expr.End) }
+
+	case *ast.MemberExpression:
+		expr.Object = o.expression(expr.Object)
+
+	case *ast.HashLiteral:
+		pairs := map[ast.Expression]ast.Expression{}
+		for i, key := range expr.Keys {
+			value := o.expression(expr.Pairs[key])
+			key = o.expression(key)
+			expr.Keys[i] = key
+			pairs[key] = value
+		}
+		expr.Pairs = pairs
+
+	case *ast.MatchExpression:
+		expr.Subject = o.expression(expr.Subject)
+		for _, arm := range expr.Arms {
+			o.pattern(arm.Pattern)
+			if arm.Guard != nil { arm.Guard = o.expression(arm.Guard) }
+			switch body := arm.Body.(type) {
+			case *ast.BlockStatement:
+				o.block(body)
+			case ast.Expression:
+				arm.Body = o.expression(body)
+			}
+		}
+
+	case *ast.ForExpression:
+		o.pattern(expr.Pattern)
+		expr.Iterable = o.expression(expr.Iterable)
+		o.block(expr.Body)
+
+	case *ast.YieldExpression:
+		expr.Value = o.expression(expr.Value)
+
+	case *ast.SpawnExpression:
+		call, ok := expr.Task.(*ast.CallExpression)
+		if !ok {
+			expr.Task = o.expression(expr.Task)
+			break
+		}
+		call.Function = o.expression(call.Function) // Never inlined, the call has to run on the task rather than before it
+		for i, arg := range call.Arguments { call.Arguments[i] = o.expression(arg) }
+
+	case *ast.AwaitExpression:
+		expr.Future = o.expression(expr.Future)
+	}
+
+	return expr
+}
+
+/*
+ Only defaults inside patterns are expressions worth optimizing, literal patterns already are literals
+ */
+func (o *optimizer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.DefaultPattern:
+		o.pattern(pattern.Pattern)
+		pattern.Default = o.expression(pattern.Default)
+
+	case *ast.ArrayPattern:
+		for _, element := range pattern.Elements { o.pattern(element) }
+		if pattern.Rest != nil { o.pattern(pattern.Rest) }
+
+	case *ast.HashPattern:
+		for _, value := range pattern.Values { o.pattern(value) }
+	}
+}
+
+/*
+ Replace an operator whose operands are all literals with the literal it evaluates to. Anything that errors or
+ doesn't have a literal form, ex. 1 / 0 or a result too big for an int, is left for run time
+ */
+func (o *optimizer) fold(expr ast.Expression, operands ...ast.Expression) ast.Expression {
+	if !o.options.FoldConstants { return expr }
+	for _, operand := range operands {
+		if !isLiteral(operand) { return expr }
+	}
+
+	switch result := evaluator.Eval(expr, o.env).(type) {
+	case *object.Integer:
+		literal := strconv.FormatInt(result.Value, 10)
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INTEGER, Literal: literal}, Value: result.Value}
+
+	case *object.Boolean:
+		if result.Value { return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true} }
+		return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false}
+
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: result.Value}, Value: result.Value}
+	}
+
+	return expr
+}
+
+func isLiteral(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return expr.Big == nil
+	case *ast.Boolean, *ast.StringLiteral:
+		return true
+	}
+	return false
+}
+
+/*
+ The branch of an if that always runs, nil when that's a missing else. ok is false if the condition isn't known
+ */
+func (o *optimizer) liveBranch(expr *ast.IfExpression) (*ast.BlockStatement, bool) {
+	if !o.options.EliminateDeadBranches { return nil, false }
+
+	condition, ok := expr.Condition.(*ast.Boolean)
+	if !ok { return nil, false }
+	if condition.Value { return expr.Consequence, true }
+	return expr.Alternative, true
+}
+
+/*
+ The statements an if statement can be replaced with, if its condition is known. A branch that doesn't run at all can
+ only be dropped when something comes after it, since the last statement's value is the value of the whole block
+ */
+func (o *optimizer) deadBranch(stmt ast.Statement, last bool) ([]ast.Statement, bool) {
+	exprStmt, ok := stmt.(*ast.ExpressionStatement)
+	if !ok { return nil, false }
+	ifExpr, ok := exprStmt.Expression.(*ast.IfExpression)
+	if !ok { return nil, false }
+
+	branch, ok := o.liveBranch(ifExpr)
+	if !ok { return nil, false }
+	if branch != nil && len(branch.Statements) > 0 { return branch.Statements, true }
+	if !last { return nil, true }
+	return nil, false
+}
@@ -0,0 +1,115 @@
+package optimizer
+
+import (
+	"mockc/ast"
+	"mockc/evaluator"
+	"mockc/lexer"
+	"mockc/object"
+	"mockc/parser"
+	"testing"
+)
+
+func TestConstantFolding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"60 * 60 * 24", "86400"},
+		{"-(2 * 3) + 1", "-5"},
+		{`"a" + "b" + "c"`, "abc"},
+		{"!(1 < 2) == false", "true"},
+		{`"a" == "a"`, "true"},
+		{"x * (2 + 3)", "(x * 5)"},
+		{"1 / 0", "(1 / 0)"},                                        // Errors are left for run time
+		{"9223372036854775807 + 1", "(9223372036854775807 + 1)"},    // So are results without a literal form
+		{"let f = fn(a, b = 2 * 2) { [a + 1 * 2] };", "let f = fn(a, b = 4) [(a + 2)];"},
+	}
+
+	for _, tt := range tests {
+		program := optimize(t, tt.input, Options{FoldConstants: true})
+		if program.String() != tt.expected { t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, program.String(), tt.expected) }
+	}
+}
+
+func TestDeadBranchElimination(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (true) { 1 } else { 2 }", "1"},
+		{"if (false) { 1 } else { let a = 2; a }", "let a = 2;a"},
+		{"if (false) { 1 }; 2", "2"},
+		{"if (false) { 1 }", "iffalse 1"}, // The missing else is the program's value
+		{"let x = if (1 > 2) { 1 } else { 2 };", "let x = 2;"},
+		{"fn(n) { if (true) { return n; } n }", "fn(n) return n;n"},
+		{"if (x) { if (true) { 1 } }", "ifx 1"},
+	}
+
+	for _, tt := range tests {
+		program := optimize(t, tt.input, Options{FoldConstants: true, EliminateDeadBranches: true})
+		if program.String() != tt.expected { t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, program.String(), tt.expected) }
+	}
+}
+
+func TestInlining(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let sq = fn(n) { n * n }; sq(3) + sq(x)", "let sq = fn(n) (n * n);(9 + (x * x))"},
+		{"let first = fn(a) { a[0] + len(a) }; fn(b) { first(b) }", "let first = fn(a) ((a[0]) + len(a));fn(b) ((b[0]) + len(b))"},
+		{"sq(1); let sq = fn(n) { n * n };", "sq(1)let sq = fn(n) (n * n);"},                         // Not defined yet
+		{"let f = fn(n) { f(n) }; f(1)", "let f = fn(n) f(n);f(1)"},                                   // Recursive
+		{"let f = fn(n) { n }; let f = 1; f(1)", "let f = fn(n) n;let f = 1;f(1)"},                    // Rebound
+		{"let f = fn(n) { n + y }; fn(y) { f(1) }", "let f = fn(n) (n + y);fn(y) f(1)"},               // y is shadowed
+		{"let f = fn(n) { 1 }; f(x)", "let f = fn(n) 1;f(x)"},                                         // Unused parameter
+		{"let f = fn(n) { n * n }; f(g())", "let f = fn(n) (n * n);f(g())"},                           // Argument with effects
+		{"let f = fn(n) { let m = n; m }; f(1)", "let f = fn(n) let m = n;m;f(1)"},                    // Not an expression
+		{"let g = fn(n) { yield n }; g(1)", "let g = fn(n) yield n;g(1)"},                             // Generator
+		{"let sq = fn(n) { n * n }; spawn sq(2 + 1)", "let sq = fn(n) (n * n);spawn sq(3)"},            // Has to stay a call
+		{"let f = fn(xs) { for (x in xs) { x } }; f([1])", "let f = fn(xs) for (x in xs) x;f([1])"},   // Loop
+		{"let f = fn(n) { n + n + n + n + n + n + n + n + n }; f(1)", "let f = fn(n) ((((((((n + n) + n) + n) + n) + n) + n) + n) + n);f(1)"}, // Too big
+	}
+
+	for _, tt := range tests {
+		program := optimize(t, tt.input, DefaultOptions())
+		if program.String() != tt.expected { t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, program.String(), tt.expected) }
+	}
+}
+
+func TestOptionsDisablePasses(t *testing.T) {
+	input := "let f = fn(n) { n }; if (true) { f(1 + 2) }"
+	program := optimize(t, input, Options{})
+	if program.String() != "let f = fn(n) n;iftrue f((1 + 2))" { t.Errorf("passes should be off. got=%q", program.String()) }
+}
+
+/*
+ Whatever the optimizer does, programs must still evaluate to the same thing, and inlined names must still be resolved
+ */
+func TestOptimizedProgramsBehaveTheSame(t *testing.T) {
+	inputs := []string{
+		"let sq = fn(n) { n * n }; let f = fn(x) { let y = x + 1; sq(y) + sq(2) }; f(3)",
+		"let g = fn(a) { a + 1 }; let h = fn(a) { match (a) { [x, y] => g(x) + g(y), _ => g(a) } }; h([1, 2]) + h(5)",
+		"let f = fn(n) { if (2 > 1) { let m = n * 2; } m }; f(4)",
+		"let x = 10; let f = fn(n) { n + x }; let k = fn(x) { f(x) }; k(1)",
+		`let greet = fn(name) { "Hello, " + name }; greet("Moxie")`,
+		"let sq = fn(n) { n * n }; await spawn sq(4) + await spawn fn() { sq(5) }",
+	}
+
+	for _, input := range inputs {
+		expected := evaluator.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+		program := optimize(t, input, DefaultOptions())
+		got := evaluator.Eval(program, object.NewEnvironment())
+		if got.Inspect() != expected.Inspect() {
+			t.Errorf("%s: optimized program gave %s, want %s (optimized to %s)", input, got.Inspect(), expected.Inspect(), program.String())
+		}
+	}
+}
+
+func optimize(t *testing.T, input string, options Options) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 { t.Fatalf("%s: parser had errors: %v", input, p.Errors()) }
+	return Optimize(program, options)
+}
@@ -0,0 +1,29 @@
+package parser
+
+import "mockc/ast"
+
+/*
+ Parse spawn task. Binds like a prefix operator, so spawn f(x) + 1 adds 1 to the future rather than to f(x)
+ */
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	expression := &ast.SpawnExpression{Token: p.currToken}
+
+	p.nextToken()
+	expression.Task = p.parseExpression(PREFIX)
+	if expression.Task == nil { return nil }
+
+	return expression
+}
+
+/*
+ Parse await future, also a prefix operator so await a + await b waits for both
+ */
+func (p *Parser) parseAwaitExpression() ast.Expression {
+	expression := &ast.AwaitExpression{Token: p.currToken}
+
+	p.nextToken()
+	expression.Future = p.parseExpression(PREFIX)
+	if expression.Future == nil { return nil }
+
+	return expression
+}
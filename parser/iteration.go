@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"mockc/ast"
+	"mockc/token"
+)
+
+/*
+ Parse for (pattern in iterable) { body }
+ */
+func (p *Parser) parseForExpression() ast.Expression {
+	expression := &ast.ForExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) { return nil }
+	p.nextToken()
+	expression.Pattern = p.parsePattern()
+	if expression.Pattern == nil { return nil }
+
+	if !p.expectPeek(token.IN) { return nil }
+	p.nextToken()
+	expression.Iterable = p.parseExpression(LOWEST)
+	if expression.Iterable == nil { return nil }
+
+	if !p.expectPeek(token.RPAREN) { return nil }
+	if !p.expectPeek(token.LBRACE) { return nil }
+	expression.Body = p.parseBlockStatement()
+
+	return expression
+}
+
+/*
+ Parse yield value, which turns the function it's in into a generator
+ */
+func (p *Parser) parseYieldExpression() ast.Expression {
+	expression := &ast.YieldExpression{Token: p.currToken}
+
+	if len(p.functions) == 0 {
+		p.errors = append(p.errors, "yield outside of a function")
+		return nil
+	}
+	p.functions[len(p.functions)-1].Generator = true
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+	if expression.Value == nil { return nil }
+
+	return expression
+}
@@ -3,8 +3,10 @@ package parser
 import (
 	"mockc/ast"
 	"mockc/lexer"
+	"mockc/resolver"
 	"mockc/token"
 	"fmt"
+	"math/big"
 	"strconv"
 )
 
@@ -25,12 +27,16 @@ var precedences = map[token.TokenType]int{
 	token.NEQ:	    EQUALS,
 	token.LTHAN:    LESSGREATER,
 	token.GTHAN:    LESSGREATER,
+	token.LEQ:      LESSGREATER,
+	token.GEQ:      LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.DIVIDE:   PRODUCT,
 	token.TIMES:    PRODUCT,
+	token.MOD:      PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
 }
 
 type (
@@ -43,6 +49,8 @@ type Parser struct {
 	currToken token.Token
 	peekToken token.Token
 	errors []string // List of errors
+	functions []*ast.FunctionLiteral // Literals whose bodies are being parsed, innermost last, so yield can find its function
+	traceLevel int // How deep trace output is indented, see parser_tracing.go
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns map[token.TokenType]infixParseFn
@@ -93,6 +101,11 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArray)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.FOR, p.parseForExpression)
+	p.registerPrefix(token.YIELD, p.parseYieldExpression)
+	p.registerPrefix(token.SPAWN, p.parseSpawnExpression)
+	p.registerPrefix(token.AWAIT, p.parseAwaitExpression)
 
 	// Make map of infix token parse functions
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -100,11 +113,15 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.DIVIDE, p.parseInfixExpression)
 	p.registerInfix(token.TIMES, p.parseInfixExpression)
+	p.registerInfix(token.MOD, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NEQ, p.parseInfixExpression)
 	p.registerInfix(token.LTHAN, p.parseInfixExpression)
 	p.registerInfix(token.GTHAN, p.parseInfixExpression)
+	p.registerInfix(token.LEQ, p.parseInfixExpression)
+	p.registerInfix(token.GEQ, p.parseInfixExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
 
 	// This one's a little unique
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
@@ -159,6 +176,7 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	if len(p.errors) == 0 { resolver.Resolve(program) } // Programs with errors never run, and may have holes in them
 	return program
 }
 
@@ -172,6 +190,10 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
+	case token.IMPL:
+		return p.parseImplStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -183,11 +205,19 @@ func (p *Parser) parseStatement() ast.Statement {
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.currToken}
 
-	if !p.expectPeek(token.IDENTIFIER) { // If let is not followed up by an identifier, return nil
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) { // Destructuring, ex. let [a, b] = arr;
+		p.nextToken()
+		stmt.Pattern = p.parsePattern()
+		if stmt.Pattern == nil { return nil }
+	} else if !p.expectPeek(token.IDENTIFIER) { // If let is not followed up by an identifier, return nil
 		return nil
+	} else {
+		stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	annotation, ok := p.parseAnnotation() // ex. let x: int = 5;
+	if !ok { return nil }
+	stmt.Type = annotation
 
 	if !p.expectPeek (token.ASSIGN){ // If the next token after identifier is not an assign operator, return nil
 		return nil
@@ -195,6 +225,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Name != nil { fn.Name = stmt.Name.Value } // For tools, ex. the profiler
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -202,6 +233,67 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+/*
+ Parse struct declarations, ex. struct Point { x, y }
+ */
+func (p *Parser) parseStructStatement() ast.Statement {
+	stmt := &ast.StructStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.IDENTIFIER) { return nil }
+	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) { return nil }
+
+	seen := map[string]bool{}
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENTIFIER) { return nil }
+		field := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		if seen[field.Value] {
+			p.errors = append(p.errors, fmt.Sprintf("Duplicate field %s in struct %s", field.Value, stmt.Name.Value))
+		}
+		seen[field.Value] = true
+		stmt.Fields = append(stmt.Fields, field)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) { return nil } // A trailing comma is fine
+	}
+	p.nextToken()
+
+	if p.peekTokenIs(token.SEMICOLON) { p.nextToken() }
+
+	return stmt
+}
+
+/*
+ Parse method definitions for a struct type, ex. impl Point { let norm = fn(self) { self.x + self.y }; }
+ Only let statements are allowed inside, each binds one method
+ */
+func (p *Parser) parseImplStatement() ast.Statement {
+	stmt := &ast.ImplStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.IDENTIFIER) { return nil }
+	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) { return nil }
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.LET) { return nil }
+
+		method := p.parseLetStatement()
+		if method == nil { return nil }
+		if method.Name == nil {
+			p.errors = append(p.errors, fmt.Sprintf("Methods of %s must be bound to a name, got %s", stmt.Name.Value, method.Pattern.String()))
+			return nil
+		}
+		if fn, ok := method.Value.(*ast.FunctionLiteral); ok { fn.Name = stmt.Name.Value + "." + method.Name.Value }
+		stmt.Methods = append(stmt.Methods, method)
+	}
+	p.nextToken()
+
+	if p.peekTokenIs(token.SEMICOLON) { p.nextToken() }
+
+	return stmt
+}
+
 /*
 
  */
@@ -220,7 +312,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 }
 
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	//defer untrace(trace("parseExpressionStatement"))
+	//defer p.untrace(p.trace("parseExpressionStatement"))
 
 	stmt := &ast.ExpressionStatement{Token: p.currToken}
 	stmt.Expression = p.parseExpression(LOWEST) // Lowest refers to operator precedence for PEMDAS
@@ -238,7 +330,7 @@ func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
-	//defer untrace(trace("parseExpression"))
+	//defer p.untrace(p.trace("parseExpression"))
 
 	prefix := p.prefixParseFns[p.currToken.Type] // If the current token has a parsing function use that
 	if prefix == nil { // If the token doesn't have a type, parse function, or just doesn't exist return null
@@ -285,23 +377,28 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	//defer untrace(trace("parseIntegerLiteral"))
+	//defer p.untrace(p.trace("parseIntegerLiteral"))
 
 	literal := &ast.IntegerLiteral{Token: p.currToken}
 
 	value, err := strconv.ParseInt(p.currToken.Literal, 0, 64) // Convert it to a 64 bit integer
-	if err != nil {
-		msg := fmt.Sprintf("Could not parse %q as int", p.currToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+	if err == nil {
+		literal.Value = value
+		return literal
 	}
 
-	literal.Value = value
-	return literal
+	if bigValue, ok := new(big.Int).SetString(p.currToken.Literal, 0); ok { // Too large for 64 bits but still valid
+		literal.Big = bigValue
+		return literal
+	}
+
+	msg := fmt.Sprintf("Could not parse %q as int", p.currToken.Literal)
+	p.errors = append(p.errors, msg)
+	return nil
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
-	//defer untrace(trace("parsePrefixExpression"))
+	//defer p.untrace(p.trace("parsePrefixExpression"))
 
 	expression := &ast.PrefixExpression{ // Create an expression for the prefix token
 		Token:	  p.currToken,
@@ -314,7 +411,7 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-	//defer untrace(trace("parseInfixExpression"))
+	//defer p.untrace(p.trace("parseInfixExpression"))
 
 	expression := &ast.InfixExpression{
 		Token:		p.currToken, // Set token to the operator currently being looked at
@@ -399,41 +496,82 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters, lit.Patterns, lit.Types = p.parseFunctionParameters()
+	if lit.Parameters == nil { return nil }
+
+	if p.peekTokenIs(token.RETURNS) {
+		p.nextToken()
+		p.nextToken()
+		if lit.ReturnType = p.parseType(); lit.ReturnType == nil { return nil }
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
+	p.functions = append(p.functions, lit)
 	lit.Body = p.parseBlockStatement()
+	p.functions = p.functions[:len(p.functions)-1]
+	lit.Source = p.l.Text(lit.Token.Offset, p.currToken.Offset+1) // Up to and including the closing brace
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+/*
+ Parameters are plain names or patterns, either of which can have an annotation and then a default, ex. b: int = 5.
+ Each parameter gets an identifier, named after the pattern's source for patterns. Patterns are only returned if
+ there's at least one and annotations if at least one parameter has one
+ */
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, []ast.Pattern, []ast.TypeExpression) {
 	identifiers := []*ast.Identifier{}
+	patterns := []ast.Pattern{}
+	annotations := []ast.TypeExpression{}
+	destructures, annotated := false, false
 
-	if p.peekTokenIs(token.RPAREN) { // If the parameters are empty, return the empty array
+	for !p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
-	}
 
-	p.nextToken()
+		var pattern ast.Pattern
+		var param *ast.Identifier
+		if p.currTokenIs(token.IDENTIFIER) { // Plain parameter, unless it turns out to have a default
+			param = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		} else if pattern = p.parsePattern(); pattern == nil {
+			return nil, nil, nil
+		}
 
-	ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
-	identifiers = append(identifiers, ident)
+		annotation, ok := p.parseAnnotation()
+		if !ok { return nil, nil, nil }
+		annotations = append(annotations, annotation)
+		annotated = annotated || annotation != nil
 
-	for p.peekTokenIs(token.COMMA) { // Iterate through all param identifiers
-		p.nextToken() // Param Identifier
-		p.nextToken() // Next comma
-		ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal} // Add this new param identifier to the array
-		identifiers = append(identifiers, ident)
-	}
+		if p.peekTokenIs(token.ASSIGN) {
+			if pattern == nil { pattern = parameterPattern(param) }
+			if pattern = p.parseDefault(pattern); pattern == nil { return nil, nil, nil }
+		}
 
-	if !p.expectPeek(token.RPAREN) { // If not properly closed, return null
-		return nil
+		if pattern == nil {
+			identifiers = append(identifiers, param)
+		} else {
+			name := defaultTarget(pattern).String() // A binding's String is its name
+			identifiers = append(identifiers, &ast.Identifier{Token: p.currToken, Value: name})
+			destructures = true
+		}
+		patterns = append(patterns, pattern)
+
+		if !p.peekTokenIs(token.RPAREN) && !p.expectPeek(token.COMMA) { return nil, nil, nil }
 	}
+	p.nextToken()
+
+	if !destructures { patterns = nil }
+	if !annotated { annotations = nil }
+	return identifiers, patterns, annotations
+}
 
-	return identifiers
+/*
+ The pattern a plain parameter stands for once it turns out to have a default
+ */
+func parameterPattern(param *ast.Identifier) ast.Pattern {
+	if param.Value == "_" { return &ast.WildcardPattern{Token: param.Token} }
+	return &ast.BindingPattern{Name: param}
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
@@ -501,15 +639,50 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.currToken, Left: left}
+	bracket := p.currToken
+	var index ast.Expression
 
-	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	if !p.peekTokenIs(token.COLON) { // x[:end] has no index before the colon
+		p.nextToken()
+		index = p.parseExpression(LOWEST)
+	}
+
+	if p.peekTokenIs(token.COLON) { return p.parseSliceExpression(bracket, left, index) }
+
+	exp := &ast.IndexExpression{Token: bracket, Left: left, Index: index}
 	if !p.expectPeek(token.RBRACKET) { return nil }
 
 	return exp
 }
 
+/*
+ Parse the rest of x[start:end] once the colon has been found, either bound can be left out
+ */
+func (p *Parser) parseSliceExpression(bracket token.Token, left ast.Expression, start ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: bracket, Left: left, Start: start}
+	p.nextToken() // Colon
+
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.End = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.RBRACKET) { return nil }
+	return exp
+}
+
+/*
+ Parse field access, ex. p.x
+ */
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.currToken, Object: object}
+
+	if !p.expectPeek(token.IDENTIFIER) { return nil }
+	exp.Property = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	return exp
+}
+
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.currToken}
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
@@ -522,6 +695,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST) // Value comes after colon
 		hash.Pairs[key] = value // Create pair using key and value
+		hash.Keys = append(hash.Keys, key) // Remember source order so the evaluated hash keeps it too
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) { return nil } // If the map does not continue and is not properly closed, return nil
 
 	}
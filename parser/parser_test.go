@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"mockc/ast"
 	"mockc/lexer"
+	"sync"
 	"testing"
 )
 
@@ -139,6 +140,24 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	input := "123456789012345678901234567890;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Big == nil || literal.Big.String() != "123456789012345678901234567890" {
+		t.Errorf("literal.Big not 123456789012345678901234567890. got=%v", literal.Big)
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -195,10 +214,13 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 - 5;", 5, "-", 5},
 		{"5 * 5;", 5, "*", 5},
 		{"5 / 5;", 5, "/", 5},
+		{"5 % 5;", 5, "%", 5},
 		{"5 > 5;", 5, ">", 5},
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
 		{"foobar + barfoo;", "foobar", "+", "barfoo"},
 		{"foobar - barfoo;", "foobar", "-", "barfoo"},
 		{"foobar * barfoo;", "foobar", "*", "barfoo"},
@@ -586,6 +608,36 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestFunctionLiteralSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(x, y) { x + y; };", "fn(x, y) { x + y; }"},
+		{"fn() {\n  fn(a) { a }\n}()", "fn() {\n  fn(a) { a }\n}"},
+		{`fn(s: string = "{") -> string { s + "}" }`, `fn(s: string = "{") -> string { s + "}" }`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var function *ast.FunctionLiteral
+		switch stmt := program.Statements[0].(type) {
+		case *ast.LetStatement:
+			function = stmt.Value.(*ast.FunctionLiteral)
+		case *ast.ExpressionStatement:
+			if call, ok := stmt.Expression.(*ast.CallExpression); ok { function = call.Function.(*ast.FunctionLiteral) } else { function = stmt.Expression.(*ast.FunctionLiteral) }
+		}
+
+		if function.Source != tt.expected {
+			t.Errorf("function.Source wrong. want=%q, got=%q", tt.expected, function.Source)
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -877,6 +929,363 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"s[1:3]", "(s[1:3])"},
+		{"s[:3]", "(s[:3])"},
+		{"s[1:]", "(s[1:])"},
+		{"s[:]", "(s[:])"},
+		{"s[a + 1:len(s) - 1]", "(s[(a + 1):(len(s) - 1)])"},
+		{"s[1:2][0]", "((s[1:2])[0])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("wrong slice expression. expected=%q, got=%q", tt.expected, stmt.Expression.String())
+		}
+	}
+}
+
+func TestStructStatements(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedName   string
+		expectedFields []string
+	}{
+		{"struct Point { x, y }", "Point", []string{"x", "y"}},
+		{"struct Empty {}", "Empty", []string{}},
+		{"struct User { name, age, };", "User", []string{"name", "age"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.StructStatement)
+		if !ok { t.Fatalf("statement is not *ast.StructStatement. got=%T", program.Statements[0]) }
+		if stmt.Name.Value != tt.expectedName { t.Errorf("wrong name. expected=%q, got=%q", tt.expectedName, stmt.Name.Value) }
+		if len(stmt.Fields) != len(tt.expectedFields) {
+			t.Fatalf("wrong number of fields. expected=%d, got=%d", len(tt.expectedFields), len(stmt.Fields))
+		}
+		for i, field := range tt.expectedFields {
+			if stmt.Fields[i].Value != field { t.Errorf("wrong field %d. expected=%q, got=%q", i, field, stmt.Fields[i].Value) }
+		}
+	}
+}
+
+func TestStructStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, x }", "Duplicate field x in struct Point"},
+		{"struct Point { x y }", "Expected next token to be ,, got IDENTIFIER instead"},
+		{"struct { x }", "Expected next token to be IDENTIFIER, got { instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("%s: expected error %q. got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestParsingMemberExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"p.x", "(p.x)"},
+		{"a.b.c", "((a.b).c)"},
+		{"p.x + p.y * 2", "((p.x) + ((p.y) * 2))"},
+		{"-p.x", "(-(p.x))"},
+		{"line.points[0].x", "(((line.points)[0]).x)"},
+		{"make().x", "(make().x)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("wrong member expression. expected=%q, got=%q", tt.expected, stmt.Expression.String())
+		}
+	}
+}
+
+func TestImplStatements(t *testing.T) {
+	input := `impl Point { let norm = fn(self) { self.x + self.y }; let scale = fn(self, n) { n }; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ImplStatement)
+	if !ok { t.Fatalf("statement is not *ast.ImplStatement. got=%T", program.Statements[0]) }
+	if stmt.Name.Value != "Point" { t.Errorf("wrong name. got=%q", stmt.Name.Value) }
+	if len(stmt.Methods) != 2 || stmt.Methods[0].Name.Value != "norm" || stmt.Methods[1].Name.Value != "scale" {
+		t.Errorf("wrong methods. got=%s", stmt.String())
+	}
+}
+
+func TestParsingMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"arr.len()", "(arr.len)()"},
+		{"arr.filter(f).map(g).len()", "(((arr.filter)(f).map)(g).len)()"},
+		{"s.split(\",\")[0]", "((s.split)(,)[0])"},
+		{"-arr.len()", "(-(arr.len)())"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		call := stmt.Expression
+		if indexed, ok := call.(*ast.IndexExpression); ok { call = indexed.Left }
+		if prefixed, ok := call.(*ast.PrefixExpression); ok { call = prefixed.Right }
+		if _, ok := call.(*ast.CallExpression).Function.(*ast.MemberExpression); !ok {
+			t.Errorf("%s: call is not on a member expression", tt.input)
+		}
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("wrong method call. expected=%q, got=%q", tt.expected, stmt.Expression.String())
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { 1 => "one", _ => "many" }`, `match (x) { 1 => one, _ => many }`},
+		{`match (x) { [] => 0, [h, ...t] => h + 1, }`, `match (x) { [] => 0, [h, ...t] => (h + 1) }`},
+		{`match (x) { [[a, _], ...rest] => a }`, `match (x) { [[a, _], ...rest] => a }`},
+		{`match (x) { {name, "age": a} if a > 1 => name }`, `match (x) { {"name": name, "age": a} if (a > 1) => name }`},
+		{`match (x) { {1: "one", two: [b]} => b }`, `match (x) { {1: "one", "two": [b]} => b }`},
+		{`match (x) { -1 => true, false => { let y = 1; y } n => n }`, `match (x) { (-1) => true, false => { let y = 1;y }, n => n }`},
+		{`match (x) {}`, `match (x) {  }`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.MatchExpression); !ok {
+			t.Fatalf("expression is not *ast.MatchExpression. got=%T", stmt.Expression)
+		}
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("wrong match expression. expected=%q, got=%q", tt.expected, stmt.Expression.String())
+		}
+	}
+}
+
+func TestPatternErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { [...t, h] => h }`, "Rest pattern must be the last element"},
+		{`match (x) { fn => 1 }`, "Unexpected FUNCTION in pattern"},
+		{`match (x) { {[1]: a} => a }`, "Unexpected [ in hash pattern key"},
+		{`match (x) { {"a"} => 1 }`, "Expected next token to be :, got } instead"},
+		{`match (x) { 1 => 2 3 => 4 }`, "Expected next token to be ,, got INTEGER instead"},
+		{`match (x) { 1 2 }`, "Expected next token to be =>, got INTEGER instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("%s: expected error %q. got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b, ...rest] = arr;", "let [a, b, ...rest] = arr;"},
+		{"let {name, age} = person;", `let {"name": name, "age": age} = person;`},
+		{"let [a, b = 2] = arr", "let [a, b = 2] = arr;"},
+		{"let {name, age = 1 + 1} = person", `let {"name": name, "age": age = (1 + 1)} = person;`},
+		{`let {"pos": [x, y] = [0, 0], tags: [first, ..._]} = item`, `let {"pos": [x, y] = [0, 0], "tags": [first, ..._]} = item;`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok { t.Fatalf("statement is not *ast.LetStatement. got=%T", program.Statements[0]) }
+		if stmt.Pattern == nil || stmt.Name != nil { t.Errorf("%s: expected a pattern instead of a name", tt.input) }
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong let statement. expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestFunctionParameterPatterns(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedNames    []string
+		expectedPatterns int // Parameters with a pattern, 0 means Patterns should be nil
+		expectedString   string
+	}{
+		{"fn(x, y) {}", []string{"x", "y"}, 0, "fn(x, y) "},
+		{"fn(x, y = 2) {}", []string{"x", "y"}, 1, "fn(x, y = 2) "},
+		{"fn([a, b], {c}) {}", []string{"[a, b]", `{"c": c}`}, 2, `fn([a, b], {"c": c}) `},
+		{"fn(x, [h, ...t] = [], n = len(t)) {}", []string{"x", "[h, ...t]", "n"}, 2, "fn(x, [h, ...t] = [], n = len(t)) "},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if len(function.Parameters) != len(tt.expectedNames) {
+			t.Fatalf("%s: wrong number of parameters. got=%d", tt.input, len(function.Parameters))
+		}
+		for i, name := range tt.expectedNames {
+			if function.Parameters[i].Value != name { t.Errorf("%s: parameter %d wrong. got=%q", tt.input, i, function.Parameters[i].Value) }
+		}
+
+		patterns := 0
+		for _, pattern := range function.Patterns {
+			if pattern != nil { patterns++ }
+		}
+		if patterns != tt.expectedPatterns || (tt.expectedPatterns == 0) != (function.Patterns == nil) {
+			t.Errorf("%s: wrong patterns. got=%v", tt.input, function.Patterns)
+		}
+		if function.String() != tt.expectedString {
+			t.Errorf("wrong function. expected=%q, got=%q", tt.expectedString, function.String())
+		}
+	}
+}
+
+func TestForExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (x in xs) { print(x) }", "for (x in xs) print(x)"},
+		{"for ([k, v] in pairs(h)) { k + v }", "for ([k, v] in pairs(h)) (k + v)"},
+		{"for ({name} in people) { let n = name; }", `for ({"name": name} in people) let n = name;`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.ForExpression); !ok {
+			t.Fatalf("expression is not *ast.ForExpression. got=%T", stmt.Expression)
+		}
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("wrong for expression. expected=%q, got=%q", tt.expected, stmt.Expression.String())
+		}
+	}
+}
+
+func TestYieldMarksTheEnclosingFunction(t *testing.T) {
+	p := New(lexer.New("fn() { let inner = fn(x) { yield x + 1 }; fn() { 1 } }"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	outer := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if outer.Generator { t.Errorf("outer function should not be a generator") }
+
+	inner := outer.Body.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if !inner.Generator { t.Errorf("inner function should be a generator") }
+	yield := inner.Body.Statements[0].(*ast.ExpressionStatement).Expression
+	if yield.String() != "yield (x + 1)" { t.Errorf("wrong yield expression. got=%q", yield.String()) }
+
+	last := outer.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if last.Generator { t.Errorf("function after the generator should not be a generator") }
+}
+
+func TestIterationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"yield 1", "yield outside of a function"},
+		{"for (x of xs) { x }", "Expected next token to be IN, got IDENTIFIER instead"},
+		{"for x in xs { x }", "Expected next token to be (, got IDENTIFIER instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("%s: expected error %q. got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestTaskExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"spawn f(x)", "spawn f(x)"},
+		{"spawn fn() { 1 }", "spawn fn() 1"},
+		{"spawn f(1) + 1", "(spawn f(1) + 1)"},
+		{"await spawn f()", "await spawn f()"},
+		{"await a + await b", "(await a + await b)"},
+		{"await fs[0]", "await (fs[0])"},
+		{"-await f", "(-await f)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program. expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
 func TestParsingHashLiteralStringKeys( t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -956,4 +1365,83 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		}
 		testFunc(value)
 	}
-}
\ No newline at end of file
+}
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 5;", "let x: int = 5;"},
+		{"let [a, b]: [string] = xs;", "let [a, b]: [string] = xs;"},
+		{"let h: {string: [int]} = {};", "let h: {string: [int]} = {};"},
+		{"let f: fn(int, string) -> bool = g;", "let f: fn(int, string) -> bool = g;"},
+		{"let f: fn() = g;", "let f: fn() = g;"},
+		{"fn(a: string, b: [int]) -> bool { true }", "fn(a: string, b: [int]) -> bool true"},
+		{"fn(a, b: int = 2) { a }", "fn(a, b: int = 2) a"},
+		{"fn([h, ...t]: [int], f: fn(int) -> int) { h }", "fn([h, ...t]: [int], f: fn(int) -> int) h"},
+		{"fn() -> {string: any} { {} }", "fn() -> {string: any} {}"},
+		{"1 - -2", "(1 - (-2))"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected { t.Errorf("%s: wrong program. got=%q, want=%q", tt.input, program.String(), tt.expected) }
+	}
+
+	function := New(lexer.New("fn(a, b: int) { a }")).ParseProgram().Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(function.Types) != 2 || function.Types[0] != nil || function.Types[1].String() != "int" {
+		t.Errorf("wrong parameter types. got=%v", function.Types)
+	}
+	if function.Patterns != nil { t.Errorf("annotations aren't patterns. got=%v", function.Patterns) }
+
+	function = New(lexer.New("fn(a, b) { a }")).ParseProgram().Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if function.Types != nil { t.Errorf("unannotated functions should have no types. got=%v", function.Types) }
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: = 5;", "Unexpected = in type"},
+		{"let x: [int = 5;", "Expected next token to be ], got = instead"},
+		{"let x: {string} = 5;", "Expected next token to be :, got } instead"},
+		{"fn(a: int b) {}", "Expected next token to be ,, got IDENTIFIER instead"},
+		{"fn(a) -> {}", "Unexpected } in type"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("%s: expected error %q. got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+/*
+ Parsers keep all of their state to themselves, so any number can run at once. Run with go test -race
+ */
+func TestConcurrentParsing(t *testing.T) {
+	input := "let f = fn(x, [a, b] = [1, 2]) { for (y in g(x)) { yield y * a } }; match (f(1)) { [h, ...t] => h, _ => spawn f(b) }"
+
+	var wg sync.WaitGroup
+	programs := make([]string, 16)
+	for i := range programs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := New(lexer.New(input))
+			programs[i] = p.ParseProgram().String()
+			if len(p.Errors()) != 0 { t.Errorf("parser had errors: %v", p.Errors()) }
+		}(i)
+	}
+	wg.Wait()
+
+	for _, program := range programs[1:] {
+		if program != programs[0] { t.Errorf("parsers disagree. got=%q, want=%q", program, programs[0]) }
+	}
+}
@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"fmt"
+	"mockc/ast"
+	"mockc/token"
+)
+
+/*
+ Parse match (value) { pattern => expr, pattern if guard => expr, ... }
+ An arm's body starting with { is a block, wrap a hash literal in parentheses to return one
+ */
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) { return nil }
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) { return nil }
+	if !p.expectPeek(token.LBRACE) { return nil }
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := &ast.MatchArm{Pattern: p.parsePattern()}
+		if arm.Pattern == nil { return nil }
+
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+		}
+
+		if !p.expectPeek(token.ARROW) { return nil }
+		p.nextToken()
+		if p.currTokenIs(token.LBRACE) {
+			arm.Body = p.parseBlockStatement()
+		} else {
+			arm.Body = p.parseExpression(LOWEST)
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		} else if !p.peekTokenIs(token.RBRACE) && !p.currTokenIs(token.RBRACE) { // Block bodies don't need a comma
+			p.peekError(token.COMMA)
+			return nil
+		}
+	}
+	p.nextToken()
+
+	return expression
+}
+
+/*
+ Parse a pattern starting at the current token
+ */
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.currToken.Type {
+	case token.IDENTIFIER:
+		if p.currToken.Literal == "_" { return &ast.WildcardPattern{Token: p.currToken} }
+		return &ast.BindingPattern{Name: &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}}
+	case token.INTEGER, token.STRING, token.TRUE, token.FALSE:
+		return &ast.LiteralPattern{Value: p.prefixParseFns[p.currToken.Type]()}
+	case token.MINUS: // Negative integer literals
+		if !p.peekTokenIs(token.INTEGER) { break }
+		return &ast.LiteralPattern{Value: p.parsePrefixExpression()}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	}
+
+	p.errors = append(p.errors, fmt.Sprintf("Unexpected %s in pattern", p.currToken.Type))
+	return nil
+}
+
+/*
+ Parse a pattern that may be followed by = and a default value
+ */
+func (p *Parser) parsePatternWithDefault() ast.Pattern {
+	pattern := p.parsePattern()
+	if pattern == nil || !p.peekTokenIs(token.ASSIGN) { return pattern }
+
+	return p.parseDefault(pattern)
+}
+
+func (p *Parser) parseDefault(pattern ast.Pattern) ast.Pattern {
+	p.nextToken()
+	p.nextToken()
+
+	value := p.parseExpression(LOWEST)
+	if value == nil { return nil }
+
+	return &ast.DefaultPattern{Pattern: pattern, Default: value}
+}
+
+/*
+ The pattern a default applies to, or the pattern itself if it has no default
+ */
+func defaultTarget(pattern ast.Pattern) ast.Pattern {
+	if withDefault, ok := pattern.(*ast.DefaultPattern); ok { return withDefault.Pattern }
+	return pattern
+}
+
+/*
+ Parse [a, b, ...rest], the rest pattern is optional and has to come last
+ Elements can have defaults for when the array is too short, ex. [a, b = 0]
+ */
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.currToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		if p.currTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			pattern.Rest = p.parsePattern()
+			if pattern.Rest == nil { return nil }
+			if !p.peekTokenIs(token.RBRACKET) {
+				p.errors = append(p.errors, "Rest pattern must be the last element")
+				return nil
+			}
+			break
+		}
+
+		element := p.parsePatternWithDefault()
+		if element == nil { return nil }
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) { return nil }
+	}
+	p.nextToken()
+
+	return pattern
+}
+
+/*
+ Parse {"key": pattern, ...}. A bare identifier is short for binding the string key with the same name, so {name}
+ means {"name": name}, and identifier keys are read as strings, so {name: n} means {"name": n}
+ Values can have defaults for missing keys, ex. {name, age = 0}
+ */
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.currToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		var key ast.Expression
+		switch p.currToken.Type {
+		case token.STRING, token.INTEGER:
+			key = p.prefixParseFns[p.currToken.Type]()
+		case token.IDENTIFIER:
+			key = &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
+		default:
+			p.errors = append(p.errors, fmt.Sprintf("Unexpected %s in hash pattern key", p.currToken.Type))
+			return nil
+		}
+
+		var value ast.Pattern
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			value = p.parsePatternWithDefault()
+			if value == nil { return nil }
+		} else if p.currTokenIs(token.IDENTIFIER) {
+			value = &ast.BindingPattern{Name: &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}}
+			if p.peekTokenIs(token.ASSIGN) { value = p.parseDefault(value) }
+			if value == nil { return nil }
+		} else {
+			p.peekError(token.COLON)
+			return nil
+		}
+
+		pattern.Keys = append(pattern.Keys, key)
+		pattern.Values = append(pattern.Values, value)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) { return nil }
+	}
+	p.nextToken()
+
+	return pattern
+}
@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"fmt"
+	"mockc/ast"
+	"mockc/token"
+)
+
+/*
+ Parse a type annotation starting at the current token: a name like int or Point, [T], {K: V} or fn(T, ...) -> R
+ */
+func (p *Parser) parseType() ast.TypeExpression {
+	switch p.currToken.Type {
+	case token.IDENTIFIER:
+		return &ast.NamedType{Token: p.currToken, Name: p.currToken.Literal}
+
+	case token.LBRACKET:
+		array := &ast.ArrayType{Token: p.currToken}
+		p.nextToken()
+		if array.Element = p.parseType(); array.Element == nil { return nil }
+		if !p.expectPeek(token.RBRACKET) { return nil }
+		return array
+
+	case token.LBRACE:
+		hash := &ast.HashType{Token: p.currToken}
+		p.nextToken()
+		if hash.Key = p.parseType(); hash.Key == nil { return nil }
+		if !p.expectPeek(token.COLON) { return nil }
+		p.nextToken()
+		if hash.Value = p.parseType(); hash.Value == nil { return nil }
+		if !p.expectPeek(token.RBRACE) { return nil }
+		return hash
+
+	case token.FUNCTION:
+		return p.parseFunctionType()
+	}
+
+	p.errors = append(p.errors, fmt.Sprintf("Unexpected %s in type", p.currToken.Type))
+	return nil
+}
+
+func (p *Parser) parseFunctionType() ast.TypeExpression {
+	function := &ast.FunctionType{Token: p.currToken}
+	if !p.expectPeek(token.LPAREN) { return nil }
+
+	for !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		param := p.parseType()
+		if param == nil { return nil }
+		function.Parameters = append(function.Parameters, param)
+
+		if !p.peekTokenIs(token.RPAREN) && !p.expectPeek(token.COMMA) { return nil }
+	}
+	p.nextToken()
+
+	if p.peekTokenIs(token.RETURNS) {
+		p.nextToken()
+		p.nextToken()
+		if function.Return = p.parseType(); function.Return == nil { return nil }
+	}
+
+	return function
+}
+
+/*
+ Parse the annotation after a colon if the next token is one, ok is false if there was one and it didn't parse
+ */
+func (p *Parser) parseAnnotation() (annotation ast.TypeExpression, ok bool) {
+	if !p.peekTokenIs(token.COLON) { return nil, true }
+	p.nextToken()
+	p.nextToken()
+
+	annotation = p.parseType()
+	return annotation, annotation != nil
+}
@@ -0,0 +1,187 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// Profiles in the format read by `go tool pprof`, a gzipped protocol buffer described by
+// https://github.com/google/pprof/blob/main/proto/profile.proto
+// Only the handful of messages needed are encoded, by hand, to keep the interpreter free of dependencies
+
+// Field numbers from profile.proto
+const (
+	PROFILE_SAMPLE_TYPE    = 1
+	PROFILE_SAMPLE         = 2
+	PROFILE_LOCATION       = 4
+	PROFILE_FUNCTION       = 5
+	PROFILE_STRING_TABLE   = 6
+	PROFILE_TIME_NANOS     = 9
+	PROFILE_DURATION_NANOS = 10
+	PROFILE_PERIOD_TYPE    = 11
+	PROFILE_PERIOD         = 12
+
+	VALUE_TYPE_TYPE = 1
+	VALUE_TYPE_UNIT = 2
+
+	SAMPLE_LOCATION_ID = 1
+	SAMPLE_VALUE       = 2
+
+	LOCATION_ID   = 1
+	LOCATION_LINE = 4
+
+	LINE_FUNCTION_ID = 1
+	LINE_LINE        = 2
+
+	FUNCTION_ID          = 1
+	FUNCTION_NAME        = 2
+	FUNCTION_SYSTEM_NAME = 3
+	FUNCTION_FILENAME    = 4
+	FUNCTION_START_LINE  = 5
+)
+
+/*
+ Write the profile for pprof. Each sample is a stack of function and line locations, valued by the calls it made and
+ the nanoseconds spent on its last line
+ */
+func (p *Profiler) WritePprof(w io.Writer) error {
+	var profile message
+	strings := newStringTable()
+
+	valueType := func(field int, kind, unit string) {
+		profile.message(field, func(m *message) {
+			m.int(VALUE_TYPE_TYPE, strings.index(kind))
+			m.int(VALUE_TYPE_UNIT, strings.index(unit))
+		})
+	}
+	valueType(PROFILE_SAMPLE_TYPE, "calls", "count")
+	valueType(PROFILE_SAMPLE_TYPE, "time", "nanoseconds")
+
+	locations := map[site]uint64{}
+	functions := []*function{}
+	seen := map[*function]bool{}
+	p.walk(func(stack []*node) {
+		ids := []uint64{}
+		for i := len(stack) - 1; i >= 0; i-- { // pprof wants the leaf first
+			n := stack[i]
+			key := site{function: n.function, line: n.line}
+			id, ok := locations[key]
+			if !ok {
+				id = uint64(len(locations) + 1)
+				locations[key] = id
+				profile.message(PROFILE_LOCATION, func(m *message) {
+					m.uint(LOCATION_ID, id)
+					m.message(LOCATION_LINE, func(line *message) {
+						line.uint(LINE_FUNCTION_ID, n.function.id)
+						line.int(LINE_LINE, int64(n.line))
+					})
+				})
+			}
+			if !seen[n.function] {
+				seen[n.function] = true
+				functions = append(functions, n.function)
+			}
+			ids = append(ids, id)
+		}
+
+		leaf := stack[len(stack)-1]
+		if leaf.calls == 0 && leaf.elapsed == 0 { return }
+		profile.message(PROFILE_SAMPLE, func(m *message) {
+			m.packedUints(SAMPLE_LOCATION_ID, ids)
+			m.packedInts(SAMPLE_VALUE, []int64{leaf.calls, leaf.elapsed.Nanoseconds()})
+		})
+	})
+
+	for _, f := range functions {
+		profile.message(PROFILE_FUNCTION, func(m *message) {
+			m.uint(FUNCTION_ID, f.id)
+			m.int(FUNCTION_NAME, strings.index(f.name))
+			m.int(FUNCTION_SYSTEM_NAME, strings.index(f.name))
+			m.int(FUNCTION_FILENAME, strings.index(p.file))
+			m.int(FUNCTION_START_LINE, int64(f.line))
+		})
+	}
+
+	profile.int(PROFILE_TIME_NANOS, p.start.UnixNano())
+	profile.int(PROFILE_DURATION_NANOS, p.duration.Nanoseconds())
+	valueType(PROFILE_PERIOD_TYPE, "time", "nanoseconds")
+	profile.int(PROFILE_PERIOD, 1)
+	for _, s := range strings.strings { profile.bytes(PROFILE_STRING_TABLE, []byte(s)) } // Added last, once every string is known
+
+	zipped := gzip.NewWriter(w)
+	if _, err := zipped.Write(profile.Bytes()); err != nil { return err }
+	return zipped.Close()
+}
+
+/*
+ Strings are stored once in the profile and referred to by index. Index 0 must be ""
+ */
+type stringTable struct {
+	strings []string
+	indexes map[string]int64
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{strings: []string{""}, indexes: map[string]int64{"": 0}}
+}
+
+func (t *stringTable) index(s string) int64 {
+	if i, ok := t.indexes[s]; ok { return i }
+	t.indexes[s] = int64(len(t.strings))
+	t.strings = append(t.strings, s)
+	return t.indexes[s]
+}
+
+/*
+ An encoded protocol buffer message
+ */
+type message struct {
+	bytes.Buffer
+}
+
+const (
+	WIRE_VARINT = 0
+	WIRE_BYTES  = 2
+)
+
+func (m *message) varint(x uint64) {
+	for x >= 0x80 {
+		m.WriteByte(byte(x) | 0x80)
+		x >>= 7
+	}
+	m.WriteByte(byte(x))
+}
+
+func (m *message) key(field, wire int) { m.varint(uint64(field)<<3 | uint64(wire)) }
+
+func (m *message) uint(field int, x uint64) {
+	m.key(field, WIRE_VARINT)
+	m.varint(x)
+}
+
+func (m *message) int(field int, x int64) { m.uint(field, uint64(x)) }
+
+func (m *message) bytes(field int, b []byte) {
+	m.key(field, WIRE_BYTES)
+	m.varint(uint64(len(b)))
+	m.Write(b)
+}
+
+func (m *message) message(field int, encode func(*message)) {
+	var inner message
+	encode(&inner)
+	m.bytes(field, inner.Bytes())
+}
+
+func (m *message) packedUints(field int, xs []uint64) {
+	var packed message
+	for _, x := range xs { packed.varint(x) }
+	m.bytes(field, packed.Bytes())
+}
+
+func (m *message) packedInts(field int, xs []int64) {
+	var packed message
+	for _, x := range xs { packed.varint(uint64(x)) }
+	m.bytes(field, packed.Bytes())
+}
@@ -0,0 +1,176 @@
+package profiler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mockc/ast"
+	"mockc/object"
+	"time"
+)
+
+// The profiler is an object.Tracer that times every statement a program runs. Time is charged to the line that was
+// running, inside the stack of Moxie calls that led to it, so the result can be read per function, per line or as a
+// flame graph. Call counts are charged to the stack a call made. It follows one stack, so it isn't a ForkingTracer and
+// spawned tasks aren't profiled
+
+type Profiler struct {
+	file      string           // Source file, for positions
+	clock     func() time.Time // Swapped out by tests
+	start     time.Time
+	last      time.Time        // When time was last charged
+	duration  time.Duration    // Set by Stop
+	main      *function        // Stands in for the top level of the program
+	root      *node            // Above main, doesn't belong to any function
+	stack     []*node          // One node per call in progress, main first
+	functions map[*ast.FunctionLiteral]*function
+}
+
+/*
+ A Moxie function. Every closure made from the same literal is the same function
+ */
+type function struct {
+	id     uint64
+	name   string
+	line   int // Where the function is defined
+	column int
+}
+
+/*
+ Calls form a tree. Each node is one line of one function, reached through the calls of its parents
+ */
+type node struct {
+	function *function
+	line     int
+	parent   *node
+	children map[site]*node
+	order    []*node       // Children in the order they first ran, so output is stable
+	calls    int64         // Calls that started at this node
+	elapsed  time.Duration // Time spent on this line itself, not in the calls it made
+}
+
+type site struct {
+	function *function
+	line     int
+}
+
+/*
+ Constructor for a profiler of a program read from file. It starts timing straight away
+ */
+func New(file string) *Profiler {
+	return newWithClock(file, time.Now)
+}
+
+func newWithClock(file string, clock func() time.Time) *Profiler {
+	p := &Profiler{file: file, clock: clock, functions: map[*ast.FunctionLiteral]*function{}}
+	p.main = &function{id: 1, name: "main", line: 1, column: 1}
+	p.root = &node{}
+	p.stack = []*node{p.root.child(p.main, 1)}
+	p.start = clock()
+	p.last = p.start
+
+	return p
+}
+
+func (p *Profiler) Call(fn *object.Function) {
+	p.charge()
+	caller := p.stack[len(p.stack)-1]
+	f := p.function(fn)
+	callee := caller.child(f, f.line)
+	callee.calls++
+	p.stack = append(p.stack, callee)
+}
+
+func (p *Profiler) Return() {
+	p.charge()
+	if len(p.stack) > 1 { p.stack = p.stack[:len(p.stack)-1] } // main never returns
+}
+
+func (p *Profiler) Statement(stmt ast.Statement) {
+	p.charge()
+	current := p.stack[len(p.stack)-1]
+	line := ast.StatementToken(stmt).Line
+	if line != current.line { p.stack[len(p.stack)-1] = current.parent.child(current.function, line) }
+}
+
+// Time is only charged to lines, blocks and branches don't need tracing
+func (p *Profiler) Block(block *ast.BlockStatement)          {}
+func (p *Profiler) Branch(node *ast.IfExpression, taken bool) {}
+
+/*
+ Stop timing. Writing a profile before stopping leaves out the time since the last statement
+ */
+func (p *Profiler) Stop() {
+	p.charge()
+	p.duration = p.last.Sub(p.start)
+}
+
+/*
+ Charge the time since the last event to whatever was running
+ */
+func (p *Profiler) charge() {
+	now := p.clock()
+	p.stack[len(p.stack)-1].elapsed += now.Sub(p.last)
+	p.last = now
+}
+
+func (p *Profiler) function(fn *object.Function) *function {
+	if f, ok := p.functions[fn.Literal]; ok { return f }
+
+	f := &function{id: uint64(len(p.functions) + 2), name: "anonymous"} // main is 1
+	if literal := fn.Literal; literal != nil {
+		f.line, f.column = literal.Token.Line, literal.Token.Column
+		f.name = literal.Name
+		if f.name == "" { f.name = fmt.Sprintf("fn@%d:%d", f.line, f.column) }
+	}
+	p.functions[fn.Literal] = f
+
+	return f
+}
+
+func (n *node) child(f *function, line int) *node {
+	key := site{function: f, line: line}
+	if child, ok := n.children[key]; ok { return child }
+
+	child := &node{function: f, line: line, parent: n}
+	if n.children == nil { n.children = map[site]*node{} }
+	n.children[key] = child
+	n.order = append(n.order, child)
+
+	return child
+}
+
+/*
+ Visit every node below root, parents first, with the nodes from main down to it
+ */
+func (p *Profiler) walk(visit func(stack []*node)) {
+	var walk func(n *node, stack []*node)
+	walk = func(n *node, stack []*node) {
+		stack = append(stack, n)
+		visit(stack)
+		for _, child := range n.order { walk(child, stack) }
+	}
+	for _, child := range p.root.order { walk(child, nil) }
+}
+
+/*
+ Write the profile in the folded stack format flame graph tools read, one line per stack that took any time:
+ main (fib.mx:12);fib (fib.mx:3) 1500
+ Each frame is a function and the line it was on, the number is the time spent there in nanoseconds
+ */
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	p.walk(func(stack []*node) {
+		leaf := stack[len(stack)-1]
+		if leaf.elapsed <= 0 { return }
+
+		for i, n := range stack {
+			if i > 0 { out.WriteString(";") }
+			fmt.Fprintf(out, "%s (%s:%d)", n.function.name, p.file, n.line)
+		}
+		fmt.Fprintf(out, " %d\n", leaf.elapsed.Nanoseconds())
+	})
+
+	return out.Flush()
+}
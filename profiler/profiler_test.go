@@ -0,0 +1,134 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mockc/evaluator"
+	"mockc/lexer"
+	"mockc/object"
+	"mockc/parser"
+	"testing"
+	"time"
+)
+
+/*
+ Run input under a profiler whose clock moves forward a microsecond every time it's read
+ */
+func profile(t *testing.T, input string) *Profiler {
+	t.Helper()
+	now := time.Unix(0, 0)
+	clock := func() time.Time {
+		now = now.Add(time.Microsecond)
+		return now
+	}
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 { t.Fatalf("parser had errors: %v", p.Errors()) }
+
+	prof := newWithClock("test.mx", clock)
+	runtime := object.NewRuntime()
+	runtime.Tracer = prof
+	evaluator.Eval(program, object.NewEnvironmentWithRuntime(runtime))
+	prof.Stop()
+
+	return prof
+}
+
+func TestFoldedStacks(t *testing.T) {
+	input := `let double = fn(x) {
+	x * 2
+};
+let quad = fn(x) { double(double(x)) };
+quad(1);
+fn() { 1 }();`
+
+	var out bytes.Buffer
+	if err := profile(t, input).WriteFolded(&out); err != nil { t.Fatal(err) }
+
+	// The outer double is a tail call, it runs after quad has returned
+	expected := `main (test.mx:1) 2000
+main (test.mx:4) 1000
+main (test.mx:5) 3000
+main (test.mx:5);quad (test.mx:4) 3000
+main (test.mx:5);quad (test.mx:4);double (test.mx:1) 1000
+main (test.mx:5);quad (test.mx:4);double (test.mx:2) 1000
+main (test.mx:5);double (test.mx:1) 1000
+main (test.mx:5);double (test.mx:2) 1000
+main (test.mx:6) 2000
+main (test.mx:6);fn@6:1 (test.mx:6) 2000
+`
+	if out.String() != expected { t.Errorf("wrong folded stacks. got=\n%s\nwant=\n%s", out.String(), expected) }
+}
+
+func TestCallCounts(t *testing.T) {
+	prof := profile(t, `
+	let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+	let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } };
+	fib(10);
+	count(50);`)
+
+	calls := map[string]int64{}
+	depth := map[string]int{}
+	prof.walk(func(stack []*node) {
+		leaf := stack[len(stack)-1]
+		calls[leaf.function.name] += leaf.calls
+		if len(stack) > depth[leaf.function.name] { depth[leaf.function.name] = len(stack) }
+	})
+
+	if calls["fib"] != 177 { t.Errorf("wrong number of calls to fib. got=%d, want=177", calls["fib"]) }
+	if calls["count"] != 51 { t.Errorf("wrong number of calls to count. got=%d, want=51", calls["count"]) }
+	if depth["count"] != 2 { t.Errorf("tail calls should replace their caller's frame. got depth=%d", depth["count"]) }
+}
+
+func TestPprofOutput(t *testing.T) {
+	prof := profile(t, "let f = fn() { 1 }; f(); f();")
+
+	var out bytes.Buffer
+	if err := prof.WritePprof(&out); err != nil { t.Fatal(err) }
+	zipped, err := gzip.NewReader(&out)
+	if err != nil { t.Fatalf("profile is not gzipped: %s", err) }
+	data, err := io.ReadAll(zipped)
+	if err != nil { t.Fatal(err) }
+
+	fields := map[uint64]int{}
+	strings := []string{}
+	for len(data) > 0 {
+		key, n := readVarint(t, data)
+		data = data[n:]
+		field, wire := key>>3, key&7
+		switch wire {
+		case WIRE_VARINT:
+			_, n = readVarint(t, data)
+			data = data[n:]
+		case WIRE_BYTES:
+			length, n := readVarint(t, data)
+			value := data[n : n+int(length)]
+			data = data[n+int(length):]
+			if field == PROFILE_STRING_TABLE { strings = append(strings, string(value)) }
+		default:
+			t.Fatalf("unexpected wire type %d", wire)
+		}
+		fields[field]++
+	}
+
+	if fields[PROFILE_SAMPLE_TYPE] != 2 { t.Errorf("wrong number of sample types. got=%d", fields[PROFILE_SAMPLE_TYPE]) }
+	if fields[PROFILE_FUNCTION] != 2 { t.Errorf("wrong number of functions. got=%d", fields[PROFILE_FUNCTION]) }
+	if fields[PROFILE_SAMPLE] != 2 { t.Errorf("wrong number of samples. got=%d", fields[PROFILE_SAMPLE]) } // Everything is on line 1 of main or f
+	expected := []string{"", "calls", "count", "time", "nanoseconds", "main", "test.mx", "f"}
+	if len(strings) != len(expected) { t.Fatalf("wrong string table. got=%q, want=%q", strings, expected) }
+	for i := range expected {
+		if strings[i] != expected[i] { t.Errorf("wrong string table. got=%q, want=%q", strings, expected) }
+	}
+}
+
+func readVarint(t *testing.T, data []byte) (uint64, int) {
+	var x uint64
+	for i, b := range data {
+		x |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 { return x, i + 1 }
+	}
+	t.Fatalf("truncated varint")
+	return 0, 0
+}
@@ -1,33 +1,60 @@
 package repl
 
 import (
-	"bufio" // Buffered io library
 	"fmt" // Formatted i/o, similar to C's printf/scanf
 	"io" // Go input/output lib
 	"mockc/lexer" // our custom lexer
 	"mockc/parser"
 	"mockc/evaluator"
 	"mockc/object"
+	"mockc/optimizer"
+	"mockc/snapshot"
+	"os"
+	"strings"
 )
 
 const PROMPT = ">> " // Prompt at the beginning of each newline for users to know when to input
 
+const AST_OPT_COMMAND = ":ast-opt" // Followed by code, prints the code after optimization instead of running it
+const SAVE_COMMAND = ":save"       // Followed by a path, saves every name defined so far to it
+const LOAD_COMMAND = ":load"       // Followed by a path, replaces every name defined so far with the ones saved there
+
+/*
+ Every line runs in the same environment and a later one can declare a function again, so functions are never inlined
+ */
+var optimizerOptions = optimizer.Options{FoldConstants: true, EliminateDeadBranches: true}
+
 /*
 Basically the REPL engine. Called once and runs in a loop until broken by the user.
+Programs entered run under the given runtime, which also reads its input from in so read_line and the prompt share it.
+Their output goes to out along with the results
  */
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+func Start(in io.Reader, out io.Writer, runtime *object.Runtime) {
+	runtime.SetStdin(in)
+	runtime.Stdout = out
+	env := object.NewEnvironmentWithRuntime(runtime)
 
 	for { // Perpetual for loop... I guess Go has those
 		fmt.Fprintf(out, PROMPT) // Formats string and writes to out
-		scanned := scanner.Scan()
+		line, err := runtime.Stdin.ReadString('\n')
 
-		if !scanned { // If nothing was entered, break the loop
+		if err != nil && line == "" { // If nothing was entered, break the loop
 			return
 		}
 
-		line := scanner.Text()
+		line = strings.TrimRight(line, "\r\n")
+		if path, ok := strings.CutPrefix(line, SAVE_COMMAND+" "); ok {
+			save(out, env, strings.TrimSpace(path))
+			continue
+		}
+		if path, ok := strings.CutPrefix(line, LOAD_COMMAND+" "); ok {
+			if loaded, ok := load(out, runtime, strings.TrimSpace(path)); ok { env = loaded }
+			continue
+		}
+
+		showOptimized := strings.HasPrefix(line, AST_OPT_COMMAND)
+		if showOptimized { line = strings.TrimPrefix(line, AST_OPT_COMMAND) }
+
 		l := lexer.New(line) // Tokenize the user input
 		p := parser.New(l) // Parse the tokens
 
@@ -37,6 +64,13 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
+		program = optimizer.Optimize(program, optimizerOptions)
+		if showOptimized {
+			io.WriteString(out, program.String())
+			io.WriteString(out, "\n")
+			continue
+		}
+
 		eval := evaluator.Eval(program, env)
 		if eval != nil {
 			io.WriteString(out, eval.Inspect())
@@ -45,6 +79,32 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
+func save(out io.Writer, env *object.Environment, path string) {
+	data, err := snapshot.Snapshot(env)
+	if err == nil { err = os.WriteFile(path, data, 0644) }
+	if err != nil {
+		fmt.Fprintf(out, "Could not save to %s: %s\n", path, err)
+		return
+	}
+	fmt.Fprintf(out, "Saved to %s\n", path)
+}
+
+/*
+ The environment saved at path, which runs under the REPL's runtime. ok is false if it couldn't be loaded, in which
+ case the REPL keeps the environment it had
+ */
+func load(out io.Writer, runtime *object.Runtime, path string) (*object.Environment, bool) {
+	data, err := os.ReadFile(path)
+	var env *object.Environment
+	if err == nil { env, err = snapshot.Restore(data, runtime) }
+	if err != nil {
+		fmt.Fprintf(out, "Could not load %s: %s\n", path, err)
+		return nil, false
+	}
+	fmt.Fprintf(out, "Loaded %s\n", path)
+	return env, true
+}
+
 const MONKEY_FACE = `
             __,__
    .--.  .-"     "-.  .--.
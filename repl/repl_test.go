@@ -0,0 +1,22 @@
+package repl
+
+import (
+	"bytes"
+	"mockc/object"
+	"strings"
+	"testing"
+)
+
+func TestRedefinedFunctions(t *testing.T) {
+	input := `let f = fn(x) { x + 1 }; let g = fn(y) { f(y) };
+let f = fn(x) { x * 100 };
+g(2)
+:ast-opt let g = fn(y) { f(y) };
+`
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out, object.NewRuntime())
+
+	expected := PROMPT + PROMPT + PROMPT + "200\n" + PROMPT + "let g = fn(y) f(y);\n" + PROMPT
+	if out.String() != expected { t.Errorf("calls should reach the latest definition. got=%q, want=%q", out.String(), expected) }
+}
@@ -0,0 +1,239 @@
+package resolver
+
+import "mockc/ast"
+
+/*
+ The resolver walks a parsed program and gives every identifier declared or used inside a function or match arm an
+ address: how many environments out its scope is and which slot of that environment holds it. The evaluator can then
+ read the slot directly instead of searching every environment's names.
+
+ Top level names are left unresolved and looked up by name, since the REPL keeps adding to the global scope one line at
+ a time. So are names that aren't declared yet when they're used, ex. a local function calling one defined after it.
+ Both still work, just without the shortcut
+ */
+
+type scope struct {
+	names []string
+	slots map[string]int
+}
+
+type resolver struct {
+	scopes []*scope // Innermost last. Empty at the top level
+}
+
+/*
+ Resolve every identifier in program. Safe to run again after the tree has been changed, ex. by the optimizer
+ */
+func Resolve(program *ast.Program) {
+	r := &resolver{}
+	for _, stmt := range program.Statements { r.statement(stmt) }
+}
+
+func (r *resolver) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt.Pattern != nil {
+			r.declarePattern(stmt.Pattern) // Declared first so recursive functions find themselves in a slot
+		} else if stmt.Name != nil {
+			r.declare(stmt.Name)
+		}
+		r.expression(stmt.Value)
+
+	case *ast.StructStatement:
+		r.declare(stmt.Name)
+
+	case *ast.ImplStatement:
+		r.expression(stmt.Name)
+		for _, method := range stmt.Methods { r.expression(method.Value) } // Method names go on the struct, not in scope
+
+	case *ast.ReturnStatement:
+		r.expression(stmt.ReturnValue)
+
+	case *ast.ExpressionStatement:
+		r.expression(stmt.Expression)
+
+	case *ast.BlockStatement:
+		r.block(stmt)
+	}
+}
+
+/*
+ Blocks don't get scopes of their own, a let inside an if binds in the enclosing function
+ */
+func (r *resolver) block(block *ast.BlockStatement) {
+	if block == nil { return }
+	for _, stmt := range block.Statements { r.statement(stmt) }
+}
+
+func (r *resolver) expression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		r.resolve(expr)
+
+	case *ast.PrefixExpression:
+		r.expression(expr.Right)
+
+	case *ast.InfixExpression:
+		r.expression(expr.Left)
+		r.expression(expr.Right)
+
+	case *ast.IfExpression:
+		r.expression(expr.Condition)
+		r.block(expr.Consequence)
+		r.block(expr.Alternative)
+
+	case *ast.FunctionLiteral:
+		r.function(expr)
+
+	case *ast.CallExpression:
+		r.expression(expr.Function)
+		for _, arg := range expr.Arguments { r.expression(arg) }
+
+	case *ast.Array:
+		for _, element := range expr.Elements { r.expression(element) }
+
+	case *ast.IndexExpression:
+		r.expression(expr.Left)
+		r.expression(expr.Index)
+
+	case *ast.SliceExpression:
+		r.expression(expr.Left)
+		if expr.Start != nil { r.expression(expr.Start) }
+		if expr.End != nil { r.expression(expr.End) }
+
+	case *ast.MemberExpression:
+		r.expression(expr.Object) // The property is a field or method name, not a variable
+
+	case *ast.HashLiteral:
+		for _, key := range expr.Keys {
+			r.expression(key)
+			r.expression(expr.Pairs[key])
+		}
+
+	case *ast.MatchExpression:
+		r.expression(expr.Subject)
+		for _, arm := range expr.Arms { r.arm(arm) }
+
+	case *ast.ForExpression:
+		r.expression(expr.Iterable)
+		r.loop(expr)
+
+	case *ast.YieldExpression:
+		r.expression(expr.Value)
+
+	case *ast.SpawnExpression:
+		r.expression(expr.Task)
+
+	case *ast.AwaitExpression:
+		r.expression(expr.Future)
+	}
+}
+
+/*
+ Parameters come first, in order, so defaults can use the parameters before them
+ */
+func (r *resolver) function(fn *ast.FunctionLiteral) {
+	r.push()
+	for i, param := range fn.Parameters {
+		if fn.Patterns != nil && fn.Patterns[i] != nil {
+			r.declarePattern(fn.Patterns[i])
+			continue
+		}
+		r.declare(param)
+	}
+	r.block(fn.Body)
+	fn.Scope = r.pop()
+}
+
+func (r *resolver) arm(arm *ast.MatchArm) {
+	r.push()
+	r.declarePattern(arm.Pattern)
+	if arm.Guard != nil { r.expression(arm.Guard) }
+
+	switch body := arm.Body.(type) {
+	case *ast.BlockStatement:
+		r.block(body)
+	case ast.Expression:
+		r.expression(body)
+	}
+	arm.Scope = r.pop()
+}
+
+/*
+ Like a match arm, each element of a for loop is bound in a scope of its own
+ */
+func (r *resolver) loop(loop *ast.ForExpression) {
+	r.push()
+	r.declarePattern(loop.Pattern)
+	r.block(loop.Body)
+	loop.Scope = r.pop()
+}
+
+/*
+ Declare the names a pattern binds. Literals and defaults inside it are ordinary expressions
+ */
+func (r *resolver) declarePattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		r.declare(pattern.Name)
+
+	case *ast.DefaultPattern:
+		r.declarePattern(pattern.Pattern)
+		r.expression(pattern.Default)
+
+	case *ast.LiteralPattern:
+		r.expression(pattern.Value)
+
+	case *ast.ArrayPattern:
+		for _, element := range pattern.Elements { r.declarePattern(element) }
+		if pattern.Rest != nil { r.declarePattern(pattern.Rest) }
+
+	case *ast.HashPattern:
+		for i, key := range pattern.Keys {
+			r.expression(key)
+			r.declarePattern(pattern.Values[i])
+		}
+	}
+}
+
+func (r *resolver) push() {
+	r.scopes = append(r.scopes, &scope{slots: map[string]int{}})
+}
+
+func (r *resolver) pop() *ast.Scope {
+	innermost := r.scopes[len(r.scopes)-1]
+	r.scopes = r.scopes[:len(r.scopes)-1]
+	return &ast.Scope{Names: innermost.names}
+}
+
+/*
+ Give ident a slot in the innermost scope. Declaring a name twice reuses its slot, like rebinding it with let does
+ */
+func (r *resolver) declare(ident *ast.Identifier) {
+	if len(r.scopes) == 0 { // Globals are looked up by name
+		ident.Resolved = false
+		return
+	}
+
+	innermost := r.scopes[len(r.scopes)-1]
+	slot, ok := innermost.slots[ident.Value]
+	if !ok {
+		slot = len(innermost.names)
+		innermost.slots[ident.Value] = slot
+		innermost.names = append(innermost.names, ident.Value)
+	}
+	ident.Resolved, ident.Depth, ident.Slot = true, 0, slot
+}
+
+/*
+ Point ident at the nearest scope that has declared it so far, or leave it to be looked up by name
+ */
+func (r *resolver) resolve(ident *ast.Identifier) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if slot, ok := r.scopes[i].slots[ident.Value]; ok {
+			ident.Resolved, ident.Depth, ident.Slot = true, len(r.scopes)-1-i, slot
+			return
+		}
+	}
+	ident.Resolved = false
+}
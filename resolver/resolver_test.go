@@ -0,0 +1,132 @@
+package resolver_test // The parser runs the resolver, so these tests live outside the package to avoid an import cycle
+
+import (
+	"mockc/ast"
+	"mockc/lexer"
+	"mockc/parser"
+	"testing"
+)
+
+func TestFunctionScopes(t *testing.T) {
+	program := parse(t, "let f = fn(a) { let b = a; fn(c) { a + b + c + g } };")
+
+	let := program.Statements[0].(*ast.LetStatement)
+	testUnresolved(t, let.Name)
+
+	outer := let.Value.(*ast.FunctionLiteral)
+	testScope(t, outer.Scope, "a", "b")
+	testAddress(t, outer.Parameters[0], 0, 0)
+	inner := outer.Body.Statements[0].(*ast.LetStatement)
+	testAddress(t, inner.Name, 0, 1)
+	testAddress(t, inner.Value.(*ast.Identifier), 0, 0)
+
+	closure := outer.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	testScope(t, closure.Scope, "c")
+	sum := closure.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression) // ((a + b) + c) + g
+	testUnresolved(t, sum.Right.(*ast.Identifier))
+	sum = sum.Left.(*ast.InfixExpression)
+	testAddress(t, sum.Right.(*ast.Identifier), 0, 0)
+	sum = sum.Left.(*ast.InfixExpression)
+	testAddress(t, sum.Left.(*ast.Identifier), 1, 0)
+	testAddress(t, sum.Right.(*ast.Identifier), 1, 1)
+}
+
+func TestBlocksShareTheFunctionScope(t *testing.T) {
+	program := parse(t, "fn(x) { if (x) { let y = 1; } let x = 2; y }")
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	testScope(t, fn.Scope, "x", "y") // Rebinding x reuses its slot
+
+	rebound := fn.Body.Statements[1].(*ast.LetStatement)
+	testAddress(t, rebound.Name, 0, 0)
+	testAddress(t, fn.Body.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.Identifier), 0, 1)
+}
+
+func TestMatchArmScopes(t *testing.T) {
+	program := parse(t, "fn(x) { match (x) { [h, ...t] if h > 0 => h + x, {name} => name, _ => 0 } }")
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	match := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+	testAddress(t, match.Subject.(*ast.Identifier), 0, 0)
+
+	arm := match.Arms[0]
+	testScope(t, arm.Scope, "h", "t")
+	testAddress(t, arm.Guard.(*ast.InfixExpression).Left.(*ast.Identifier), 0, 0)
+	body := arm.Body.(*ast.InfixExpression)
+	testAddress(t, body.Left.(*ast.Identifier), 0, 0)
+	testAddress(t, body.Right.(*ast.Identifier), 1, 0)
+
+	testScope(t, match.Arms[1].Scope, "name")
+	testAddress(t, match.Arms[1].Body.(*ast.Identifier), 0, 0)
+	testScope(t, match.Arms[2].Scope)
+}
+
+func TestForLoopScopes(t *testing.T) {
+	program := parse(t, "fn(xs) { for ([k, v] in xs) { let w = v; k + w } }")
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	testScope(t, fn.Scope, "xs")
+	loop := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ForExpression)
+	testAddress(t, loop.Iterable.(*ast.Identifier), 0, 0)
+	testScope(t, loop.Scope, "k", "v", "w") // Each iteration gets fresh bindings
+
+	sum := loop.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	testAddress(t, sum.Left.(*ast.Identifier), 0, 0)
+	testAddress(t, sum.Right.(*ast.Identifier), 0, 2)
+}
+
+func TestUnresolvedNames(t *testing.T) {
+	program := parse(t, `
+	let x = 1;
+	fn() {
+		let isEven = fn(n) { isOdd(n) };
+		let isOdd = fn(n) { isEven(n) };
+		x + len([]) + p.x
+	}`)
+
+	fn := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	testScope(t, fn.Scope, "isEven", "isOdd")
+
+	isEven := fn.Body.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	testUnresolved(t, isEven.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression).Function.(*ast.Identifier))
+	isOdd := fn.Body.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	testAddress(t, isOdd.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression).Function.(*ast.Identifier), 1, 0)
+
+	sum := fn.Body.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	member := sum.Right.(*ast.MemberExpression)
+	testUnresolved(t, member.Object.(*ast.Identifier))
+	testUnresolved(t, member.Property)
+	sum = sum.Left.(*ast.InfixExpression)
+	testUnresolved(t, sum.Left.(*ast.Identifier))
+	testUnresolved(t, sum.Right.(*ast.CallExpression).Function.(*ast.Identifier))
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 { t.Fatalf("parser had errors: %v", p.Errors()) }
+	return program
+}
+
+func testScope(t *testing.T, scope *ast.Scope, names ...string) {
+	t.Helper()
+	if scope == nil { t.Fatalf("scope was not resolved") }
+	if len(scope.Names) != len(names) { t.Fatalf("scope has wrong names. got=%v, want=%v", scope.Names, names) }
+	for i, name := range names {
+		if scope.Names[i] != name { t.Errorf("scope has wrong names. got=%v, want=%v", scope.Names, names) }
+	}
+}
+
+func testAddress(t *testing.T, ident *ast.Identifier, depth, slot int) {
+	t.Helper()
+	if !ident.Resolved { t.Fatalf("%s was not resolved", ident.Value) }
+	if ident.Depth != depth || ident.Slot != slot {
+		t.Errorf("%s has wrong address. got=(%d, %d), want=(%d, %d)", ident.Value, ident.Depth, ident.Slot, depth, slot)
+	}
+}
+
+func testUnresolved(t *testing.T, ident *ast.Identifier) {
+	t.Helper()
+	if ident.Resolved { t.Errorf("%s should be looked up by name, got=(%d, %d)", ident.Value, ident.Depth, ident.Slot) }
+}
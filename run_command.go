@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mockc/coverage"
+	"mockc/evaluator"
+	"mockc/lexer"
+	"mockc/object"
+	"mockc/optimizer"
+	"mockc/parser"
+	"mockc/profiler"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ mockc run [--profile file | --coverprofile file] program.mx
+ Runs a Moxie program and returns its exit status: what it passed to exit(), 1 if it failed and 2 for bad usage.
+ --profile writes a pprof profile of where the program spent its time to file, and the same profile as folded stacks
+ for flame graphs next to it, ex. out.pprof and out.folded. --coverprofile writes a coverage profile of what ran
+ */
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	profile := flags.String("profile", "", "write a pprof profile of the run to this file")
+	coverProfile := flags.String("coverprofile", "", "write a coverage profile of the run to this file")
+	if err := flags.Parse(args); err != nil { return 2 }
+	if flags.NArg() != 1 || (*profile != "" && *coverProfile != "") {
+		fmt.Fprintln(os.Stderr, "Usage: mockc run [--profile file | --coverprofile file] program.mx")
+		return 2
+	}
+
+	path := flags.Arg(0)
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprintln(os.Stderr, "parser errors:")
+		for _, msg := range p.Errors() { fmt.Fprintln(os.Stderr, "\t"+msg) }
+		return 1
+	}
+
+	exitCode := -1
+	runtime := hostRuntime()
+	runtime.SetStdin(os.Stdin)
+	runtime.Exit = func(code int) { exitCode = code } // Stop evaluating instead, so the profile still gets written
+
+	options := optimizer.DefaultOptions()
+	if *profile != "" { options.InlineLimit = 0 } // Inlined functions would go missing from the profile
+	if *coverProfile != "" { options = optimizer.Options{} } // Coverage is of the program as written
+	program = optimizer.Optimize(program, options)
+
+	var cover *coverage.Profile
+	if *coverProfile != "" {
+		cover = coverage.NewProfile()
+		cover.Instrument(path, program)
+		runtime.Tracer = cover
+	}
+
+	var prof *profiler.Profiler
+	if *profile != "" {
+		prof = profiler.New(path)
+		runtime.Tracer = prof
+	}
+
+	result := evaluator.Eval(program, object.NewEnvironmentWithRuntime(runtime))
+	if prof != nil {
+		prof.Stop()
+		if err := writeProfiles(prof, *profile); err != nil { fmt.Fprintf(os.Stderr, "Could not write profile: %s\n", err) }
+	}
+	if cover != nil {
+		if err := writeCoverProfile(cover, *coverProfile); err != nil { fmt.Fprintf(os.Stderr, "Could not write coverage profile: %s\n", err) }
+	}
+
+	if exitCode >= 0 { return exitCode }
+	if errObj, ok := result.(*object.Error); ok {
+		fmt.Fprintln(os.Stderr, errObj.Inspect())
+		return 1
+	}
+
+	return 0
+}
+
+func writeProfiles(prof *profiler.Profiler, path string) error {
+	if err := writeReport(path, prof.WritePprof); err != nil { return err }
+	return writeReport(strings.TrimSuffix(path, filepath.Ext(path)) + ".folded", prof.WriteFolded)
+}
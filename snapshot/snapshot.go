@@ -0,0 +1,355 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"mockc/ast"
+	"mockc/evaluator"
+	"mockc/lexer"
+	"mockc/object"
+	"mockc/parser"
+	"sort"
+	"strconv"
+)
+
+// Snapshots save an environment, and everything its values refer to, as JSON so it can be restored later, ex. by the
+// next run of a service or REPL. Values and environments are stored once each in flat lists and refer to each other
+// by position, so values shared between names stay shared and closures that capture themselves, or each other, can be
+// saved at all. Functions are saved as their source and the environment they captured, and evaluated again on restore
+
+const VERSION = 1 // Bumped whenever a change to the format would stop older snapshots from restoring correctly
+
+type file struct {
+	Version      int           `json:"version"`
+	Environment  int           `json:"environment"` // The environment that was snapshotted
+	Environments []environment `json:"environments"`
+	Values       []value       `json:"values"`
+}
+
+/*
+ Environments come after the one enclosing them, so they can be created in order
+ */
+type environment struct {
+	Outer    int            `json:"outer"`           // -1 for a global environment
+	Slots    []string       `json:"slots,omitempty"` // Names the resolver gave slots to, in slot order
+	Bindings map[string]int `json:"bindings"`
+}
+
+type value struct {
+	Type        object.ObjectType `json:"type"`
+	Value       string            `json:"value,omitempty"`       // Integers in decimal, strings, booleans, builtin and struct names and function source
+	Elements    []int             `json:"elements,omitempty"`    // Array elements, hash values and struct field values
+	Keys        []int             `json:"keys,omitempty"`        // Hash keys, one per value
+	Fields      []string          `json:"fields,omitempty"`      // Field names of a struct type
+	Methods     map[string]int    `json:"methods,omitempty"`     // Methods of a struct type
+	Definition  *int              `json:"definition,omitempty"`  // Struct type of a struct
+	Environment *int              `json:"environment,omitempty"` // Environment a function captured
+}
+
+/*
+ Save env, the environments enclosing it and every value they hold. Iterators, channels, futures and anything else
+ that's running rather than just data can't be saved
+ */
+func Snapshot(env *object.Environment) ([]byte, error) {
+	e := &encoder{values: map[object.Object]int{}, environments: map[*object.Environment]int{}}
+	root, err := e.environment(env)
+	if err != nil { return nil, err }
+
+	e.file.Version = VERSION
+	e.file.Environment = root
+	return json.MarshalIndent(e.file, "", "  ")
+}
+
+type encoder struct {
+	file         file
+	values       map[object.Object]int
+	environments map[*object.Environment]int
+}
+
+func (e *encoder) environment(env *object.Environment) (int, error) {
+	if id, ok := e.environments[env]; ok { return id, nil }
+
+	outer := -1
+	if env.Outer() != nil {
+		var err error
+		if outer, err = e.environment(env.Outer()); err != nil { return 0, err }
+	}
+
+	id := len(e.file.Environments)
+	e.environments[env] = id // Before its values, which may be closures that captured it
+	e.file.Environments = append(e.file.Environments, environment{Outer: outer, Slots: env.SlotNames(), Bindings: map[string]int{}})
+
+	for _, binding := range env.Bindings() {
+		valueId, err := e.value(binding.Value)
+		if err != nil { return 0, fmt.Errorf("cannot save %s: %s", binding.Name, err) }
+		e.file.Environments[id].Bindings[binding.Name] = valueId
+	}
+
+	return id, nil
+}
+
+func (e *encoder) value(obj object.Object) (int, error) {
+	if id, ok := e.values[obj]; ok { return id, nil }
+
+	id := len(e.file.Values)
+	e.values[obj] = id // Before its elements, which may lead back to it through a closure
+	e.file.Values = append(e.file.Values, value{Type: obj.Type()})
+	saved, err := e.encode(obj)
+	if err != nil { return 0, err }
+	e.file.Values[id] = saved
+
+	return id, nil
+}
+
+func (e *encoder) encode(obj object.Object) (value, error) {
+	saved := value{Type: obj.Type()}
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		saved.Value = strconv.FormatInt(obj.Value, 10)
+	case *object.BigInteger:
+		saved.Value = obj.Value.String()
+	case *object.Boolean:
+		saved.Value = strconv.FormatBool(obj.Value)
+	case *object.String:
+		saved.Value = obj.Value
+	case *object.Null:
+
+	case *object.Array:
+		elements, err := e.list(obj.Elements)
+		if err != nil { return saved, err }
+		saved.Elements = elements
+
+	case *object.Hash:
+		for _, pair := range obj.Pairs() {
+			key, err := e.value(pair.Key)
+			if err != nil { return saved, err }
+			element, err := e.value(pair.Value)
+			if err != nil { return saved, err }
+			saved.Keys = append(saved.Keys, key)
+			saved.Elements = append(saved.Elements, element)
+		}
+
+	case *object.Function:
+		if obj.Literal == nil || obj.Literal.Source == "" { return saved, fmt.Errorf("function has no source") }
+		env, err := e.environment(obj.Env)
+		if err != nil { return saved, err }
+		saved.Value = obj.Literal.Source
+		saved.Environment = &env
+
+	case *object.BuiltIn:
+		name, ok := builtinName(obj)
+		if !ok { return saved, fmt.Errorf("builtin is not one of the interpreter's") }
+		saved.Value = name
+
+	case *object.StructType:
+		saved.Value = obj.Name
+		saved.Fields = obj.Fields
+		saved.Methods = map[string]int{}
+		methods := obj.Methods()
+		for _, name := range sortedNames(methods) {
+			id, err := e.value(methods[name])
+			if err != nil { return saved, fmt.Errorf("method %s: %s", name, err) }
+			saved.Methods[name] = id
+		}
+
+	case *object.Struct:
+		definition, err := e.value(obj.Definition)
+		if err != nil { return saved, err }
+		elements, err := e.list(obj.Values)
+		if err != nil { return saved, err }
+		saved.Definition = &definition
+		saved.Elements = elements
+
+	default:
+		return saved, fmt.Errorf("values of type %s can't be saved", obj.Type())
+	}
+
+	return saved, nil
+}
+
+func (e *encoder) list(objs []object.Object) ([]int, error) {
+	ids := []int{}
+	for _, obj := range objs {
+		id, err := e.value(obj)
+		if err != nil { return nil, err }
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+/*
+ The keys of a map in order, so saving and restoring visit values in the same order every time
+ */
+func sortedNames[V any](named map[string]V) []string {
+	names := []string{}
+	for name := range named { names = append(names, name) }
+	sort.Strings(names)
+
+	return names
+}
+
+func builtinName(builtin *object.BuiltIn) (string, bool) {
+	for _, name := range evaluator.BuiltinNames() {
+		if candidate, _ := evaluator.LookupBuiltin(name); candidate == builtin { return name, true }
+	}
+	return "", false
+}
+
+/*
+ Rebuild the environment a snapshot saved. Its outermost environment becomes a global environment running under
+ runtime, every other one is enclosed by it, same as when they were saved
+ */
+func Restore(data []byte, runtime *object.Runtime) (*object.Environment, error) {
+	var saved file
+	if err := json.Unmarshal(data, &saved); err != nil { return nil, fmt.Errorf("not a snapshot: %s", err) }
+	if saved.Version != VERSION { return nil, fmt.Errorf("unsupported snapshot version %d, want %d", saved.Version, VERSION) }
+
+	d := &decoder{file: saved, values: make([]object.Object, len(saved.Values))}
+	for id, env := range saved.Environments { // Created before any value, so closures have somewhere to point
+		if env.Outer >= id { return nil, fmt.Errorf("environment %d is enclosed by %d, which comes after it", id, env.Outer) }
+		d.environments = append(d.environments, d.newEnvironment(env, runtime))
+	}
+
+	for id, env := range saved.Environments {
+		for _, name := range sortedNames(env.Bindings) { // So restoring fails the same way every time
+			obj, err := d.value(env.Bindings[name])
+			if err != nil { return nil, fmt.Errorf("environment %d, %s: %s", id, name, err) }
+			d.environments[id].Set(name, obj)
+		}
+	}
+
+	if saved.Environment < 0 || saved.Environment >= len(d.environments) {
+		return nil, fmt.Errorf("no environment %d", saved.Environment)
+	}
+	return d.environments[saved.Environment], nil
+}
+
+type decoder struct {
+	file         file
+	environments []*object.Environment
+	values       []object.Object // Filled in as they're decoded, nil until then
+}
+
+func (d *decoder) newEnvironment(env environment, runtime *object.Runtime) *object.Environment {
+	if env.Outer < 0 { return object.NewEnvironmentWithRuntime(runtime) }
+
+	outer := d.environments[env.Outer]
+	if env.Slots != nil { return object.NewScopedEnvironment(outer, env.Slots) }
+	return object.NewEnclosedEnvironment(outer)
+}
+
+func (d *decoder) value(id int) (object.Object, error) {
+	if id < 0 || id >= len(d.values) { return nil, fmt.Errorf("no value %d", id) }
+	if d.values[id] != nil { return d.values[id], nil }
+
+	saved := d.file.Values[id]
+	switch saved.Type {
+	case object.INTEGER_OBJECT:
+		integer, err := strconv.ParseInt(saved.Value, 10, 64)
+		if err != nil { return nil, fmt.Errorf("value %d: %s", id, err) }
+		d.values[id] = &object.Integer{Value: integer}
+
+	case object.BIG_INTEGER_OBJECT:
+		integer, ok := new(big.Int).SetString(saved.Value, 10)
+		if !ok { return nil, fmt.Errorf("value %d: malformed integer %q", id, saved.Value) }
+		d.values[id] = &object.BigInteger{Value: integer}
+
+	case object.BOOLEAN_OBJECT:
+		d.values[id] = evaluator.TRUE // The evaluator compares booleans by identity, so only its own will do
+		if saved.Value != "true" { d.values[id] = evaluator.FALSE }
+
+	case object.STRING_OBJECT:
+		d.values[id] = &object.String{Value: saved.Value}
+
+	case object.NULL_OBJECT:
+		d.values[id] = evaluator.NULL
+
+	case object.ARRAY_OBJECT:
+		array := &object.Array{}
+		d.values[id] = array // Before its elements, which may lead back to it through a closure
+		elements, err := d.list(saved.Elements)
+		if err != nil { return nil, err }
+		array.Elements = elements
+
+	case object.HASH_OBJECT:
+		hash := object.NewHash()
+		d.values[id] = hash
+		if len(saved.Keys) != len(saved.Elements) { return nil, fmt.Errorf("value %d: %d keys for %d values", id, len(saved.Keys), len(saved.Elements)) }
+		for i, keyId := range saved.Keys {
+			key, err := d.value(keyId)
+			if err != nil { return nil, err }
+			hashable, ok := key.(object.Hashable)
+			if !ok { return nil, fmt.Errorf("value %d: unusable as hash key: %s", id, key.Type()) }
+			element, err := d.value(saved.Elements[i])
+			if err != nil { return nil, err }
+			hash.Set(hashable, element)
+		}
+
+	case object.FUNCTION_OBJECT:
+		if saved.Environment == nil || *saved.Environment < 0 || *saved.Environment >= len(d.environments) {
+			return nil, fmt.Errorf("value %d: function without an environment", id)
+		}
+		literal, err := parseFunction(saved.Value)
+		if err != nil { return nil, fmt.Errorf("value %d: %s", id, err) }
+		d.values[id] = evaluator.Eval(literal, d.environments[*saved.Environment])
+
+	case object.BUILTIN_OBJECT:
+		builtin, ok := evaluator.LookupBuiltin(saved.Value)
+		if !ok { return nil, fmt.Errorf("value %d: no builtin %s", id, saved.Value) }
+		d.values[id] = builtin
+
+	case object.STRUCT_TYPE_OBJECT:
+		definition := &object.StructType{Name: saved.Value, Fields: saved.Fields}
+		d.values[id] = definition
+		for _, name := range sortedNames(saved.Methods) {
+			method, err := d.value(saved.Methods[name])
+			if err != nil { return nil, err }
+			definition.SetMethod(name, method)
+		}
+
+	case object.STRUCT_OBJECT:
+		if saved.Definition == nil { return nil, fmt.Errorf("value %d: struct without a definition", id) }
+		definition, err := d.value(*saved.Definition)
+		if err != nil { return nil, err }
+		structType, ok := definition.(*object.StructType)
+		if !ok { return nil, fmt.Errorf("value %d: struct defined by %s", id, definition.Type()) }
+		instance := &object.Struct{Definition: structType}
+		d.values[id] = instance
+		if instance.Values, err = d.list(saved.Elements); err != nil { return nil, err }
+		if len(instance.Values) != len(structType.Fields) { return nil, fmt.Errorf("value %d: wrong number of fields", id) }
+
+	default:
+		return nil, fmt.Errorf("value %d: unknown type %s", id, saved.Type)
+	}
+
+	return d.values[id], nil
+}
+
+func (d *decoder) list(ids []int) ([]object.Object, error) {
+	objs := []object.Object{}
+	for _, id := range ids {
+		obj, err := d.value(id)
+		if err != nil { return nil, err }
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+/*
+ Parse a function's source on its own. Names it uses from outside itself are left unresolved, so they're looked up in
+ the environment it's restored into by name
+ */
+func parseFunction(source string) (*ast.FunctionLiteral, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 { return nil, fmt.Errorf("function source doesn't parse: %s", p.Errors()[0]) }
+
+	if len(program.Statements) == 1 {
+		if stmt, ok := program.Statements[0].(*ast.ExpressionStatement); ok {
+			if literal, ok := stmt.Expression.(*ast.FunctionLiteral); ok { return literal, nil }
+		}
+	}
+	return nil, fmt.Errorf("function source is not a function: %q", source)
+}
@@ -0,0 +1,162 @@
+package snapshot
+
+import (
+	"bytes"
+	"mockc/evaluator"
+	"mockc/lexer"
+	"mockc/object"
+	"mockc/parser"
+	"strings"
+	"testing"
+)
+
+const SOURCE = `let n = 5;
+let big = 99999999999999999999;
+let words = ["a", "b"];
+let table = {"words": words, 1: true, false: big};
+let nothing = first([]);
+let fib = fn(x) { if (x < 2) { return x; } fib(x - 1) + fib(x - 2) };
+let counter = fn(start) { fn(step) { start + step } };
+let fromTen = counter(10);
+let parity = fn() {
+  let even = fn(x) { if (x == 0) { true } else { odd(x - 1) } };
+  let odd = fn(x) { if (x == 0) { false } else { even(x - 1) } };
+  [even, odd]
+}();
+let greet = fn(name: string = "you", [a, b] = [1, 2]) -> string { "} " + name + sprintf(" %d", a + b) };
+let shout = upper;
+struct Point { x, y };
+impl Point { let sum = fn(self) { self.x + self.y }; };
+let origin = Point(0, n);
+let evens = fn() { for (i in count()) { if (i % 2 == 0) { yield i } } };
+`
+
+func eval(t *testing.T, input string, env *object.Environment) object.Object {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 { t.Fatalf("%s: parser had errors: %v", input, p.Errors()) }
+
+	return evaluator.Eval(program, env)
+}
+
+func restore(t *testing.T, env *object.Environment) *object.Environment {
+	t.Helper()
+	data, err := Snapshot(env)
+	if err != nil { t.Fatalf("snapshot failed: %s", err) }
+	restored, err := Restore(data, object.NewRuntime())
+	if err != nil { t.Fatalf("restore failed: %s", err) }
+
+	return restored
+}
+
+func TestRoundTrip(t *testing.T) {
+	env := object.NewEnvironment()
+	eval(t, SOURCE, env)
+	restored := restore(t, restore(t, env)) // Restored functions can be saved again
+
+	inputs := []string{
+		"n", "big", "big + 1", "words", "table", `table["words"]`, "nothing", "fib(15)", "fromTen(5)", "counter(1)(1)",
+		"parity[0](10)", "parity[1](7)", "greet()", `greet("me", [3, 4])`, `shout("hi")`, "origin", "origin.sum()",
+		"Point(1, 2).sum()", "take(evens(), 3).collect()",
+	}
+	for _, input := range inputs {
+		want := eval(t, input, env).Inspect()
+		if got := eval(t, input, restored).Inspect(); got != want {
+			t.Errorf("%s: wrong result after restoring. got=%s, want=%s", input, got, want)
+		}
+	}
+}
+
+/*
+ Values reachable in more than one way, including closures that refer to each other, are restored once and shared
+ */
+func TestSharedValuesStayShared(t *testing.T) {
+	env := object.NewEnvironment()
+	eval(t, SOURCE, env)
+	restored := restore(t, env)
+
+	parity, _ := restored.Get("parity")
+	even := parity.(*object.Array).Elements[0].(*object.Function)
+	odd := parity.(*object.Array).Elements[1].(*object.Function)
+	if even.Env != odd.Env { t.Fatalf("even and odd should share the environment they were created in") }
+	if bound, _ := even.Env.Get("odd"); bound != odd { t.Errorf("even should see the same odd as the array holds") }
+
+	words, _ := restored.Get("words")
+	table, _ := restored.Get("table")
+	if inTable, _ := table.(*object.Hash).Get(&object.String{Value: "words"}); inTable != words {
+		t.Errorf("words should be the same array in both places")
+	}
+
+	fib, _ := restored.Get("fib")
+	if fib.(*object.Function).Env != restored { t.Errorf("top level functions should capture the restored environment") }
+}
+
+func TestSnapshotsAreDeterministic(t *testing.T) {
+	env := object.NewEnvironment()
+	eval(t, SOURCE, env)
+
+	first, err := Snapshot(env)
+	if err != nil { t.Fatalf("snapshot failed: %s", err) }
+	second, _ := Snapshot(restore(t, env))
+	if !bytes.Equal(first, second) { t.Errorf("restoring changed the snapshot.\nbefore=%s\nafter=%s", first, second) }
+}
+
+func TestRestoredEnvironmentsUseTheirRuntime(t *testing.T) {
+	env := object.NewEnvironment()
+	eval(t, `let say = fn(x) { print(x) };`, env)
+	data, _ := Snapshot(env)
+
+	var out bytes.Buffer
+	runtime := object.NewRuntime()
+	runtime.Stdout = &out
+	restored, err := Restore(data, runtime)
+	if err != nil { t.Fatalf("restore failed: %s", err) }
+
+	eval(t, `say("hello")`, restored)
+	if out.String() != "hello\n" { t.Errorf("wrong output. got=%q", out.String()) }
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let it = iter([1]);`, "cannot save it: values of type ITERATOR can't be saved"},
+		{`let ch = channel();`, "cannot save ch: values of type CHANNEL can't be saved"},
+		{`let later = [spawn fn() { 1 }];`, "cannot save later: values of type FUTURE can't be saved"},
+		{`let g = fn() { let it = iter([1]); fn() { it } }();`, "cannot save g: cannot save it: values of type ITERATOR can't be saved"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		eval(t, tt.input, env)
+		if _, err := Snapshot(env); err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. got=%v, want=%q", tt.input, err, tt.expected)
+		}
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`not json`, "not a snapshot"},
+		{`{"version": 2, "environments": [{"outer": -1, "bindings": {}}]}`, "unsupported snapshot version 2, want 1"},
+		{`{"version": 1, "environments": [{"outer": 0, "bindings": {}}]}`, "environment 0 is enclosed by 0, which comes after it"},
+		{`{"version": 1, "environments": [{"outer": -1, "bindings": {"x": 3}}], "values": []}`, "environment 0, x: no value 3"},
+		{`{"version": 1, "environments": [{"outer": -1, "bindings": {"x": 0}}], "values": [{"type": "INTEGER", "value": "x"}]}`, "environment 0, x: value 0: strconv.ParseInt"},
+		{`{"version": 1, "environments": [{"outer": -1, "bindings": {"f": 0}}], "values": [{"type": "FUNCTION", "value": "1 + 1", "environment": 0}]}`, "environment 0, f: value 0: function source is not a function"},
+		{`{"version": 1, "environments": [{"outer": -1, "bindings": {"f": 0}}], "values": [{"type": "FUNCTION", "value": "fn(x) { x }"}]}`, "environment 0, f: value 0: function without an environment"},
+		{`{"version": 1, "environments": [{"outer": -1, "bindings": {"x": 0}}], "values": [{"type": "ITERATOR"}]}`, "environment 0, x: value 0: unknown type ITERATOR"},
+		{`{"version": 1, "environment": 1, "environments": [{"outer": -1, "bindings": {}}]}`, "no environment 1"},
+	}
+
+	for _, tt := range tests {
+		_, err := Restore([]byte(tt.input), object.NewRuntime())
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. got=%v, want=%q", tt.input, err, tt.expected)
+		}
+	}
+}
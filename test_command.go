@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mockc/coverage"
+	"mockc/object"
+	"mockc/testrunner"
+	"os"
+	"regexp"
+)
+
+/*
+ mockc test [-run regexp] [-junit file] [-coverprofile file] [paths...]
+ Runs the Moxie tests found in the given files and directories, the current directory by default. Returns the exit
+ status: 0 when every test passed, 1 when any failed and 2 for bad usage
+ */
+func testCommand(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	run := flags.String("run", "", "only run tests whose name matches this regular expression")
+	junit := flags.String("junit", "", "also write a JUnit XML report to this file")
+	coverProfile := flags.String("coverprofile", "", "write a coverage profile of the test files to this file")
+	if err := flags.Parse(args); err != nil { return 2 }
+
+	opts := testrunner.Options{Out: os.Stdout, NewRuntime: testRuntime}
+	if *coverProfile != "" { opts.Coverage = coverage.NewProfile() }
+	if *run != "" {
+		filter, err := regexp.Compile(*run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -run pattern: %s\n", err)
+			return 2
+		}
+		opts.Filter = filter
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 { paths = []string{"."} }
+	files, err := testrunner.Discover(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	report := testrunner.Run(files, opts)
+	if *junit != "" {
+		out, err := os.Create(*junit)
+		if err == nil {
+			err = report.WriteJUnit(out)
+			out.Close()
+		}
+		if err != nil { fmt.Fprintf(os.Stderr, "Could not write JUnit report: %s\n", err) }
+	}
+
+	if opts.Coverage != nil {
+		if err := writeCoverProfile(opts.Coverage, *coverProfile); err != nil { fmt.Fprintf(os.Stderr, "Could not write coverage profile: %s\n", err) }
+	}
+
+	passed, failed := report.Counts()
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 { return 1 }
+
+	return 0
+}
+
+/*
+ Tests get the same capabilities as programs run from the command line, except ending the whole test run
+ */
+func testRuntime() *object.Runtime {
+	runtime := hostRuntime()
+	runtime.Exit = nil
+
+	return runtime
+}
@@ -0,0 +1,254 @@
+package testrunner
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"mockc/ast"
+	"mockc/coverage"
+	"mockc/evaluator"
+	"mockc/lexer"
+	"mockc/object"
+	"mockc/parser"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Runs tests written in Moxie. Test files end in _test.mx and every top level `let test_name = fn() { ... }` in them
+// is a test. Each test gets a fresh environment with the whole file evaluated in it, so tests can share helpers but
+// never state, and a test passes when calling it doesn't produce an error
+
+const (
+	FILE_SUFFIX = "_test.mx"
+	TEST_PREFIX = "test_"
+)
+
+type Options struct {
+	Filter     *regexp.Regexp         // Only tests whose name matches are run, nil runs all of them
+	Out        io.Writer              // Results are reported here, along with anything the tests print
+	NewRuntime func() *object.Runtime // Called for every test, nil gives each one object.NewRuntime()
+	Coverage   *coverage.Profile      // Records what the tests ran, nil to not record coverage
+}
+
+type Result struct {
+	Name     string
+	Failure  string // Empty when the test passed
+	Duration time.Duration
+}
+
+func (r Result) Passed() bool { return r.Failure == "" }
+
+type FileResult struct {
+	Path     string
+	Tests    []Result
+	Duration time.Duration
+}
+
+type Report struct {
+	Files []FileResult
+}
+
+/*
+ Count the tests that passed and failed across every file
+ */
+func (r *Report) Counts() (passed, failed int) {
+	for _, file := range r.Files {
+		for _, test := range file.Tests {
+			if test.Passed() { passed++ } else { failed++ }
+		}
+	}
+
+	return passed, failed
+}
+
+/*
+ Expand the paths given on the command line into test files. Directories are searched recursively for files ending
+ in _test.mx, files are taken as they are
+ */
+func Discover(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil { return nil, err }
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil { return err }
+			if !entry.IsDir() && strings.HasSuffix(file, FILE_SUFFIX) { files = append(files, file) }
+			return nil
+		})
+		if err != nil { return nil, err }
+	}
+
+	return files, nil
+}
+
+/*
+ Run the tests in each file, reporting them to opts.Out as they finish
+ */
+func Run(files []string, opts Options) *Report {
+	if opts.Out == nil { opts.Out = io.Discard }
+	if opts.NewRuntime == nil { opts.NewRuntime = object.NewRuntime }
+
+	report := &Report{}
+	for _, path := range files {
+		start := time.Now()
+		file := FileResult{Path: path, Tests: runFile(path, opts)}
+		file.Duration = time.Since(start)
+		report.Files = append(report.Files, file)
+
+		passed, failed := (&Report{Files: []FileResult{file}}).Counts()
+		status := "ok  "
+		if failed > 0 { status = "FAIL" }
+		fmt.Fprintf(opts.Out, "%s  %s  %d passed, %d failed (%.3fs)\n", status, path, passed, failed, file.Duration.Seconds())
+	}
+
+	return report
+}
+
+func runFile(path string, opts Options) []Result {
+	program, err := parseFile(path)
+	if err != "" { return []Result{report(opts.Out, Result{Name: path, Failure: err})} } // The file itself fails
+
+	if opts.Coverage != nil { opts.Coverage.Instrument(path, program) }
+
+	results := []Result{}
+	for _, name := range testNames(program) {
+		if opts.Filter != nil && !opts.Filter.MatchString(name) { continue }
+
+		runtime := opts.NewRuntime()
+		runtime.Stdout = opts.Out // Keeps what a test prints next to its result
+		if opts.Coverage != nil { runtime.Tracer = opts.Coverage }
+		start := time.Now()
+		failure := runTest(program, name, runtime)
+		results = append(results, report(opts.Out, Result{Name: name, Failure: failure, Duration: time.Since(start)}))
+	}
+
+	return results
+}
+
+func parseFile(path string) (*ast.Program, string) {
+	source, err := os.ReadFile(path)
+	if err != nil { return nil, err.Error() }
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 { return nil, "parser errors:\n" + strings.Join(p.Errors(), "\n") }
+
+	return program, ""
+}
+
+/*
+ Tests are the top level lets binding a function literal to a name starting with test_, in the order they're written
+ */
+func testNames(program *ast.Program) []string {
+	names := []string{}
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok || let.Name == nil || !strings.HasPrefix(let.Name.Value, TEST_PREFIX) { continue }
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok { names = append(names, let.Name.Value) }
+	}
+
+	return names
+}
+
+func runTest(program *ast.Program, name string, runtime *object.Runtime) string {
+	env := object.NewEnvironmentWithRuntime(runtime)
+	if loaded := evaluator.Eval(program, env); loaded != nil && loaded.Type() == object.ERROR_OBJECT {
+		return "error loading file: " + loaded.Inspect()
+	}
+
+	test, ok := env.Get(name)
+	if !ok { return name + " was not defined" } // The file stopped, ex. at a top level return, before its let ran
+	switch test := test.(type) {
+	case *object.Function:
+		if len(test.Parameters) != 0 { return "test functions must not take parameters" }
+	case *object.BuiltIn: // Called as it is
+	default:
+		return fmt.Sprintf("%s is %s, not a function", name, test.Type())
+	}
+
+	result := evaluator.Call(test, []object.Object{}, env)
+	if result != nil && result.Type() == object.ERROR_OBJECT { return result.Inspect() }
+
+	return ""
+}
+
+func report(out io.Writer, result Result) Result {
+	if result.Passed() {
+		fmt.Fprintf(out, "--- PASS: %s (%.3fs)\n", result.Name, result.Duration.Seconds())
+	} else {
+		fmt.Fprintf(out, "--- FAIL: %s (%.3fs)\n", result.Name, result.Duration.Seconds())
+		fmt.Fprintf(out, "    %s\n", strings.ReplaceAll(result.Failure, "\n", "\n    "))
+	}
+
+	return result
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+/*
+ Write the report in the JUnit XML format CI servers understand, one test suite per file
+ */
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suites := junitSuites{}
+	for _, file := range r.Files {
+		suite := junitSuite{Name: file.Path, Time: seconds(file.Duration)}
+		for _, test := range file.Tests {
+			testCase := junitCase{Name: test.Name, ClassName: file.Path, Time: seconds(test.Duration)}
+			if !test.Passed() {
+				summary, _, _ := strings.Cut(test.Failure, "\n")
+				testCase.Failure = &junitFailure{Message: summary, Text: test.Failure}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	io.WriteString(w, xml.Header)
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil { return err }
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string { return fmt.Sprintf("%.3f", d.Seconds()) }
@@ -0,0 +1,138 @@
+package testrunner
+
+import (
+	"bytes"
+	"mockc/coverage"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir, name, source string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil { t.Fatal(err) }
+
+	return path
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "nested"), 0755)
+	writeTestFile(t, dir, "a_test.mx", "")
+	writeTestFile(t, dir, "helpers.mx", "")
+	writeTestFile(t, dir, filepath.Join("nested", "b_test.mx"), "")
+
+	files, err := Discover([]string{dir})
+	if err != nil { t.Fatal(err) }
+
+	expected := []string{filepath.Join(dir, "a_test.mx"), filepath.Join(dir, "nested", "b_test.mx")}
+	if strings.Join(files, ",") != strings.Join(expected, ",") { t.Errorf("wrong files. got=%v, want=%v", files, expected) }
+}
+
+func TestRun(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "math_test.mx", `
+		let counter = [];
+		let double = fn(x) { x * 2 };
+		let test_double = fn() { assert_eq(double(2), 4); };
+		let test_fresh_env = fn() { let counter = push(counter, 1); assert_eq(len(counter), 1); };
+		let test_fresh_env_again = fn() { let counter = push(counter, 1); assert_eq(len(counter), 1); };
+		let test_broken = fn() { assert_eq(double(2), 5); };
+		let test_args = fn(x) { x };
+		let not_a_test = fn() { assert(false) };
+	`)
+
+	var out bytes.Buffer
+	report := Run([]string{path}, Options{Out: &out})
+
+	failures := map[string]string{}
+	names := []string{}
+	for _, test := range report.Files[0].Tests {
+		names = append(names, test.Name)
+		failures[test.Name] = test.Failure
+	}
+
+	if strings.Join(names, ",") != "test_double,test_fresh_env,test_fresh_env_again,test_broken,test_args" {
+		t.Errorf("wrong tests discovered. got=%v", names)
+	}
+	for _, name := range []string{"test_double", "test_fresh_env", "test_fresh_env_again"} {
+		if failures[name] != "" { t.Errorf("%s should pass. got=%q", name, failures[name]) }
+	}
+	if failures["test_broken"] != "assert_eq failed\n  - expected: 5\n  + actual:   4\n              ^" {
+		t.Errorf("wrong failure for test_broken. got=%q", failures["test_broken"])
+	}
+	if failures["test_args"] != "test functions must not take parameters" {
+		t.Errorf("wrong failure for test_args. got=%q", failures["test_args"])
+	}
+	if passed, failed := report.Counts(); passed != 3 || failed != 2 {
+		t.Errorf("wrong counts. got=%d passed, %d failed", passed, failed)
+	}
+	if !strings.Contains(out.String(), "--- FAIL: test_broken") { t.Errorf("failure not reported. got=%q", out.String()) }
+}
+
+func TestRunCoverage(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "c_test.mx", `let abs = fn(n) { if (n < 0) { -n } else { n } };
+let test_positive = fn() { assert_eq(abs(2), 2) };
+let test_zero = fn() { assert_eq(abs(0), 0) };`)
+
+	profile := coverage.NewProfile()
+	Run([]string{path}, Options{Coverage: profile})
+
+	then := coverage.Point{File: path, Line: 1, Column: 19, Kind: coverage.BRANCH_THEN}
+	otherwise := coverage.Point{File: path, Line: 1, Column: 19, Kind: coverage.BRANCH_ELSE}
+	if count, ok := profile.Counts[then]; !ok || count != 0 { t.Errorf("then branch should be instrumented and never run. got=%d, %t", count, ok) }
+	if profile.Counts[otherwise] != 2 { t.Errorf("else branch should run once per test. got=%d", profile.Counts[otherwise]) }
+}
+
+func TestRunFilter(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "f_test.mx", `let test_one = fn() { 1 }; let test_two = fn() { 2 };`)
+
+	report := Run([]string{path}, Options{Filter: regexp.MustCompile("two$")})
+	if len(report.Files[0].Tests) != 1 || report.Files[0].Tests[0].Name != "test_two" {
+		t.Errorf("filter not applied. got=%+v", report.Files[0].Tests)
+	}
+}
+
+func TestRunUndefinedTests(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "u_test.mx", `let test_first = fn() { 1 }; return 1; let test_after = fn() { 2 };`)
+
+	report := Run([]string{path}, Options{})
+	tests := report.Files[0].Tests
+	if len(tests) != 2 || !tests[0].Passed() || tests[1].Failure != "test_after was not defined" {
+		t.Errorf("a test the file never got to should fail. got=%+v", tests)
+	}
+}
+
+func TestRunOutput(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "o_test.mx", `let test_print = fn() { print("from the test") };`)
+
+	var out bytes.Buffer
+	Run([]string{path}, Options{Out: &out})
+	if !strings.HasPrefix(out.String(), "from the test\n--- PASS: test_print") { t.Errorf("test output not captured. got=%q", out.String()) }
+}
+
+func TestRunBrokenFile(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "broken_test.mx", `let test_x = fn() { 1 }; let = 5;`)
+
+	report := Run([]string{path}, Options{})
+	tests := report.Files[0].Tests
+	if len(tests) != 1 || tests[0].Name != path || !strings.HasPrefix(tests[0].Failure, "parser errors:") {
+		t.Errorf("parser errors should fail the file. got=%+v", tests)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "j_test.mx", `let test_ok = fn() { 1 }; let test_bad = fn() { assert(false, "<nope>") };`)
+
+	var out bytes.Buffer
+	if err := Run([]string{path}, Options{}).WriteJUnit(&out); err != nil { t.Fatal(err) }
+
+	for _, expected := range []string{
+		`<testsuites tests="2" failures="1">`,
+		`<testcase name="test_ok" classname="` + path + `"`,
+		`<failure message="assert failed: &lt;nope&gt;">`,
+	} {
+		if !strings.Contains(out.String(), expected) { t.Errorf("report missing %q. got=\n%s", expected, out.String()) }
+	}
+}
@@ -5,6 +5,9 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string //Strings don't offer the best performance, but they're more convenient to work with
+	Line    int // Where the token starts in the source, both counting from 1
+	Column  int
+	Offset  int // Where the token starts in the source in bytes, counting from 0
 }
 
 const (
@@ -38,6 +41,10 @@ const (
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON	  = ":"
+	DOT       = "."
+	ELLIPSIS  = "..."
+	ARROW     = "=>"
+	RETURNS   = "->" // Return type annotations, ex. fn(x: int) -> int
 	LPAREN    = "("
 	RPAREN    = ")"
 	LBRACE    = "{"
@@ -53,6 +60,14 @@ const (
 	TRUE	 = "TRUE"
 	FALSE	 = "FALSE"
 	RETURN	 = "RETURN"
+	STRUCT   = "STRUCT"
+	IMPL     = "IMPL"
+	MATCH    = "MATCH"
+	YIELD    = "YIELD"
+	FOR      = "FOR"
+	IN       = "IN"
+	SPAWN    = "SPAWN"
+	AWAIT    = "AWAIT"
 )
 
 var keywords = map[string] TokenType {
@@ -63,6 +78,14 @@ var keywords = map[string] TokenType {
 	"true": TRUE,
 	"false": FALSE,
 	"return": RETURN,
+	"struct": STRUCT,
+	"impl": IMPL,
+	"match": MATCH,
+	"yield": YIELD,
+	"for": FOR,
+	"in": IN,
+	"spawn": SPAWN,
+	"await": AWAIT,
 }
 
 /*